@@ -24,15 +24,20 @@ import (
 )
 
 var auditKVCmd = &cobra.Command{
-	Use:     "kv <collection> <primary key value>",
-	Short:   "Audit your kv collection entry",
-	Example: "immudb-log-audit audit kv samplecollection 100",
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    auditKv,
+	Use:   "kv <collection> <primary key value>",
+	Short: "Audit your kv collection entry",
+	Long: `Lists all revisions of key-value collection entry with given primary key value.
+
+With --verify, each listed revision is checked with immudb proofs against locally stored trusted state. The list of revisions comes from entry history, which cannot be proven, so revisions omitted from it are not detected.`,
+	Example: `immudb-log-audit audit kv samplecollection 100
+immudb-log-audit audit kv samplecollection 100 --verify`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: auditKv,
 }
 
 func init() {
 	auditCmd.AddCommand(auditKVCmd)
+	auditKVCmd.Flags().Bool("verify", false, "verify each listed revision with immudb proofs against locally stored trusted state, completeness of the history is not verified")
 }
 
 func auditKv(cmd *cobra.Command, args []string) error {
@@ -51,6 +56,20 @@ func auditKv(cmd *cobra.Command, args []string) error {
 		pkValue = args[1]
 	}
 
+	verify, _ := cmd.Flags().GetBool("verify")
+	if verify {
+		history, err := jr.VerifiedHistory(pkValue)
+		if err != nil {
+			return fmt.Errorf("could not verify audit, %w", err)
+		}
+
+		for _, h := range history {
+			fmt.Printf("{\"tx_id\": %d, \"revision\": %d, \"verified\": true, \"entry\": %s}\n", h.TxID, h.Revision, string(h.Entry))
+		}
+
+		return nil
+	}
+
 	history, err := jr.History(pkValue)
 	if err != nil {
 		return fmt.Errorf("could not get audit, %w", err)
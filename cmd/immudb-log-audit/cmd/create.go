@@ -17,10 +17,19 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
 	"github.com/spf13/cobra"
 )
 
 var flagParser string
+var flagParserOptions lineparser.Options
+var flagParserDefinition string
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "create collection in immudb",
@@ -29,7 +38,12 @@ var createCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(createCmd)
-	createCmd.PersistentFlags().StringVar(&flagParser, "parser", "", "Line parser to be used. When not specified, lines will be considered as jsons. Also available 'pgaudit', 'wrap'. For those, indexes are predefined.")
+	createCmd.PersistentFlags().StringVar(&flagParser, "parser", "", "Line parser to be used. When not specified, lines will be considered as jsons. Also available "+cmdutils.ParserNames()+", see 'parser list'. For those, indexes are predefined.")
+	createCmd.PersistentFlags().StringVar(&flagParserOptions.UIDMode, "uid-mode", lineparser.UIDModeRandom, "How entry uid is generated, 'random', 'content' - derived from source position and line content, 'fields' - derived from --uid-fields. Deterministic uids make re-ingestion of the same lines idempotent.")
+	createCmd.PersistentFlags().StringSliceVar(&flagParserOptions.UIDFields, "uid-fields", nil, "Parsed entry fields used to derive uid with --uid-mode fields, e.g. session_id,statement_id,substatement_id")
+	createCmd.PersistentFlags().StringVar(&flagParserDefinition, "parser-definition", "", "YAML or JSON file with custom parser definition, pattern, field types and indexes. The definition is stored with collection configuration.")
+	createCmd.PersistentFlags().StringVar(&flagParserOptions.LogLinePrefix, "log-line-prefix", "", "postgres log_line_prefix used by pgaudit parser, escapes like %u, %d, %c or %r are stored as named fields. Default '%m [%p] '")
+	createCmd.PersistentFlags().StringVar(&flagParserOptions.LogFormat, "log-format", "", "nginx log_format used by nginx parser, variables like $remote_addr, $request or $status are stored as typed fields, other variables as strings. Default nginx combined format")
 }
 
 func create(cmd *cobra.Command, args []string) error {
@@ -37,5 +51,47 @@ func create(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
 	}
 
-	return runParentCmdE(cmd, args)
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if flagParserDefinition != "" {
+		if flagParser != "custom" {
+			return errors.New("parser definition can be used only with custom parser")
+		}
+
+		flagParserOptions.Definition, err = lineparser.ReadDefinition(flagParserDefinition)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = flagParserOptions.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid parser options, %w", err)
+	}
+
+	return nil
+}
+
+// writeParserConfig stores parser and its options, tail reads them to parse lines the same way
+func writeParserConfig(typ string, collection string) error {
+	configs := immudb.NewConfigs(immuCli)
+	err := configs.WriteTypeParser(collection, typ, flagParser)
+	if err != nil {
+		return fmt.Errorf("could not create json repository parser config, %w", err)
+	}
+
+	b, err := json.Marshal(flagParserOptions)
+	if err != nil {
+		return fmt.Errorf("could not marshal parser options, %w", err)
+	}
+
+	err = configs.WriteParserOptions(collection, b)
+	if err != nil {
+		return fmt.Errorf("could not create json repository parser options config, %w", err)
+	}
+
+	return nil
 }
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
 	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -47,26 +48,23 @@ func createKV(cmd *cobra.Command, args []string) error {
 	}
 
 	flagIndexes, _ := cmd.Flags().GetStringSlice("indexes")
-	if flagParser == "pgaudit" {
-		flagIndexes = []string{"uid", "statement_id", "substatement_id", "server_timestamp", "timestamp", "audit_type", "class", "command"}
-		log.WithField("indexes", flagIndexes).Info("Using default indexes for pgaudit parser")
-	} else if flagParser == "pgauditjsonlog" {
-		flagIndexes = []string{"uid", "user", "dbname", "session_id", "statement_id", "substatement_id", "server_timestamp", "timestamp", "audit_type", "class", "command"}
-		log.WithField("indexes", flagIndexes).Info("Using default indexes for pgauditjsonlog parser")
-	} else if flagParser == "wrap" {
-		flagIndexes = []string{"uid", "timestamp"}
-		log.WithField("indexes", flagIndexes).Info("Using default indexes for wrap parser")
-	} else if flagParser != "" {
-		return fmt.Errorf("unkown parser %s", flagParser)
+	if flagParser != "" {
+		schema, err := cmdutils.ParserSchema(flagParser, flagParserOptions)
+		if err != nil {
+			return err
+		}
+
+		flagIndexes = cmdutils.KVIndexes(schema)
+		log.WithField("indexes", flagIndexes).Infof("Using default indexes for %s parser", flagParser)
 	}
 
 	if len(flagIndexes) == 0 {
 		return errors.New("at least primary key needs to be specified")
 	}
 
-	err = immudb.NewConfigs(immuCli).WriteTypeParser("kv", args[0], flagParser)
+	err = writeParserConfig("kv", args[0])
 	if err != nil {
-		return fmt.Errorf("could not create json repository parser config, %w", err)
+		return err
 	}
 
 	err = immudb.SetupJsonKVRepository(immuCli, args[0], flagIndexes)
@@ -18,9 +18,9 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
 	"strings"
 
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
 	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -47,29 +47,23 @@ func createSQL(cmd *cobra.Command, args []string) error {
 
 	primaryKey, _ := cmd.Flags().GetStringSlice("primary-key")
 	flagColumns, _ := cmd.Flags().GetStringSlice("columns")
-	if flagParser == "pgaudit" {
-		flagColumns = []string{"id=INTEGER AUTO_INCREMENT", "statement_id=INTEGER", "substatement_id=INTEGER", "server_timestamp=TIMESTAMP", "timestamp=TIMESTAMP", "audit_type=VARCHAR[256]", "class=VARCHAR[256]", "command=VARCHAR[256]"}
-		primaryKey = []string{"id"}
-		log.WithField("columns", flagColumns).WithField("primary_key", primaryKey).Info("Using default indexes for pgaudit parser")
-	} else if flagParser == "pgauditjsonlog" {
-		flagColumns = []string{"id=INTEGER AUTO_INCREMENT", "user=VARCHAR[256]", "dbname=VARCHAR[256]", "session_id=VARCHAR[256]", "statement_id=INTEGER", "substatement_id=INTEGER", "server_timestamp=TIMESTAMP", "timestamp=TIMESTAMP", "audit_type=VARCHAR[256]", "class=VARCHAR[256]", "command=VARCHAR[256]"}
-		primaryKey = []string{"id"}
-		log.WithField("columns", flagColumns).WithField("primary_key", primaryKey).Info("Using default indexes for pgauditjsonlog parser")
-	} else if flagParser == "wrap" {
-		flagColumns = []string{"uid=VARCHAR[36]", "log_timestamp=TIMESTAMP"}
-		primaryKey = []string{"uid"}
-		log.WithField("columns", flagColumns).WithField("primary_key", primaryKey).Info("Using default indexes for wrap parser")
-	} else if flagParser != "" {
-		return fmt.Errorf("unkown parser %s", flagParser)
+	if flagParser != "" {
+		schema, err := cmdutils.ParserSchema(flagParser, flagParserOptions)
+		if err != nil {
+			return err
+		}
+
+		flagColumns, primaryKey = cmdutils.SQLColumns(schema)
+		log.WithField("columns", flagColumns).WithField("primary_key", primaryKey).Infof("Using default indexes for %s parser", flagParser)
 	}
 
 	if len(flagColumns) == 0 || len(primaryKey) == 0 {
 		return errors.New("at least one column and primary key needs to be specified")
 	}
 
-	err = immudb.NewConfigs(immuCli).WriteTypeParser("sql", args[0], flagParser)
+	err = writeParserConfig("sql", args[0])
 	if err != nil {
-		return fmt.Errorf("could not create json repository parser config, %w", err)
+		return err
 	}
 	immudb.SetupJsonSQLRepository(immuCli, args[0], strings.Join(primaryKey, ","), flagColumns)
 
@@ -0,0 +1,43 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/spf13/cobra"
+)
+
+var parserListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List available line parsers",
+	Long:    "Lists available line parsers with their output fields and fields indexed by default when collection is created with the parser.",
+	Example: "immudb-log-audit parsers list",
+	RunE:    parserList,
+	Args:    cobra.NoArgs,
+}
+
+func init() {
+	parserCmd.AddCommand(parserListCmd)
+}
+
+func parserList(cmd *cobra.Command, args []string) error {
+	cmdutils.PrintParsers(os.Stdout, lineparser.Options{})
+	return nil
+}
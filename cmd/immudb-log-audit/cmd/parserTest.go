@@ -0,0 +1,139 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
+	"github.com/spf13/cobra"
+)
+
+var parserTestCmd = &cobra.Command{
+	Use:   "test [file]",
+	Short: "Parse lines from file or stdin and print resulting json or parse errors",
+	Long: `Runs each line through the line parser, without storing it, and prints resulting json or parse error with summary counts.
+With --collection, parser and its options default to collection configuration, and parsed entries are validated against collection indexes or columns. immudb connection is needed only with --collection.
+Command fails when any line could not be parsed or does not match collection schema.`,
+	Example: `immudb-log-audit parser test --parser pgaudit postgresql.log
+tail -n 100 postgresql.log | immudb-log-audit parser test --parser pgaudit --log-line-prefix '%m [%p] %q%u@%d '
+immudb-log-audit parser test --collection pgaudit postgresql.log`,
+	RunE: parserTest,
+	Args: cobra.MaximumNArgs(1),
+}
+
+func init() {
+	parserCmd.AddCommand(parserTestCmd)
+	parserTestCmd.Flags().String("parser", "", "Line parser to be tested, "+cmdutils.ParserNames()+". When not specified, lines are considered as jsons.")
+	parserTestCmd.Flags().String("collection", "", "If set, parsed entries are validated against collection indexes or columns")
+	parserTestCmd.Flags().String("uid-mode", lineparser.UIDModeRandom, "How entry uid is generated, 'random', 'content' or 'fields'")
+	parserTestCmd.Flags().StringSlice("uid-fields", nil, "Parsed entry fields used to derive uid with --uid-mode fields")
+	parserTestCmd.Flags().String("parser-definition", "", "YAML or JSON file with custom parser definition")
+	parserTestCmd.Flags().String("log-line-prefix", "", "postgres log_line_prefix used by pgaudit parser. Default '%m [%p] '")
+	parserTestCmd.Flags().String("log-format", "", "nginx log_format used by nginx parser. Default nginx combined format")
+}
+
+func parserTest(cmd *cobra.Command, args []string) error {
+	flagTestParser, _ := cmd.Flags().GetString("parser")
+	flagCollection, _ := cmd.Flags().GetString("collection")
+
+	var opts lineparser.Options
+	opts.UIDMode, _ = cmd.Flags().GetString("uid-mode")
+	opts.UIDFields, _ = cmd.Flags().GetStringSlice("uid-fields")
+	opts.LogLinePrefix, _ = cmd.Flags().GetString("log-line-prefix")
+	opts.LogFormat, _ = cmd.Flags().GetString("log-format")
+
+	flagTestParserDefinition, _ := cmd.Flags().GetString("parser-definition")
+	if flagTestParserDefinition != "" {
+		if flagTestParser != "custom" {
+			return errors.New("parser definition can be used only with custom parser")
+		}
+
+		d, err := lineparser.ReadDefinition(flagTestParserDefinition)
+		if err != nil {
+			return err
+		}
+
+		opts.Definition = d
+	}
+
+	var validator cmdutils.EntryValidator
+	if flagCollection != "" {
+		err := runParentCmdE(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		typ, parser, err := immudb.NewConfigs(immuCli).ReadTypeParser(flagCollection)
+		if err != nil {
+			return fmt.Errorf("collection does not exist, %w", err)
+		}
+
+		if !cmd.Flags().Changed("parser") {
+			flagTestParser = parser
+			opts, err = readParserOptions(flagCollection)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch typ {
+		case "kv":
+			validator, err = immudb.NewJsonKVRepository(immuCli, flagCollection)
+		case "sql":
+			validator, err = immudb.NewJsonSQLRepository(immuCli, flagCollection)
+		default:
+			err = fmt.Errorf("invalid repository type %s", typ)
+		}
+		if err != nil {
+			return fmt.Errorf("collection configuration is corrupted, %w", err)
+		}
+	}
+
+	lp, err := cmdutils.NewLineParser(flagTestParser, opts)
+	if err != nil {
+		return fmt.Errorf("invalid line parser, %w", err)
+	}
+
+	var r io.Reader = os.Stdin
+	source := "stdin"
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("could not open file, %w", err)
+		}
+		defer f.Close()
+
+		r, source = f, args[0]
+	}
+
+	summary, err := cmdutils.RunParserTest(r, source, lp, cmdutils.ParserMultiline(flagTestParser), validator, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if !summary.OK() {
+		return errors.New("some lines could not be parsed or do not match collection schema")
+	}
+
+	return nil
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
 	"github.com/spf13/cobra"
 )
 
@@ -42,3 +45,33 @@ func read(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// readCollection reads all entries of kv or sql collection
+func readCollection(collection string, typ string) ([][]byte, error) {
+	switch typ {
+	case "kv":
+		jr, err := immudb.NewJsonKVRepository(immuCli, collection)
+		if err != nil {
+			return nil, fmt.Errorf("could not create json kv repository, %w", err)
+		}
+
+		stored, err := jr.Read("", "")
+		if err != nil {
+			return nil, fmt.Errorf("could not read, %w", err)
+		}
+		return stored, nil
+	case "sql":
+		jr, err := immudb.NewJsonSQLRepository(immuCli, collection)
+		if err != nil {
+			return nil, fmt.Errorf("could not create json sql repository, %w", err)
+		}
+
+		stored, err := jr.Read("")
+		if err != nil {
+			return nil, fmt.Errorf("could not read, %w", err)
+		}
+		return stored, nil
+	default:
+		return nil, fmt.Errorf("invalid repository type %s", typ)
+	}
+}
@@ -27,15 +27,20 @@ import (
 var readKVCmd = &cobra.Command{
 	Use:   "kv <collection> <<indexed field=value prefix>>",
 	Short: "Read audit data from immudb key-value collection.",
+	Long: `Reads entries of key-value collection, all of them or the ones with indexed field value matching given prefix.
+
+With --verify, each index entry found by scan and each entry it points to are checked with immudb proofs against locally stored trusted state. The scan itself cannot be proven, so entries omitted from its result are not detected.`,
 	Example: `immudb-log-audit read kv samplecollection
 immudb-log-audit read kv samplecollection indexed_field1=prefix1
-immudb-log-audit read kv samplecollection indexed_field2=prefix2`,
+immudb-log-audit read kv samplecollection indexed_field2=prefix2
+immudb-log-audit read kv samplecollection --verify`,
 	RunE: readKV,
 	Args: cobra.MinimumNArgs(1),
 }
 
 func init() {
 	readCmd.AddCommand(readKVCmd)
+	readKVCmd.Flags().Bool("verify", false, "verify each returned entry with immudb proofs against locally stored trusted state, completeness of the result is not verified")
 }
 
 func readKV(cmd *cobra.Command, args []string) error {
@@ -60,6 +65,20 @@ func readKV(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	verify, _ := cmd.Flags().GetBool("verify")
+	if verify {
+		entries, err := jr.VerifiedRead(key, prefix)
+		if err != nil {
+			return fmt.Errorf("could not verify, %w", err)
+		}
+
+		for _, e := range entries {
+			fmt.Printf("{\"tx_id\": %d, \"revision\": %d, \"verified\": true, \"entry\": %s}\n", e.TxID, e.Revision, string(e.Entry))
+		}
+
+		return nil
+	}
+
 	jsons, err := jr.Read(key, prefix)
 	if err != nil {
 		return fmt.Errorf("could not read, %w", err)
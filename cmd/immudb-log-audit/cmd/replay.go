@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/spf13/cobra"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <collection>",
+	Short: "Parse dead-lettered lines again and store them in collection",
+	Long: `Reads lines stored by tail with --dead-letter-file or --dead-letter-collection, parses them with collection parser, or the one given by --parser, and stores parsed entries in the collection.
+Dead letter file is rotated while replaying, lines which still cannot be parsed are written back to it with updated error. Dead letter collection is immutable, so uids of its replayed entries are recorded in --replayed-file and they are skipped by following runs.`,
+	Example: `immudb-log-audit replay pgaudit --dead-letter-file pgaudit-dead.ndjson
+immudb-log-audit replay pgaudit --dead-letter-collection pgauditdead --parser pgauditcsvlog`,
+	RunE: replay,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().String("dead-letter-file", "", "NDJSON file with dead-lettered lines")
+	replayCmd.Flags().String("dead-letter-collection", "", "Collection with dead-lettered lines")
+	replayCmd.Flags().String("parser", "", "Line parser used instead of the one configured for collection")
+	replayCmd.Flags().String("replayed-file", "", "NDJSON file with uids of replayed dead letter collection entries. Default is <dead letter collection>-replayed.ndjson in current directory")
+}
+
+func replay(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	flagDeadLetterFile, _ := cmd.Flags().GetString("dead-letter-file")
+	flagDeadLetterCollection, _ := cmd.Flags().GetString("dead-letter-collection")
+	flagReplayParser, _ := cmd.Flags().GetString("parser")
+
+	if (flagDeadLetterFile == "") == (flagDeadLetterCollection == "") {
+		return errors.New("exactly one of dead letter file and collection needs to be set")
+	}
+
+	typ, parser, err := immudb.NewConfigs(immuCli).ReadTypeParser(args[0])
+	if err != nil {
+		return fmt.Errorf("collection does not exist, please create one first, %w", err)
+	}
+
+	if flagReplayParser != "" {
+		parser = flagReplayParser
+	}
+
+	lp, err := newLineParser(parser, args[0])
+	if err != nil {
+		return fmt.Errorf("invalid line parser, %w", err)
+	}
+
+	jsonRepository, err := newJsonRepository(typ, args[0])
+	if err != nil {
+		return fmt.Errorf("collection configuration is corrupted, %w", err)
+	}
+
+	s := service.NewAuditService(nil, lp, jsonRepository)
+
+	var summary *cmdutils.ReplaySummary
+	if flagDeadLetterFile != "" {
+		summary, err = cmdutils.ReplayDeadLetterFile(flagDeadLetterFile, s, parser)
+	} else {
+		summary, err = replayDeadLetterCollection(cmd, flagDeadLetterCollection, s)
+	}
+
+	if summary != nil {
+		fmt.Println(summary.String())
+	}
+
+	return err
+}
+
+func replayDeadLetterCollection(cmd *cobra.Command, deadLetterCollection string, s *service.AuditService) (*cmdutils.ReplaySummary, error) {
+	typ, _, err := immudb.NewConfigs(immuCli).ReadTypeParser(deadLetterCollection)
+	if err != nil {
+		return nil, fmt.Errorf("dead letter collection does not exist, %w", err)
+	}
+
+	stored, err := readCollection(deadLetterCollection, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	flagReplayedFile, _ := cmd.Flags().GetString("replayed-file")
+	if flagReplayedFile == "" {
+		flagReplayedFile = deadLetterCollection + "-replayed.ndjson"
+	}
+
+	return cmdutils.ReplayDeadLetterCollection(stored, flagReplayedFile, s)
+}
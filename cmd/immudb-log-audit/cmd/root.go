@@ -61,6 +61,7 @@ func init() {
 	rootCmd.PersistentFlags().String("immudb-database", "defaultdb", "immudb database")
 	rootCmd.PersistentFlags().String("immudb-user", "immudb", "immudb user")
 	rootCmd.PersistentFlags().String("immudb-password", "immudb", "immudb user password")
+	rootCmd.PersistentFlags().String("immudb-state-dir", ".", "directory where immudb trusted state is stored for verified reads")
 	rootCmd.PersistentFlags().String("log-level", "info", "Log level (trace, debug, info, warn, error)")
 }
 
@@ -83,7 +84,9 @@ func root(cmd *cobra.Command, args []string) error {
 	immudbUser, _ := cmd.Flags().GetString("immudb-user")
 	immudbPassword, _ := cmd.Flags().GetString("immudb-password")
 
-	opts := client.DefaultOptions().WithAddress(immudbHost).WithPort(immudbPort)
+	immudbStateDir, _ := cmd.Flags().GetString("immudb-state-dir")
+
+	opts := client.DefaultOptions().WithAddress(immudbHost).WithPort(immudbPort).WithDir(immudbStateDir)
 	immuCli = client.NewClient().WithOptions(opts)
 
 	err = immuCli.OpenSession(context.TODO(), []byte(immudbUser), []byte(immudbPassword), immudbDb)
@@ -23,7 +23,6 @@ import (
 	"os/signal"
 	"syscall"
 
-	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
 	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
 	"github.com/codenotary/immudb-log-audit/pkg/service"
 	"github.com/codenotary/immudb-log-audit/pkg/source"
@@ -53,7 +52,7 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("collection does not exist, please create one first, %w", err)
 	}
 
-	lp, err := cmdutils.NewLineParser(parser)
+	lp, err := newLineParser(parser, args[0])
 	if err != nil {
 		return fmt.Errorf("collection configuration is corrupted, %w", err)
 	}
@@ -66,6 +65,8 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 	flagSince, _ := cmd.Flags().GetString("since")
 	flagStdout, _ := cmd.Flags().GetBool("stdout")
 	flagStderr, _ := cmd.Flags().GetBool("stderr")
+	flagDockerRegistryEnabled, _ := cmd.Flags().GetBool("docker-registry-enabled")
+	flagDockerRegistryDir, _ := cmd.Flags().GetString("docker-registry-dir")
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -75,13 +76,28 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
-	dockerTail, err := source.NewDockerTail(ctx, args[1], flagFollow, flagSince, flagStdout, flagStderr)
+	jsonRepository, closeSpool, err := withSpool(ctx, jsonRepository, args[0])
+	if err != nil {
+		return err
+	}
+
+	dockerTail, err := source.NewDockerTail(ctx, args[1], flagFollow, flagSince, flagStdout, flagStderr, flagDockerRegistryEnabled, flagDockerRegistryDir)
 	if err != nil {
 		return fmt.Errorf("invalide source: %w", err)
 	}
 
-	s := service.NewAuditService(dockerTail, lp, jsonRepository)
+	lineProvider, err := withMultiline(cmd, dockerTail, parser)
+	if err != nil {
+		return err
+	}
+
+	s, err := withDeadLetter(service.NewAuditService(lineProvider, lp, jsonRepository), parser, args[1])
+	if err != nil {
+		return err
+	}
+
 	err = s.Run()
+	closeSpool()
 	signal.Stop(signals)
 	close(signals)
 	return err
@@ -89,7 +105,10 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 
 func init() {
 	tailCmd.AddCommand(tailDockerCmd)
+	addMultilineFlags(tailDockerCmd)
 	tailDockerCmd.Flags().String("since", "", "since argument")
 	tailDockerCmd.Flags().Bool("stdout", false, "If true, read stdout from container")
 	tailDockerCmd.Flags().Bool("stderr", false, "If true, read stderr from container")
+	tailDockerCmd.Flags().Bool("docker-registry-enabled", true, "Enable tracking of stored container logs, reading resumes after last stored line when since is not set")
+	tailDockerCmd.Flags().String("docker-registry-dir", "", "Directory where registry of stored container logs should be stored, default is current directory")
 }
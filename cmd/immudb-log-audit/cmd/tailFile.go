@@ -23,7 +23,6 @@ import (
 	"os/signal"
 	"syscall"
 
-	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
 	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
 	"github.com/codenotary/immudb-log-audit/pkg/service"
 	"github.com/codenotary/immudb-log-audit/pkg/source"
@@ -55,7 +54,7 @@ func tailFile(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("collection does not exist, please create one first, %w", err)
 	}
 
-	lp, err := cmdutils.NewLineParser(parser)
+	lp, err := newLineParser(parser, args[0])
 	if err != nil {
 		return fmt.Errorf("collection configuration is corrupted, %w", err)
 	}
@@ -74,14 +73,28 @@ func tailFile(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
+	jsonRepository, closeSpool, err := withSpool(ctx, jsonRepository, args[0])
+	if err != nil {
+		return err
+	}
+
 	fileTail, err := source.NewFileTail(ctx, args[1], flagFollow, flagRegistryEnabled, flagRegistryDBDir)
 	if err != nil {
 		return fmt.Errorf("invalid source: %w", err)
 	}
 
-	s := service.NewAuditService(fileTail, lp, jsonRepository)
+	lineProvider, err := withMultiline(cmd, fileTail, parser)
+	if err != nil {
+		return err
+	}
+
+	s, err := withDeadLetter(service.NewAuditService(lineProvider, lp, jsonRepository), parser, args[1])
+	if err != nil {
+		return err
+	}
 
 	err = s.Run()
+	closeSpool()
 	signal.Stop(signals)
 	close(signals)
 	return err
@@ -89,6 +102,7 @@ func tailFile(cmd *cobra.Command, args []string) error {
 
 func init() {
 	tailCmd.AddCommand(tailFileCmd)
+	addMultilineFlags(tailFileCmd)
 	tailFileCmd.Flags().BoolVar(&flagRegistryEnabled, "file-registry-enabled", true, "Enable monitoring of read files")
 	tailFileCmd.Flags().StringVar(&flagRegistryDBDir, "file-registry-dir", "", "Directory where registry of monitored files should be stored, default is current directory")
 }
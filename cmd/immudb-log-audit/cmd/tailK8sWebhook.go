@@ -0,0 +1,110 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/codenotary/immudb-log-audit/pkg/source"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var tailK8sWebhookCmd = &cobra.Command{
+	Use:   "k8s-webhook <collection> <listen address>",
+	Short: "Serve kubernetes audit webhook backend and store audit events in immudb collection. Collection needs to be created first.",
+	Example: `immudb-log-audit tail k8s-webhook k8scollection 0.0.0.0:8443 --tls-cert server.crt --tls-key server.key
+immudb-log-audit tail k8s-webhook k8scollection 127.0.0.1:8080`,
+	RunE: tailK8sWebhook,
+	Args: cobra.ExactArgs(2),
+}
+
+func tailK8sWebhook(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("args", args).Info("Kubernetes audit webhook")
+
+	typ, parser, err := immudb.NewConfigs(immuCli).ReadTypeParser(args[0])
+	if err != nil {
+		return fmt.Errorf("collection does not exist, please create one first, %w", err)
+	}
+
+	lp, err := newLineParser(parser, args[0])
+	if err != nil {
+		return fmt.Errorf("collection configuration is corrupted, %w", err)
+	}
+
+	jsonRepository, err := newJsonRepository(typ, args[0])
+	if err != nil {
+		return fmt.Errorf("collection configuration is corrupted, %w", err)
+	}
+
+	flagTLSCert, _ := cmd.Flags().GetString("tls-cert")
+	flagTLSKey, _ := cmd.Flags().GetString("tls-key")
+	flagTLSClientCA, _ := cmd.Flags().GetString("tls-client-ca")
+
+	tlsConfig, err := cmdutils.NewServerTLSConfig(flagTLSCert, flagTLSKey, flagTLSClientCA)
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration, %w", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	jsonRepository, closeSpool, err := withSpool(ctx, jsonRepository, args[0])
+	if err != nil {
+		return err
+	}
+
+	s, err := withDeadLetter(service.NewAuditService(nil, lp, jsonRepository), parser, args[1])
+	if err != nil {
+		return err
+	}
+
+	k8sWebhook, err := source.NewK8sWebhook(args[1], tlsConfig, s)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+
+	err = k8sWebhook.Run(ctx)
+	closeSpool()
+	signal.Stop(signals)
+	close(signals)
+	return err
+}
+
+func init() {
+	tailCmd.AddCommand(tailK8sWebhookCmd)
+	tailK8sWebhookCmd.Flags().String("tls-cert", "", "TLS certificate file, enables HTTPS")
+	tailK8sWebhookCmd.Flags().String("tls-key", "", "TLS private key file")
+	tailK8sWebhookCmd.Flags().String("tls-client-ca", "", "If set, api server needs to present client certificate signed by given CA")
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/codenotary/immudb-log-audit/pkg/source"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var tailSyslogCmd = &cobra.Command{
+	Use:   "syslog <collection> <listen address>",
+	Short: "Receive syslog messages over UDP, TCP or TLS and store audit data in immudb collection. Collection needs to be created first.",
+	Example: `immudb-log-audit tail syslog syslogcollection :5514
+immudb-log-audit tail syslog syslogcollection 0.0.0.0:6514 --protocol tcp --tls-cert server.crt --tls-key server.key`,
+	RunE: tailSyslog,
+	Args: cobra.ExactArgs(2),
+}
+
+func tailSyslog(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("args", args).Info("Syslog tail")
+
+	typ, parser, err := immudb.NewConfigs(immuCli).ReadTypeParser(args[0])
+	if err != nil {
+		return fmt.Errorf("collection does not exist, please create one first, %w", err)
+	}
+
+	lp, err := newLineParser(parser, args[0])
+	if err != nil {
+		return fmt.Errorf("collection configuration is corrupted, %w", err)
+	}
+
+	jsonRepository, err := newJsonRepository(typ, args[0])
+	if err != nil {
+		return fmt.Errorf("collection configuration is corrupted, %w", err)
+	}
+
+	flagProtocol, _ := cmd.Flags().GetString("protocol")
+	flagFraming, _ := cmd.Flags().GetString("framing")
+	flagTLSCert, _ := cmd.Flags().GetString("tls-cert")
+	flagTLSKey, _ := cmd.Flags().GetString("tls-key")
+	flagTLSClientCA, _ := cmd.Flags().GetString("tls-client-ca")
+
+	tlsConfig, err := cmdutils.NewServerTLSConfig(flagTLSCert, flagTLSKey, flagTLSClientCA)
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration, %w", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	jsonRepository, closeSpool, err := withSpool(ctx, jsonRepository, args[0])
+	if err != nil {
+		return err
+	}
+
+	syslogTail, err := source.NewSyslogTail(ctx, flagProtocol, args[1], flagFraming, tlsConfig)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+
+	s, err := withDeadLetter(service.NewAuditService(syslogTail, lp, jsonRepository), parser, args[1])
+	if err != nil {
+		return err
+	}
+
+	err = s.Run()
+	closeSpool()
+	signal.Stop(signals)
+	close(signals)
+	return err
+}
+
+func init() {
+	tailCmd.AddCommand(tailSyslogCmd)
+	tailSyslogCmd.Flags().String("protocol", "udp", "Syslog transport protocol, udp or tcp")
+	tailSyslogCmd.Flags().String("framing", source.SyslogFramingAuto, "Framing of tcp syslog stream, auto, octet-counting or non-transparent")
+	tailSyslogCmd.Flags().String("tls-cert", "", "TLS certificate file, enables TLS for tcp protocol")
+	tailSyslogCmd.Flags().String("tls-key", "", "TLS private key file")
+	tailSyslogCmd.Flags().String("tls-client-ca", "", "If set, clients need to present certificate signed by given CA")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/reconcile"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/immudb"
+	"github.com/spf13/cobra"
+)
+
+var verifySourceCmd = &cobra.Command{
+	Use:   "source <collection> <file>",
+	Short: "Verify that every line of source files is stored in immudb collection",
+	Long: `Reads source files again, parses each line with collection parser and checks that matching entry is stored in the collection.
+Multi-line records are assembled the same way as by tail, so multiline flags need to match the ones used for tail.
+Reports invalid lines, missing, mismatched and extra entries with file line numbers. With deterministic uids (--uid-mode content or fields when creating collection)
+entries are matched by uid, otherwise by content without fields set at ingestion time. Extra entries are expected when collection stores also other sources.`,
+	Example: `immudb-log-audit verify source pgaudit /var/log/postgresql/postgresql.json
+immudb-log-audit verify source syslogcollection "/var/log/syslog*"`,
+	RunE: verifySource,
+	Args: cobra.ExactArgs(2),
+}
+
+func init() {
+	verifyCmd.AddCommand(verifySourceCmd)
+	verifySourceCmd.Flags().StringSlice("ignore-fields", reconcile.DefaultIgnoreFields, "Fields set at ingestion time, which are not compared")
+	addMultilineFlags(verifySourceCmd)
+}
+
+func verifySource(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	typ, parser, err := immudb.NewConfigs(immuCli).ReadTypeParser(args[0])
+	if err != nil {
+		return fmt.Errorf("collection does not exist, %w", err)
+	}
+
+	opts, err := readParserOptions(args[0])
+	if err != nil {
+		return err
+	}
+
+	lp, err := newLineParser(parser, args[0])
+	if err != nil {
+		return fmt.Errorf("collection configuration is corrupted, %w", err)
+	}
+
+	stored, err := readCollection(args[0], typ)
+	if err != nil {
+		return err
+	}
+
+	flagIgnoreFields, _ := cmd.Flags().GetStringSlice("ignore-fields")
+	report, err := reconcile.Source(args[1], lp, stored, reconcile.Options{
+		ByUID:        opts.UIDMode != "" && opts.UIDMode != lineparser.UIDModeRandom,
+		IgnoreFields: flagIgnoreFields,
+		Multiline:    multilineOptions(cmd, parser),
+	})
+	if err != nil {
+		return fmt.Errorf("could not verify source, %w", err)
+	}
+
+	report.Print(os.Stdout)
+	if !report.OK() {
+		return errors.New("source verification failed")
+	}
+
+	return nil
+}
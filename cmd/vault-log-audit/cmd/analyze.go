@@ -0,0 +1,43 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze audit data stored in immudb vault",
+	RunE:  analyze,
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+}
+
+func analyze(cmd *cobra.Command, args []string) error {
+	if cmd.CalledAs() == "analyze" {
+		return cmd.Help()
+	}
+
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
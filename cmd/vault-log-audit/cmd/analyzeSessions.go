@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/codenotary/immudb-log-audit/pkg/reconcile"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var analyzeSessionsCmd = &cobra.Command{
+	Use:   "sessions [collection]",
+	Short: "Reconstruct pgaudit sessions and report gaps, duplicates and out of order entries",
+	Long: `Groups pgaudit entries by session_id and orders them by statement_id and substatement_id, which pgaudit assigns sequentially per session.
+Missing ids are reported as gaps, which means audit records were dropped or suppressed, or not logged because of pgaudit.log settings.
+Ids missing before the first stored statement of a session are reported too, unless session_start shows the session started before the first stored entry.
+Requires session_id, available with pgauditjsonlog and pgauditcsvlog parsers, or pgaudit parser with %c in --log-line-prefix. Command fails when any problem is found.`,
+	Example: `vault-log-audit analyze sessions
+vault-log-audit analyze sessions pgaudit --session 645ffc74.8a --timeline`,
+	RunE: analyzeSessions,
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeSessionsCmd)
+	analyzeSessionsCmd.Flags().String("session", "", "Analyze only given session_id")
+	analyzeSessionsCmd.Flags().Bool("timeline", false, "Print entries of each session in log order")
+}
+
+func analyzeSessions(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	collection := "default"
+	if len(args) == 1 {
+		collection = args[0]
+	} else {
+		log.Info("Using default collection")
+	}
+
+	jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
+	if err != nil {
+		return fmt.Errorf("could not initialize vault, %w", err)
+	}
+
+	stored, err := jsonRepository.Read("")
+	if err != nil {
+		return fmt.Errorf("could not read vault, %w", err)
+	}
+
+	flagSession, _ := cmd.Flags().GetString("session")
+	flagTimeline, _ := cmd.Flags().GetBool("timeline")
+
+	report, err := reconcile.Sessions(stored, flagSession)
+	if err != nil {
+		return fmt.Errorf("could not analyze sessions, %w", err)
+	}
+
+	if flagTimeline {
+		report.PrintTimeline(os.Stdout)
+	}
+
+	report.Print(os.Stdout)
+	if !report.OK() {
+		return errors.New("session analysis found problems")
+	}
+
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
 	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -59,146 +60,14 @@ func create(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("invalid indexes configuration, %w", err)
 		}
-	} else if flagParser == "pgaudit" {
-		statementIDType := vaultclient.INTEGER
-		subStatementIDType := vaultclient.INTEGER
-		timestampType := vaultclient.STRING
-		auditTypeType := vaultclient.STRING
-		classType := vaultclient.STRING
-		commandType := vaultclient.STRING
-		createRequest = &vaultclient.CollectionCreateRequest{
-			Fields: &[]vaultclient.Field{
-				{
-					Name: "statement_id",
-					Type: &statementIDType,
-				},
-				{
-					Name: "substatement_id",
-					Type: &subStatementIDType,
-				},
-				{
-					Name: "timestamp",
-					Type: &timestampType,
-				},
-				{
-					Name: "audit_type",
-					Type: &auditTypeType,
-				},
-				{
-					Name: "class",
-					Type: &classType,
-				},
-				{
-					Name: "command",
-					Type: &commandType,
-				},
-			},
-			Indexes: &[]vaultclient.Index{
-				{
-					Fields: []string{"statement_id"},
-				},
-				{
-					Fields: []string{"substatement_id"},
-				},
-				{
-					Fields: []string{"audit_type"},
-				},
-				{
-					Fields: []string{"class"},
-				},
-				{
-					Fields: []string{"command"},
-				},
-			},
-		}
-	} else if flagParser == "pgauditjsonlog" {
-		dbNameType := vaultclient.STRING
-		userType := vaultclient.STRING
-		statementIDType := vaultclient.INTEGER
-		subStatementIDType := vaultclient.INTEGER
-		timestampType := vaultclient.STRING
-		auditTypeType := vaultclient.STRING
-		classType := vaultclient.STRING
-		commandType := vaultclient.STRING
-		createRequest = &vaultclient.CollectionCreateRequest{
-			Fields: &[]vaultclient.Field{
-				{
-					Name: "user",
-					Type: &userType,
-				},
-				{
-					Name: "dbname",
-					Type: &dbNameType,
-				},
-				{
-					Name: "statement_id",
-					Type: &statementIDType,
-				},
-				{
-					Name: "substatement_id",
-					Type: &subStatementIDType,
-				},
-				{
-					Name: "timestamp",
-					Type: &timestampType,
-				},
-				{
-					Name: "audit_type",
-					Type: &auditTypeType,
-				},
-				{
-					Name: "class",
-					Type: &classType,
-				},
-				{
-					Name: "command",
-					Type: &commandType,
-				},
-			},
-			Indexes: &[]vaultclient.Index{
-				{
-					Fields: []string{"dbname"},
-				},
-				{
-					Fields: []string{"statement_id"},
-				},
-				{
-					Fields: []string{"substatement_id"},
-				},
-				{
-					Fields: []string{"audit_type"},
-				},
-				{
-					Fields: []string{"class"},
-				},
-				{
-					Fields: []string{"command"},
-				},
-			},
-		}
-	} else if flagParser == "wrap" {
-		uidType := vaultclient.STRING
-		timestampType := vaultclient.STRING
-		createRequest = &vaultclient.CollectionCreateRequest{
-			Fields: &[]vaultclient.Field{
-				{
-					Name: "uid",
-					Type: &uidType,
-				},
-				{
-					Name: "log_timestamp",
-					Type: &timestampType,
-				},
-			},
-			Indexes: &[]vaultclient.Index{
-				{
-					Fields: []string{"uid"},
-				},
-				{
-					Fields: []string{"log_timestamp"},
-				},
-			},
+	} else if flagParser != "" {
+		schema, err := cmdutils.ParserSchema(flagParser, flagParserOptions)
+		if err != nil {
+			return err
 		}
+
+		createRequest = cmdutils.VaultCollectionCreateRequest(schema)
+		log.WithField("indexes", cmdutils.KVIndexes(schema)).Infof("Using default indexes for %s parser", flagParser)
 	}
 
 	err = vault.SetupJsonObjectRepository(vaultClient, ledger, collection, createRequest)
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Continuously check that the ledger is an append-only extension of locally trusted state",
+	Long: `Periodically reads current ledger state and checks it is consistent with trusted state stored in --vault-state-dir.
+Vault provides only document proofs, so consistency of a ledger which moved forward is proven only with --write-witness: a small witness document is then written to --witness-collection and both states are proven against it.
+Without --write-witness nothing is written, monitor checks only that the ledger did not go back behind trusted state or change its hash. With --server-signing-pub-key, current state needs to be signed by the server.
+On inconsistency an alert is logged, sent to --alert-webhook if set, and the command exits with error.`,
+	Example: `vault-log-audit monitor --server-signing-pub-key server.pub
+vault-log-audit monitor --write-witness --interval 5m --alert-webhook https://alerts.example.com/hook`,
+	RunE: monitor,
+}
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+	monitorCmd.Flags().Duration("interval", time.Minute, "How often ledger state is checked")
+	monitorCmd.Flags().Bool("write-witness", false, "Write witness document whenever the ledger moved forward, to prove it is consistent with trusted state")
+	monitorCmd.Flags().String("witness-collection", "monitor", "Collection for witness documents with --write-witness, created if it does not exist")
+	monitorCmd.Flags().String("alert-webhook", "", "If set, alert is POSTed as json to given URL")
+}
+
+func monitor(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	flagInterval, _ := cmd.Flags().GetDuration("interval")
+	flagWriteWitness, _ := cmd.Flags().GetBool("write-witness")
+	flagWitnessCollection, _ := cmd.Flags().GetString("witness-collection")
+	flagAlertWebhook, _ := cmd.Flags().GetString("alert-webhook")
+
+	if flagWriteWitness {
+		err = vault.SetupJsonObjectRepository(vaultClient, ledger, flagWitnessCollection, nil)
+		if err != nil {
+			return fmt.Errorf("could not setup witness collection, %w", err)
+		}
+	}
+
+	jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, flagWitnessCollection, flagBatchMode)
+	if err != nil {
+		return fmt.Errorf("could not initialize vault, %w", err)
+	}
+
+	err = withServerSigningPubKey(jsonRepository)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(flagInterval)
+	defer ticker.Stop()
+
+	log.WithField("ledger", ledger).WithField("interval", flagInterval).Info("Monitoring ledger consistency")
+	for {
+		result, err := jsonRepository.CheckConsistency(flagStateDir, flagWriteWitness)
+		if errors.Is(err, vault.ErrNotConsistent) {
+			log.WithError(err).WithField("ledger", ledger).Error("ALERT: ledger consistency check failed")
+			if flagAlertWebhook != "" {
+				alertErr := sendAlert(flagAlertWebhook, err)
+				if alertErr != nil {
+					log.WithError(alertErr).Error("Could not send alert")
+				}
+			}
+			return err
+		} else if err != nil {
+			log.WithError(err).Warn("Could not check ledger consistency, will retry")
+		} else if !result.Proven {
+			log.WithField("txID", result.Current.TxId).WithField("trustedTxID", result.Trusted.TxId).Info("Ledger moved forward, consistency is not proven without --write-witness")
+		} else {
+			log.WithField("txID", result.Trusted.TxId).Info("Ledger consistent with trusted state")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func sendAlert(url string, alertErr error) error {
+	alert, err := json.Marshal(map[string]string{
+		"ledger":    ledger,
+		"error":     alertErr.Error(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(url, "application/json", bytes.NewReader(alert))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	"github.com/spf13/cobra"
+)
+
+var parserTestCmd = &cobra.Command{
+	Use:   "test [file]",
+	Short: "Parse lines from file or stdin and print resulting json or parse errors",
+	Long: `Runs each line through the line parser selected with --parser, without storing it, and prints resulting json or parse error with summary counts.
+With --collection, parsed entries are validated against collection fields. vault connection is needed only with --collection.
+Command fails when any line could not be parsed or does not match collection schema.`,
+	Example: `vault-log-audit parser test --parser pgaudit postgresql.log
+tail -n 100 postgresql.log | vault-log-audit parser test --parser pgaudit --log-line-prefix '%m [%p] %q%u@%d '
+vault-log-audit parser test --parser pgaudit --collection pgaudit postgresql.log`,
+	RunE: parserTest,
+	Args: cobra.MaximumNArgs(1),
+}
+
+func init() {
+	parserCmd.AddCommand(parserTestCmd)
+	parserTestCmd.Flags().String("collection", "", "If set, parsed entries are validated against collection fields")
+}
+
+func parserTest(cmd *cobra.Command, args []string) error {
+	flagCollection, _ := cmd.Flags().GetString("collection")
+
+	err := loadParserDefinition()
+	if err != nil {
+		return err
+	}
+
+	var validator cmdutils.EntryValidator
+	if flagCollection != "" {
+		err = runParentCmdE(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, flagCollection, flagBatchMode)
+		if err != nil {
+			return fmt.Errorf("could not initialize vault, %w", err)
+		}
+
+		validator, err = jsonRepository.NewCollectionValidator()
+		if err != nil {
+			return err
+		}
+	}
+
+	lp, err := cmdutils.NewLineParser(flagParser, flagParserOptions)
+	if err != nil {
+		return fmt.Errorf("invalid line parser, %w", err)
+	}
+
+	var r io.Reader = os.Stdin
+	source := "stdin"
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("could not open file, %w", err)
+		}
+		defer f.Close()
+
+		r, source = f, args[0]
+	}
+
+	summary, err := cmdutils.RunParserTest(r, source, lp, cmdutils.ParserMultiline(flagParser), validator, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if !summary.OK() {
+		return errors.New("some lines could not be parsed or do not match collection schema")
+	}
+
+	return nil
+}
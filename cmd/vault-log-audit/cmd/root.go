@@ -27,6 +27,9 @@ import (
 
 	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
 	"github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	"github.com/codenotary/immudb/pkg/signer"
 	"github.com/deepmap/oapi-codegen/pkg/securityprovider"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -42,7 +45,11 @@ var (
 var vaultClient vaultclient.ClientWithResponsesInterface
 var ledger string
 var flagParser string
+var flagParserOptions lineparser.Options
+var flagParserDefinition string
 var flagBatchMode bool
+var flagStateDir string
+var flagServerSigningPubKey string
 
 func version() string {
 	return fmt.Sprintf("%s, commit: %s, build time: %s",
@@ -71,8 +78,15 @@ func init() {
 	rootCmd.PersistentFlags().String("vault-address", "https://vault.immudb.io/", "vault address, can be set with VAULT_ADDRESS env var")
 	rootCmd.PersistentFlags().String("vault-api-key", "", "Vault api key, can be set with VAULT_API_KEY env var")
 	rootCmd.PersistentFlags().StringVar(&ledger, "ledger", "default", "Ledger to be used")
-	rootCmd.PersistentFlags().StringVar(&flagParser, "parser", "", "Line parser to be used. When not specified, lines will be considered as jsons. Also available 'pgaudit', 'pgauditjsonlog', 'wrap'. For those, indexes are predefined.")
+	rootCmd.PersistentFlags().StringVar(&flagParser, "parser", "", "Line parser to be used. When not specified, lines will be considered as jsons. Also available "+cmd.ParserNames()+", see 'parser list'. For those, indexes are predefined.")
+	rootCmd.PersistentFlags().StringVar(&flagParserDefinition, "parser-definition", "", "YAML or JSON file with custom parser definition, pattern, field types and indexes")
+	rootCmd.PersistentFlags().StringVar(&flagParserOptions.UIDMode, "uid-mode", lineparser.UIDModeRandom, "How entry uid is generated, 'random', 'content' - derived from source position and line content, 'fields' - derived from --uid-fields. With deterministic uids, re-ingested lines can be detected as duplicates.")
+	rootCmd.PersistentFlags().StringSliceVar(&flagParserOptions.UIDFields, "uid-fields", nil, "Parsed entry fields used to derive uid with --uid-mode fields, e.g. session_id,statement_id,substatement_id")
+	rootCmd.PersistentFlags().StringVar(&flagParserOptions.LogLinePrefix, "log-line-prefix", "", "postgres log_line_prefix used by pgaudit parser, escapes like %u, %d, %c or %r are stored as named fields. Default '%m [%p] '")
+	rootCmd.PersistentFlags().StringVar(&flagParserOptions.LogFormat, "log-format", "", "nginx log_format used by nginx parser, variables like $remote_addr, $request or $status are stored as typed fields, other variables as strings. Default nginx combined format")
 	rootCmd.PersistentFlags().BoolVar(&flagBatchMode, "batch-mode", true, "")
+	rootCmd.PersistentFlags().StringVar(&flagStateDir, "vault-state-dir", ".", "directory where trusted ledger state is stored for proof verification")
+	rootCmd.PersistentFlags().StringVar(&flagServerSigningPubKey, "server-signing-pub-key", "", "If set, ledger states verified by verify and monitor need to be signed with given PEM encoded ECDSA public key of the server")
 	rootCmd.PersistentFlags().String("log-level", "info", "Log level (trace, debug, info, warn, error)")
 }
 
@@ -89,6 +103,11 @@ func root(cmd *cobra.Command, args []string) error {
 
 	log.SetLevel(logLevel)
 
+	err = loadParserDefinition()
+	if err != nil {
+		return err
+	}
+
 	vaultAddress := viper.GetString("vault-address")
 	if vaultAddress == "" {
 		vaultAddress = "https://vault.immudb.io/"
@@ -122,6 +141,25 @@ func Execute() {
 	}
 }
 
+// loadParserDefinition reads custom parser definition into parser options
+func loadParserDefinition() error {
+	if flagParserDefinition == "" || flagParserOptions.Definition != nil {
+		return nil
+	}
+
+	if flagParser != "custom" {
+		return errors.New("parser definition can be used only with custom parser")
+	}
+
+	d, err := lineparser.ReadDefinition(flagParserDefinition)
+	if err != nil {
+		return err
+	}
+
+	flagParserOptions.Definition = d
+	return nil
+}
+
 func runParentCmdE(cmd *cobra.Command, args []string) error {
 	if cmd.Parent() != nil && cmd.Parent().RunE != nil {
 		err := cmd.Parent().RunE(cmd.Parent(), args)
@@ -132,3 +170,19 @@ func runParentCmdE(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// withServerSigningPubKey makes repository accept only ledger states signed with
+// --server-signing-pub-key, when it is set
+func withServerSigningPubKey(jsonRepository *vault.JsonVaultRepository) error {
+	if flagServerSigningPubKey == "" {
+		return nil
+	}
+
+	key, err := signer.ParsePublicKeyFile(flagServerSigningPubKey)
+	if err != nil {
+		return fmt.Errorf("invalid server signing public key, %w", err)
+	}
+
+	jsonRepository.SetServerSigningPubKey(key)
+	return nil
+}
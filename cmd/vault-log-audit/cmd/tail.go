@@ -16,9 +16,31 @@ limitations under the License.
 
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
 
-var flagFollow bool
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/file"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/codenotary/immudb-log-audit/pkg/spool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagFollow               bool
+	flagSpoolDir             string
+	flagSpoolMaxSize         int64
+	flagSpoolSegmentSize     int64
+	flagSpoolFullPolicy      string
+	flagSpoolDrainTimeout    time.Duration
+	flagDeadLetterFile       string
+	flagDeadLetterCollection string
+)
 
 var tailCmd = &cobra.Command{
 	Use:   "tail",
@@ -29,6 +51,13 @@ var tailCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(tailCmd)
 	tailCmd.PersistentFlags().BoolVar(&flagFollow, "follow", false, "If True, follow data stream. The follower supports file rotation.")
+	tailCmd.PersistentFlags().StringVar(&flagSpoolDir, "spool-dir", "", "If set, parsed entries are spooled on disk in given directory and forwarded when backend is available")
+	tailCmd.PersistentFlags().Int64Var(&flagSpoolMaxSize, "spool-max-size", 1024, "Max size of spooled entries waiting to be forwarded, in MB")
+	tailCmd.PersistentFlags().Int64Var(&flagSpoolSegmentSize, "spool-segment-size", 16, "Size of spool segment files, in MB")
+	tailCmd.PersistentFlags().StringVar(&flagSpoolFullPolicy, "spool-full-policy", spool.FullPolicyBlock, "What to do when spool is full, block - wait for entries to be forwarded, fail - stop with error")
+	tailCmd.PersistentFlags().DurationVar(&flagSpoolDrainTimeout, "spool-drain-timeout", 30*time.Second, "How long to wait on exit for spooled entries to be forwarded, the rest is replayed on next start")
+	tailCmd.PersistentFlags().StringVar(&flagDeadLetterFile, "dead-letter-file", "", "If set, lines which could not be parsed are appended to given NDJSON file with source, position and parser error")
+	tailCmd.PersistentFlags().StringVar(&flagDeadLetterCollection, "dead-letter-collection", "", "If set, lines which could not be parsed are stored in given collection with source, position and parser error")
 }
 
 func tail(cmd *cobra.Command, args []string) error {
@@ -43,3 +72,115 @@ func tail(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// withSpool puts disk spool in front of json repository if spool directory is set. Writes
+// waiting for space in full spool are interrupted when context is done. Returned function
+// waits for spooled entries to be forwarded for at most spool drain timeout.
+func withSpool(ctx context.Context, jsonRepository service.JsonRepository, collection string) (service.JsonRepository, func(), error) {
+	if flagSpoolDir == "" {
+		return jsonRepository, func() {}, nil
+	}
+
+	opts := spool.DefaultOptions()
+	opts.MaxSize = flagSpoolMaxSize << 20
+	opts.MaxSegmentSize = flagSpoolSegmentSize << 20
+	opts.FullPolicy = flagSpoolFullPolicy
+
+	s, err := spool.NewSpool(filepath.Join(flagSpoolDir, collection), jsonRepository, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not initialize spool, %w", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Interrupt()
+		case <-closed:
+		}
+	}()
+
+	return s, func() {
+		close(closed)
+		drainCtx, cancel := context.WithTimeout(context.Background(), flagSpoolDrainTimeout)
+		defer cancel()
+		s.Close(drainCtx)
+	}, nil
+}
+
+func addMultilineFlags(cmd *cobra.Command) {
+	cmd.Flags().String("multiline-start", "", "If set, lines are assembled into records, record starts with a line matching given regex and following lines which do not match are appended to it. Parsers of multi-line formats, like pgauditcsvlog, assemble records by default")
+	cmd.Flags().String("multiline-continue", "", "If set, lines matching given regex are appended to the previous line")
+	cmd.Flags().Int("multiline-max-lines", 0, "Max number of lines of assembled record, 500 if not set and assembly is enabled")
+	cmd.Flags().Duration("multiline-timeout", 0, "Assembled record is flushed when no line is appended for given duration, 1s if not set and assembly is enabled")
+}
+
+// withMultiline assembles multi-line records of line provider, see multilineOptions
+func withMultiline(cmd *cobra.Command, lineProvider service.LineProvider, parser string) (service.LineProvider, error) {
+	opts := multilineOptions(cmd, parser)
+	if !opts.Enabled() {
+		return lineProvider, nil
+	}
+
+	return service.NewMultilineLineProvider(lineProvider, opts)
+}
+
+// multilineOptions returns assembly of multi-line records as the parser defines, start or
+// continue pattern flags replace parser patterns, max lines and timeout flags override its limits
+func multilineOptions(cmd *cobra.Command, parser string) service.MultilineOptions {
+	opts := cmdutils.ParserMultiline(parser)
+	if cmd.Flags().Changed("multiline-start") || cmd.Flags().Changed("multiline-continue") {
+		opts = service.MultilineOptions{MaxLines: opts.MaxLines, Timeout: opts.Timeout}
+		opts.Start, _ = cmd.Flags().GetString("multiline-start")
+		opts.Continue, _ = cmd.Flags().GetString("multiline-continue")
+	}
+
+	if cmd.Flags().Changed("multiline-max-lines") {
+		opts.MaxLines, _ = cmd.Flags().GetInt("multiline-max-lines")
+	}
+
+	if cmd.Flags().Changed("multiline-timeout") {
+		opts.Timeout, _ = cmd.Flags().GetDuration("multiline-timeout")
+	}
+
+	return opts
+}
+
+// newDeadLetterRepository returns repository of lines which could not be parsed, nil when none is set
+func newDeadLetterRepository(deadLetterFile string, deadLetterCollection string) (service.JsonRepository, error) {
+	if deadLetterFile != "" && deadLetterCollection != "" {
+		return nil, errors.New("only one of dead letter file and collection can be set")
+	}
+
+	if deadLetterFile != "" {
+		jf, err := file.NewJsonFileRepository(deadLetterFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize dead letter file, %w", err)
+		}
+		return jf, nil
+	}
+
+	if deadLetterCollection != "" {
+		vaultRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, deadLetterCollection, flagBatchMode)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize dead letter collection, %w", err)
+		}
+		return vaultRepository, nil
+	}
+
+	return nil, nil
+}
+
+// withDeadLetter stores lines which could not be parsed in dead letter repository if it is set
+func withDeadLetter(s *service.AuditService, source string) (*service.AuditService, error) {
+	deadLetter, err := newDeadLetterRepository(flagDeadLetterFile, flagDeadLetterCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadLetter == nil {
+		return s, nil
+	}
+
+	return s.WithDeadLetter(deadLetter, source, flagParser), nil
+}
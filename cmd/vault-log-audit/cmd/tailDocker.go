@@ -48,7 +48,7 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 
 	log.WithField("args", args).Info("Docker tail")
 
-	lp, err := cmdutils.NewLineParser(flagParser)
+	lp, err := cmdutils.NewLineParser(flagParser, flagParserOptions)
 	if err != nil {
 		return fmt.Errorf("invalid line parser, %w", err)
 	}
@@ -63,7 +63,7 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 		container = args[0]
 	}
 
-	jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
+	vaultRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
 	if err != nil {
 		return fmt.Errorf("could not initialize vault, %w", err)
 	}
@@ -71,6 +71,8 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 	flagSince, _ := cmd.Flags().GetString("since")
 	flagStdout, _ := cmd.Flags().GetBool("stdout")
 	flagStderr, _ := cmd.Flags().GetBool("stderr")
+	flagDockerRegistryEnabled, _ := cmd.Flags().GetBool("docker-registry-enabled")
+	flagDockerRegistryDir, _ := cmd.Flags().GetString("docker-registry-dir")
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -80,13 +82,28 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
-	dockerTail, err := source.NewDockerTail(ctx, container, flagFollow, flagSince, flagStdout, flagStderr)
+	jsonRepository, closeSpool, err := withSpool(ctx, vaultRepository, collection)
+	if err != nil {
+		return err
+	}
+
+	dockerTail, err := source.NewDockerTail(ctx, container, flagFollow, flagSince, flagStdout, flagStderr, flagDockerRegistryEnabled, flagDockerRegistryDir)
 	if err != nil {
 		return fmt.Errorf("invalide source: %w", err)
 	}
 
-	s := service.NewAuditService(dockerTail, lp, jsonRepository)
+	lineProvider, err := withMultiline(cmd, dockerTail, flagParser)
+	if err != nil {
+		return err
+	}
+
+	s, err := withDeadLetter(service.NewAuditService(lineProvider, lp, jsonRepository), container)
+	if err != nil {
+		return err
+	}
+
 	err = s.Run()
+	closeSpool()
 	signal.Stop(signals)
 	close(signals)
 	return err
@@ -94,7 +111,10 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 
 func init() {
 	tailCmd.AddCommand(tailDockerCmd)
+	addMultilineFlags(tailDockerCmd)
 	tailDockerCmd.Flags().String("since", "", "since argument")
 	tailDockerCmd.Flags().Bool("stdout", false, "If true, read stdout from container")
 	tailDockerCmd.Flags().Bool("stderr", false, "If true, read stderr from container")
+	tailDockerCmd.Flags().Bool("docker-registry-enabled", true, "Enable tracking of stored container logs, reading resumes after last stored line when since is not set")
+	tailDockerCmd.Flags().String("docker-registry-dir", "", "Directory where registry of stored container logs should be stored, default is current directory")
 }
@@ -51,7 +51,7 @@ func tailFile(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	lp, err := cmdutils.NewLineParser(flagParser)
+	lp, err := cmdutils.NewLineParser(flagParser, flagParserOptions)
 	if err != nil {
 		return fmt.Errorf("invalid line parser, %w", err)
 	}
@@ -67,7 +67,7 @@ func tailFile(cmd *cobra.Command, args []string) error {
 		file = args[0]
 	}
 
-	jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
+	vaultRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
 	if err != nil {
 		return fmt.Errorf("could not initialize vault, %w", err)
 	}
@@ -81,14 +81,28 @@ func tailFile(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
+	jsonRepository, closeSpool, err := withSpool(ctx, vaultRepository, collection)
+	if err != nil {
+		return err
+	}
+
 	fileTail, err := source.NewFileTail(ctx, file, flagFollow, flagRegistryEnabled, flagRegistryDBDir)
 	if err != nil {
 		return fmt.Errorf("invalid source: %w", err)
 	}
 
-	s := service.NewAuditService(fileTail, lp, jsonRepository)
+	lineProvider, err := withMultiline(cmd, fileTail, flagParser)
+	if err != nil {
+		return err
+	}
+
+	s, err := withDeadLetter(service.NewAuditService(lineProvider, lp, jsonRepository), file)
+	if err != nil {
+		return err
+	}
 
 	err = s.Run()
+	closeSpool()
 	signal.Stop(signals)
 	close(signals)
 	return err
@@ -96,6 +110,7 @@ func tailFile(cmd *cobra.Command, args []string) error {
 
 func init() {
 	tailCmd.AddCommand(tailFileCmd)
+	addMultilineFlags(tailFileCmd)
 	tailFileCmd.Flags().BoolVar(&flagRegistryEnabled, "file-registry-enabled", true, "Enable monitoring of read files")
 	tailFileCmd.Flags().StringVar(&flagRegistryDBDir, "file-registry-dir", "", "Directory where registry of monitored files should be stored, default is current directory")
 }
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [collection] <documentID>",
+	Short: "Verify data stored in immudb vault",
+	Long: `Verify document proof locally. Inclusion and dual proofs returned by vault are checked against
+trusted state stored in --vault-state-dir, and the document from the proof is compared with the one returned by read.
+With --server-signing-pub-key, the proven state also needs to be signed by the server.`,
+	Example: "vault-log-audit verify default 648a32500000000000000bc0b922a7c9",
+	RunE:    verify,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func verify(cmd *cobra.Command, args []string) error {
+	if cmd.CalledAs() == "verify" && len(args) == 0 {
+		return cmd.Help()
+	}
+
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if cmd.CalledAs() != "verify" {
+		return nil
+	}
+
+	collection := "default"
+	var documentID string
+	if len(args) == 2 {
+		collection = args[0]
+		documentID = args[1]
+	} else if len(args) == 1 {
+		log.Info("Using default collection")
+		documentID = args[0]
+	} else {
+		return fmt.Errorf("expected [collection] <documentID>, got %d arguments", len(args))
+	}
+
+	jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
+	if err != nil {
+		return fmt.Errorf("could not initialize vault, %w", err)
+	}
+
+	err = withServerSigningPubKey(jsonRepository)
+	if err != nil {
+		return err
+	}
+
+	verified, err := jsonRepository.VerifyDocument(documentID, flagStateDir)
+	if err != nil {
+		return fmt.Errorf("could not verify, %w", err)
+	}
+
+	fmt.Printf("{\"transaction_id\": %d, \"revision\": %q, \"verified\": true, \"state_transaction_id\": %d, \"document\": %s}\n",
+		verified.TransactionID, verified.Revision, verified.State.TxId, string(verified.Document))
+
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	cmdutils "github.com/codenotary/immudb-log-audit/pkg/cmd"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/reconcile"
+	"github.com/codenotary/immudb-log-audit/pkg/repository/vault"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var verifySourceCmd = &cobra.Command{
+	Use:   "source <collection> <file>",
+	Short: "Verify that every line of source files is stored in immudb vault collection",
+	Long: `Reads source files again, parses each line with given parser and checks that matching entry is stored in the collection.
+Multi-line records are assembled the same way as by tail, so multiline flags need to match the ones used for tail.
+Reports invalid lines, missing, mismatched and extra entries with file line numbers. With deterministic uids (--uid-mode content or fields, the same as used for tail)
+entries are matched by uid, otherwise by content without fields set at ingestion time. Extra entries are expected when collection stores also other sources.`,
+	Example: `vault-log-audit verify source /var/log/postgresql/postgresql.json --parser pgauditjsonlog
+vault-log-audit verify source syslogcollection "/var/log/syslog*" --parser syslog --uid-mode content`,
+	RunE: verifySource,
+	Args: cobra.MinimumNArgs(1),
+}
+
+func init() {
+	verifyCmd.AddCommand(verifySourceCmd)
+	verifySourceCmd.Flags().StringSlice("ignore-fields", reconcile.DefaultIgnoreFields, "Fields set at ingestion time, which are not compared")
+	addMultilineFlags(verifySourceCmd)
+}
+
+func verifySource(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	lp, err := cmdutils.NewLineParser(flagParser, flagParserOptions)
+	if err != nil {
+		return fmt.Errorf("invalid line parser, %w", err)
+	}
+
+	collection := "default"
+	var file string
+	if len(args) == 2 {
+		collection = args[0]
+		file = args[1]
+	} else {
+		log.Info("Using default collection")
+		file = args[0]
+	}
+
+	jsonRepository, err := vault.NewJsonVaultRepository(vaultClient, ledger, collection, flagBatchMode)
+	if err != nil {
+		return fmt.Errorf("could not initialize vault, %w", err)
+	}
+
+	stored, err := jsonRepository.Read("")
+	if err != nil {
+		return fmt.Errorf("could not read vault, %w", err)
+	}
+
+	flagIgnoreFields, _ := cmd.Flags().GetStringSlice("ignore-fields")
+	report, err := reconcile.Source(file, lp, stored, reconcile.Options{
+		ByUID:        flagParserOptions.UIDMode != "" && flagParserOptions.UIDMode != lineparser.UIDModeRandom,
+		IgnoreFields: flagIgnoreFields,
+		Multiline:    multilineOptions(cmd, flagParser),
+	})
+	if err != nil {
+		return fmt.Errorf("could not verify source, %w", err)
+	}
+
+	report.Print(os.Stdout)
+	if !report.OK() {
+		return errors.New("source verification failed")
+	}
+
+	return nil
+}
@@ -2,25 +2,61 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
 	"github.com/codenotary/immudb-log-audit/pkg/service"
 )
 
-func NewLineParser(name string) (service.LineParser, error) {
-	var lp service.LineParser
-	switch name {
-	case "":
-		lp = lineparser.NewDefaultLineParser()
-	case "pgaudit":
-		lp = lineparser.NewPGAuditLineParser()
-	case "pgauditjsonlog":
-		lp = lineparser.NewPGAuditJSONLogLineParser()
-	case "wrap":
-		lp = lineparser.NewWrapLineParser()
-	default:
-		return nil, fmt.Errorf("not supported parser: %s", name)
+func NewLineParser(name string, opts lineparser.Options) (service.LineParser, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser options, %w", err)
 	}
 
-	return lp, nil
+	if name == "" {
+		return lineparser.NewDefaultLineParser(), nil
+	}
+
+	p, err := lineparser.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.New(opts)
+}
+
+// ParserMultiline returns default assembly of multi-line records of registered parser
+func ParserMultiline(name string) service.MultilineOptions {
+	p, err := lineparser.Lookup(name)
+	if err != nil {
+		return service.MultilineOptions{}
+	}
+
+	return p.Multiline
+}
+
+// ParserNames returns quoted names of registered parsers, to be listed in flag usage
+func ParserNames() string {
+	names := []string{}
+	for _, p := range lineparser.Parsers() {
+		names = append(names, fmt.Sprintf("'%s'", p.Name))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// ParserSchema returns output schema of registered parser with given options
+func ParserSchema(name string, opts lineparser.Options) (lineparser.Schema, error) {
+	p, err := lineparser.Lookup(name)
+	if err != nil {
+		return lineparser.Schema{}, err
+	}
+
+	s, err := p.Schema(opts)
+	if err != nil {
+		return lineparser.Schema{}, fmt.Errorf("could not get %s parser schema, %w", name, err)
+	}
+
+	return s, nil
 }
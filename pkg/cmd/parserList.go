@@ -0,0 +1,51 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+)
+
+// PrintParsers writes registered parsers with their output fields and default indexes for given options
+func PrintParsers(w io.Writer, opts lineparser.Options) {
+	for _, p := range lineparser.Parsers() {
+		fmt.Fprintf(w, "%s: %s\n", p.Name, p.Description)
+
+		s, err := p.Schema(opts)
+		if err != nil {
+			fmt.Fprintf(w, "  schema: %s\n", err.Error())
+			continue
+		}
+
+		indexes := []string{}
+		for _, f := range s.Indexed() {
+			indexes = append(indexes, f.Name)
+		}
+
+		fields := []string{}
+		for _, f := range s.Fields {
+			fields = append(fields, fmt.Sprintf("%s %s", f.Name, f.Type))
+		}
+
+		fmt.Fprintf(w, "  indexes: %s\n", strings.Join(indexes, ", "))
+		fmt.Fprintf(w, "  fields: %s\n", strings.Join(fields, ", "))
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+// maximum length of tested line
+const parserTestMaxLineSize = 1024 * 1024
+
+// EntryValidator checks parsed entry against collection schema and returns found problems
+type EntryValidator interface {
+	Validate(entry []byte) []string
+}
+
+type ParserTestSummary struct {
+	Lines   int
+	Parsed  int
+	Skipped int
+	Invalid int
+	// Problems is number of parsed entries which do not match collection schema
+	Problems int
+}
+
+func (s *ParserTestSummary) OK() bool {
+	return s.Invalid == 0 && s.Problems == 0
+}
+
+// linePosition is line number within tested source, so parsers deriving uids from position
+// behave the same way as with file sources
+type linePosition struct {
+	source string
+	line   int
+}
+
+func (p linePosition) String() string {
+	return fmt.Sprintf("%s:%d", p.source, p.line)
+}
+
+// readerLineProvider delivers lines of tested source, acknowledged positions are ignored
+type readerLineProvider struct {
+	lC    chan service.Line
+	lines int
+	err   error
+}
+
+func newReaderLineProvider(r io.Reader, source string) *readerLineProvider {
+	rp := &readerLineProvider{
+		lC: make(chan service.Line),
+	}
+
+	go func() {
+		defer close(rp.lC)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), parserTestMaxLineSize)
+		for scanner.Scan() {
+			rp.lines++
+			rp.lC <- service.Line{Text: scanner.Text(), Position: linePosition{source: source, line: rp.lines}}
+		}
+
+		if err := scanner.Err(); err != nil {
+			rp.err = fmt.Errorf("could not read %s, %w", source, err)
+		}
+	}()
+
+	return rp
+}
+
+func (rp *readerLineProvider) ReadLine() chan service.Line {
+	return rp.lC
+}
+
+func (rp *readerLineProvider) Ack(positions []service.Position) {}
+
+func (rp *readerLineProvider) SaveState() {}
+
+// RunParserTest parses each line read from r and prints resulting json, or parse error, to w.
+// Multi-line records are assembled first when multiline is enabled, they are printed with
+// number of their last line. When validator is given, parsed entries are validated against
+// collection schema. Entries held by parser, e.g. k8s audit events without final stage, are
+// printed at the end, labeled "end".
+func RunParserTest(r io.Reader, source string, lp service.LineParser, multiline service.MultilineOptions, validator EntryValidator, w io.Writer) (*ParserTestSummary, error) {
+	pp, withPosition := lp.(service.PositionLineParser)
+	summary := &ParserTestSummary{}
+
+	report := func(label string, b []byte) {
+		summary.Parsed++
+		fmt.Fprintf(w, "%s: %s\n", label, string(b))
+
+		if validator == nil {
+			return
+		}
+
+		problems := validator.Validate(b)
+		if len(problems) > 0 {
+			summary.Problems++
+		}
+
+		for _, p := range problems {
+			fmt.Fprintf(w, "%s: schema: %s\n", label, p)
+		}
+	}
+
+	rp := newReaderLineProvider(r, source)
+	var lineProvider service.LineProvider = rp
+	if multiline.Enabled() {
+		var err error
+		lineProvider, err = service.NewMultilineLineProvider(rp, multiline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for l := range lineProvider.ReadLine() {
+		n := service.LastPosition(l.Position).(linePosition).line
+
+		var b []byte
+		var err error
+		if withPosition {
+			b, err = pp.ParseAt(l.Text, l.Position)
+		} else {
+			b, err = lp.Parse(l.Text)
+		}
+
+		if errors.Is(err, service.ErrHoldLine) {
+			fmt.Fprintf(w, "%d: held to be merged with following lines\n", n)
+			continue
+		} else if errors.Is(err, service.ErrSkipLine) {
+			summary.Skipped++
+			fmt.Fprintf(w, "%d: skipped, %s\n", n, err.Error())
+			continue
+		} else if err != nil {
+			summary.Invalid++
+			fmt.Fprintf(w, "%d: error: %s\n", n, err.Error())
+			continue
+		}
+
+		report(fmt.Sprint(n), b)
+	}
+
+	if rp.err != nil {
+		return nil, rp.err
+	}
+
+	if fp, ok := lp.(service.FlushLineParser); ok {
+		held, err := fp.Flush(true)
+		if err != nil {
+			return nil, fmt.Errorf("could not flush line parser, %w", err)
+		}
+
+		for _, e := range held {
+			report("end", e.Entry)
+		}
+	}
+
+	summary.Lines = rp.lines
+	fmt.Fprintf(w, "lines: %d, parsed: %d, skipped: %d, invalid: %d, not matching schema: %d\n",
+		summary.Lines, summary.Parsed, summary.Skipped, summary.Invalid, summary.Problems)
+
+	return summary, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type testValidator struct{}
+
+func (testValidator) Validate(entry []byte) []string {
+	if !gjson.GetBytes(entry, "session_id").Exists() {
+		return []string{"missing field session_id"}
+	}
+	return nil
+}
+
+func TestRunParserTest(t *testing.T) {
+	lines := strings.Join([]string{
+		`2023-02-03 21:15:01.759 GMT [294] LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,select 1,<not logged>`,
+		`2023-02-03 21:15:01.760 GMT [294] LOG:  database system is ready to accept connections`,
+		`not a log line`,
+	}, "\n")
+
+	lp, err := NewLineParser("pgaudit", lineparser.Options{UIDMode: lineparser.UIDModeContent})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	summary, err := RunParserTest(strings.NewReader(lines), "postgresql.log", lp, service.MultilineOptions{}, testValidator{}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, &ParserTestSummary{Lines: 3, Parsed: 1, Skipped: 1, Invalid: 1, Problems: 1}, summary)
+	assert.False(t, summary.OK())
+
+	printed := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, printed, 5)
+	assert.True(t, strings.HasPrefix(printed[0], `1: {"audit_type":"SESSION"`))
+	assert.Equal(t, "1: schema: missing field session_id", printed[1])
+	assert.True(t, strings.HasPrefix(printed[2], "2: skipped"))
+	assert.True(t, strings.HasPrefix(printed[3], "3: error: "))
+	assert.Equal(t, "lines: 3, parsed: 1, skipped: 1, invalid: 1, not matching schema: 1", printed[4])
+
+	// uid derived from position is the same on each run
+	var again bytes.Buffer
+	_, err = RunParserTest(strings.NewReader(lines), "postgresql.log", lp, service.MultilineOptions{}, nil, &again)
+	require.NoError(t, err)
+	assert.Equal(t, gjson.Get(strings.TrimPrefix(printed[0], "1: "), "uid").String(),
+		gjson.Get(strings.TrimPrefix(strings.Split(again.String(), "\n")[0], "1: "), "uid").String())
+}
+
+func TestRunParserTestMultiline(t *testing.T) {
+	lines := strings.Join([]string{
+		`2023-05-13 21:09:09.100 GMT,"postgres","app",138,"172.22.0.1:58300",645ffc74.8a,2,"SELECT",2023-05-13 21:09:08 GMT,3/45,0,LOG,00000,"AUDIT: SESSION,2,1,READ,SELECT,,,""select *`,
+		`  from t`,
+		`  where id = 1"",<not logged>",,,,,,,,,"psql","client backend",,0`,
+		`2023-05-13 21:09:10.000 GMT,,,100,,645ffc70.64,1,,2023-05-13 21:09:00 GMT,,0,LOG,00000,"database system is ready to accept connections",,,,,,,,,""`,
+	}, "\n")
+
+	lp, err := NewLineParser("pgauditcsvlog", lineparser.Options{})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	summary, err := RunParserTest(strings.NewReader(lines), "postgresql.csv", lp, ParserMultiline("pgauditcsvlog"), nil, &out)
+	require.NoError(t, err)
+	assert.Equal(t, &ParserTestSummary{Lines: 4, Parsed: 1, Skipped: 1}, summary)
+
+	printed := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, printed, 3)
+	assert.True(t, strings.HasPrefix(printed[0], "3: {"))
+	assert.Equal(t, "select *\n  from t\n  where id = 1", gjson.Get(strings.TrimPrefix(printed[0], "3: "), "statement").String())
+	assert.True(t, strings.HasPrefix(printed[1], "4: skipped"))
+}
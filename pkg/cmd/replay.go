@@ -0,0 +1,180 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/codenotary/immudb-log-audit/pkg/repository/file"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+// ReplaySummary counts dead-lettered lines handled by replay
+type ReplaySummary struct {
+	DeadLettered int
+	Replayed     int
+	Failed       int
+	// ReplayedBefore is number of dead letter collection entries replayed by previous runs
+	ReplayedBefore int
+}
+
+func (s *ReplaySummary) String() string {
+	return fmt.Sprintf("dead-lettered lines: %d, replayed: %d, still failing: %d, replayed before: %d",
+		s.DeadLettered, s.Replayed, s.Failed, s.ReplayedBefore)
+}
+
+// replayedMark records uid of replayed dead letter collection entry
+type replayedMark struct {
+	UID string `json:"uid"`
+}
+
+// ReplayDeadLetterFile replays lines of dead letter file. The file is rotated first, so lines
+// dead-lettered meanwhile by running tail are kept. Lines which still cannot be parsed, with
+// updated error and parser, and lines not replayed because storing failed are appended back.
+func ReplayDeadLetterFile(path string, s *service.AuditService, parser string) (*ReplaySummary, error) {
+	jf, err := file.NewJsonFileRepository(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize dead letter file, %w", err)
+	}
+
+	rotated, err := jf.Rotate(".replaying")
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := rotated.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := readDeadLetterEntries(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	result, replayErr := s.Replay(entries)
+
+	remaining := make([][]byte, 0, len(result.Failed)+len(stored)-result.Handled)
+	for _, e := range result.Failed {
+		e.Parser = parser
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal dead letter entry, %w", err)
+		}
+		remaining = append(remaining, b)
+	}
+	remaining = append(remaining, stored[result.Handled:]...)
+
+	if len(remaining) > 0 {
+		_, err = jf.WriteBytes(remaining)
+		if err != nil {
+			return nil, fmt.Errorf("could not write dead letter file, %w", err)
+		}
+	}
+
+	err = rotated.Remove()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplaySummary{
+		DeadLettered: len(entries),
+		Replayed:     len(result.Replayed),
+		Failed:       len(result.Failed),
+	}, replayErr
+}
+
+// ReplayDeadLetterCollection replays entries read from dead letter collection. The collection
+// cannot be modified, so uids of replayed entries are recorded in replayedFile and the entries
+// are skipped by following runs.
+func ReplayDeadLetterCollection(stored [][]byte, replayedFile string, s *service.AuditService) (*ReplaySummary, error) {
+	rf, err := file.NewJsonFileRepository(replayedFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize replayed file, %w", err)
+	}
+
+	marks, err := rf.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := map[string]struct{}{}
+	for _, b := range marks {
+		var m replayedMark
+		err := json.Unmarshal(b, &m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replayed file entry %s, %w", string(b), err)
+		}
+		replayed[m.UID] = struct{}{}
+	}
+
+	entries, err := readDeadLetterEntries(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]service.DeadLetterEntry, 0, len(entries))
+	for _, e := range entries {
+		if _, ok := replayed[e.UID]; !ok {
+			pending = append(pending, e)
+		}
+	}
+
+	result, replayErr := s.Replay(pending)
+
+	marks = make([][]byte, 0, len(result.Replayed))
+	for _, e := range result.Replayed {
+		if e.UID == "" {
+			continue
+		}
+
+		b, err := json.Marshal(replayedMark{UID: e.UID})
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal replayed mark, %w", err)
+		}
+		marks = append(marks, b)
+	}
+
+	if len(marks) > 0 {
+		_, err = rf.WriteBytes(marks)
+		if err != nil {
+			return nil, fmt.Errorf("could not write replayed file, %w", err)
+		}
+	}
+
+	return &ReplaySummary{
+		DeadLettered:   len(entries),
+		Replayed:       len(result.Replayed),
+		Failed:         len(result.Failed),
+		ReplayedBefore: len(entries) - len(pending),
+	}, replayErr
+}
+
+func readDeadLetterEntries(stored [][]byte) ([]service.DeadLetterEntry, error) {
+	entries := make([]service.DeadLetterEntry, 0, len(stored))
+	for _, s := range stored {
+		var e service.DeadLetterEntry
+		err := json.Unmarshal(s, &e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dead letter entry %s, %w", string(s), err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb-log-audit/pkg/repository/file"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReplayParser fails lines starting with "invalid"
+type testReplayParser struct{}
+
+func (testReplayParser) Parse(line string) ([]byte, error) {
+	if strings.HasPrefix(line, "invalid") {
+		return nil, errors.New("still invalid")
+	}
+
+	return []byte(line), nil
+}
+
+type testReplayRepository struct {
+	stored []string
+	// writes fail after storing this number of entries, when set
+	limit int
+}
+
+func (r *testReplayRepository) WriteBytes(b [][]byte) (uint64, error) {
+	for i, e := range b {
+		if r.limit > 0 && len(r.stored) >= r.limit {
+			return 0, &service.PartialWriteError{Written: i, Err: errors.New("unavailable")}
+		}
+		r.stored = append(r.stored, string(e))
+	}
+
+	return 0, nil
+}
+
+func deadLetters(t *testing.T, lines ...string) [][]byte {
+	entries := [][]byte{}
+	for i, l := range lines {
+		b, err := json.Marshal(service.DeadLetterEntry{UID: string(rune('a' + i)), Line: l, Error: "invalid"})
+		require.NoError(t, err)
+		entries = append(entries, b)
+	}
+
+	return entries
+}
+
+func TestReplayDeadLetterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.ndjson")
+	jf, err := file.NewJsonFileRepository(path)
+	require.NoError(t, err)
+	_, err = jf.WriteBytes(deadLetters(t, "fixed 1", "invalid", "fixed 2", "fixed 3"))
+	require.NoError(t, err)
+
+	// storing fails after the first entry
+	repo := &testReplayRepository{limit: 1}
+	summary, err := ReplayDeadLetterFile(path, service.NewAuditService(nil, testReplayParser{}, repo), "test")
+	assert.Error(t, err)
+	assert.Equal(t, &ReplaySummary{DeadLettered: 4, Replayed: 1, Failed: 1}, summary)
+
+	stored, err := jf.Read()
+	require.NoError(t, err)
+	entries, err := readDeadLetterEntries(stored)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "still invalid", entries[0].Error)
+	assert.Equal(t, "test", entries[0].Parser)
+	assert.Equal(t, "fixed 2", entries[1].Line)
+	assert.Equal(t, "fixed 3", entries[2].Line)
+
+	repo.limit = 0
+	summary, err = ReplayDeadLetterFile(path, service.NewAuditService(nil, testReplayParser{}, repo), "test")
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaySummary{DeadLettered: 3, Replayed: 2, Failed: 1}, summary)
+	assert.Equal(t, []string{"fixed 1", "fixed 2", "fixed 3"}, repo.stored)
+
+	stored, err = jf.Read()
+	require.NoError(t, err)
+	assert.Len(t, stored, 1)
+}
+
+func TestReplayDeadLetterCollection(t *testing.T) {
+	replayedFile := filepath.Join(t.TempDir(), "dead-replayed.ndjson")
+	stored := deadLetters(t, "fixed 1", "invalid", "fixed 2")
+
+	repo := &testReplayRepository{}
+	summary, err := ReplayDeadLetterCollection(stored, replayedFile, service.NewAuditService(nil, testReplayParser{}, repo))
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaySummary{DeadLettered: 3, Replayed: 2, Failed: 1}, summary)
+
+	// replayed entries are not stored again
+	stored = append(stored, deadLetters(t, "", "", "", "fixed 3")[3])
+	summary, err = ReplayDeadLetterCollection(stored, replayedFile, service.NewAuditService(nil, testReplayParser{}, repo))
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaySummary{DeadLettered: 4, Replayed: 1, Failed: 1, ReplayedBefore: 2}, summary)
+	assert.Equal(t, []string{"fixed 1", "fixed 2", "fixed 3"}, repo.stored)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+)
+
+// default size of VARCHAR columns created for string fields
+const defaultVarcharSize = 256
+
+// KVIndexes returns key-value collection indexes of indexed schema fields, first field is primary key
+func KVIndexes(s lineparser.Schema) []string {
+	indexes := []string{}
+	for _, f := range s.Indexed() {
+		indexes = append(indexes, f.Name)
+	}
+
+	return indexes
+}
+
+// SQLColumns returns SQL collection column definitions of indexed schema fields and primary key,
+// which is the first field or sequential id
+func SQLColumns(s lineparser.Schema) ([]string, []string) {
+	columns := []string{}
+	indexed := s.Indexed()
+	primaryKey := []string{}
+	if s.SequentialID {
+		columns = append(columns, "id=INTEGER AUTO_INCREMENT")
+		primaryKey = append(primaryKey, "id")
+	} else if len(indexed) > 0 {
+		primaryKey = append(primaryKey, indexed[0].Name)
+	}
+
+	for _, f := range indexed {
+		var ctype string
+		switch f.Type {
+		case lineparser.FieldTypeInteger:
+			ctype = "INTEGER"
+		case lineparser.FieldTypeFloat:
+			ctype = "FLOAT"
+		case lineparser.FieldTypeBoolean:
+			ctype = "BOOLEAN"
+		case lineparser.FieldTypeTimestamp:
+			ctype = "TIMESTAMP"
+		default:
+			size := f.Size
+			if size == 0 {
+				size = defaultVarcharSize
+			}
+
+			ctype = fmt.Sprintf("VARCHAR[%d]", size)
+		}
+
+		columns = append(columns, fmt.Sprintf("%s=%s", f.Name, ctype))
+	}
+
+	return columns, primaryKey
+}
+
+// VaultCollectionCreateRequest returns vault collection with indexed schema fields
+func VaultCollectionCreateRequest(s lineparser.Schema) *vaultclient.CollectionCreateRequest {
+	fields := []vaultclient.Field{}
+	indexes := []vaultclient.Index{}
+	for _, f := range s.Indexed() {
+		var typ vaultclient.FieldType
+		switch f.Type {
+		case lineparser.FieldTypeInteger:
+			typ = vaultclient.INTEGER
+		case lineparser.FieldTypeFloat:
+			typ = vaultclient.DOUBLE
+		case lineparser.FieldTypeBoolean:
+			typ = vaultclient.BOOLEAN
+		default:
+			typ = vaultclient.STRING
+		}
+
+		fields = append(fields, vaultclient.Field{Name: f.Name, Type: &typ})
+		indexes = append(indexes, vaultclient.Index{Fields: []string{f.Name}})
+	}
+
+	return &vaultclient.CollectionCreateRequest{
+		Fields:  &fields,
+		Indexes: &indexes,
+	}
+}
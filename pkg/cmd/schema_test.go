@@ -0,0 +1,104 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaConversions(t *testing.T) {
+	s := lineparser.Schema{Fields: []lineparser.SchemaField{
+		{Name: "uid", Type: lineparser.FieldTypeString, Size: 36, Index: true},
+		{Name: "host", Type: lineparser.FieldTypeString, Index: true},
+		{Name: "port", Type: lineparser.FieldTypeInteger, Index: true},
+		{Name: "duration", Type: lineparser.FieldTypeFloat, Index: true},
+		{Name: "ok", Type: lineparser.FieldTypeBoolean, Index: true},
+		{Name: "timestamp", Type: lineparser.FieldTypeTimestamp, Index: true},
+		{Name: "message", Type: lineparser.FieldTypeString},
+	}}
+
+	assert.Equal(t, []string{"uid", "host", "port", "duration", "ok", "timestamp"}, KVIndexes(s))
+
+	columns, primaryKey := SQLColumns(s)
+	assert.Equal(t, []string{"uid=VARCHAR[36]", "host=VARCHAR[256]", "port=INTEGER", "duration=FLOAT", "ok=BOOLEAN", "timestamp=TIMESTAMP"}, columns)
+	assert.Equal(t, []string{"uid"}, primaryKey)
+
+	s.SequentialID = true
+	columns, primaryKey = SQLColumns(s)
+	assert.Equal(t, "id=INTEGER AUTO_INCREMENT", columns[0])
+	assert.Len(t, columns, 7)
+	assert.Equal(t, []string{"id"}, primaryKey)
+
+	r := VaultCollectionCreateRequest(s)
+	types := []vaultclient.FieldType{}
+	for _, f := range *r.Fields {
+		types = append(types, *f.Type)
+	}
+
+	assert.Equal(t, []vaultclient.FieldType{vaultclient.STRING, vaultclient.STRING, vaultclient.INTEGER, vaultclient.DOUBLE, vaultclient.BOOLEAN, vaultclient.STRING}, types)
+	assert.Len(t, *r.Indexes, 6)
+	assert.Equal(t, []string{"port"}, (*r.Indexes)[2].Fields)
+}
+
+func TestParserSchemas(t *testing.T) {
+	// wrap entries have log_timestamp, not timestamp
+	s, err := ParserSchema("wrap", lineparser.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"uid", "log_timestamp"}, KVIndexes(s))
+
+	// deterministic uids are used as primary key of pgaudit SQL collections
+	s, err = ParserSchema("pgaudit", lineparser.Options{})
+	require.NoError(t, err)
+	_, primaryKey := SQLColumns(s)
+	assert.Equal(t, []string{"id"}, primaryKey)
+
+	s, err = ParserSchema("pgaudit", lineparser.Options{UIDMode: lineparser.UIDModeContent, LogLinePrefix: "%m [%p] %q%u@%d "})
+	require.NoError(t, err)
+	columns, primaryKey := SQLColumns(s)
+	assert.Equal(t, []string{"uid"}, primaryKey)
+	assert.Contains(t, columns, "dbname=VARCHAR[256]")
+
+	_, err = ParserSchema("custom", lineparser.Options{})
+	assert.Error(t, err)
+
+	_, err = ParserSchema("unknown", lineparser.Options{})
+	assert.Error(t, err)
+
+	// every registered parser can be created and has uid as primary key
+	for _, p := range lineparser.Parsers() {
+		if p.Name == "custom" {
+			continue
+		}
+
+		_, err := NewLineParser(p.Name, lineparser.Options{})
+		assert.NoError(t, err, p.Name)
+
+		s, err := p.Schema(lineparser.Options{})
+		require.NoError(t, err, p.Name)
+		assert.Equal(t, "uid", KVIndexes(s)[0], p.Name)
+	}
+
+	var out bytes.Buffer
+	PrintParsers(&out, lineparser.Options{})
+	assert.Contains(t, out.String(), "wrap: any line wrapped into json with uid and timestamp\n  indexes: uid, log_timestamp\n")
+}
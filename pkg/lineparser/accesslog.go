@@ -0,0 +1,354 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+const (
+	// CommonLogFormat is NCSA common log format, e.g. Apache '%h %l %u %t "%r" %>s %b'
+	CommonLogFormat = `$remote_addr $ident $remote_user [$time_local] "$request" $status $body_bytes_sent`
+	// CombinedLogFormat is common log format with referer and user agent, also nginx default
+	CombinedLogFormat = CommonLogFormat + ` "$http_referer" "$http_user_agent"`
+	// DefaultNginxLogFormat is nginx predefined combined log_format
+	DefaultNginxLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+)
+
+func init() {
+	Register(Parser{
+		Name:        "clf",
+		Description: "HTTP access log in common log format",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewAccessLogLineParser(CommonLogFormat, opts)
+		},
+		Schema: accessLogSchema(CommonLogFormat),
+	})
+
+	Register(Parser{
+		Name:        "combined",
+		Description: "HTTP access log in combined log format, e.g. Apache or nginx default",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewAccessLogLineParser(CombinedLogFormat, opts)
+		},
+		Schema: accessLogSchema(CombinedLogFormat),
+	})
+
+	Register(Parser{
+		Name:        "nginx",
+		Description: "nginx access log, fields are set by variables of --log-format",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewAccessLogLineParser(opts.LogFormat, opts)
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return accessLogSchema(opts.LogFormat)(opts)
+		},
+	})
+}
+
+type accessLogVariable struct {
+	fields []SchemaField
+	// layout of timestamp variables, unix for seconds since epoch
+	layout string
+}
+
+// accessLogVariables are nginx variables stored as named typed fields, other variables are
+// stored as strings named the same as the variable
+var accessLogVariables = map[string]accessLogVariable{
+	"remote_addr":     {fields: []SchemaField{{Name: "remote_addr", Type: FieldTypeString, Size: 64, Index: true}}},
+	"remote_user":     {fields: []SchemaField{{Name: "user", Type: FieldTypeString, Index: true}}},
+	"time_local":      {fields: []SchemaField{{Name: "timestamp", Type: FieldTypeTimestamp, Index: true}}, layout: "02/Jan/2006:15:04:05 -0700"},
+	"time_iso8601":    {fields: []SchemaField{{Name: "timestamp", Type: FieldTypeTimestamp, Index: true}}, layout: time.RFC3339},
+	"msec":            {fields: []SchemaField{{Name: "timestamp", Type: FieldTypeTimestamp, Index: true}}, layout: "unix"},
+	"request":         {fields: []SchemaField{{Name: "method", Type: FieldTypeString, Size: 16, Index: true}, {Name: "path", Type: FieldTypeString}, {Name: "protocol", Type: FieldTypeString}, {Name: "request", Type: FieldTypeString}}},
+	"request_method":  {fields: []SchemaField{{Name: "method", Type: FieldTypeString, Size: 16, Index: true}}},
+	"request_uri":     {fields: []SchemaField{{Name: "path", Type: FieldTypeString}}},
+	"server_protocol": {fields: []SchemaField{{Name: "protocol", Type: FieldTypeString}}},
+	"status":          {fields: []SchemaField{{Name: "status", Type: FieldTypeInteger, Index: true}}},
+	"body_bytes_sent": {fields: []SchemaField{{Name: "bytes", Type: FieldTypeInteger}}},
+	"bytes_sent":      {fields: []SchemaField{{Name: "bytes_sent", Type: FieldTypeInteger}}},
+	"request_length":  {fields: []SchemaField{{Name: "request_length", Type: FieldTypeInteger}}},
+	"http_referer":    {fields: []SchemaField{{Name: "referer", Type: FieldTypeString}}},
+	"http_user_agent": {fields: []SchemaField{{Name: "user_agent", Type: FieldTypeString}}},
+	"request_time":    {fields: []SchemaField{{Name: "request_time", Type: FieldTypeFloat}}},
+}
+
+var accessLogVariableName = regexp.MustCompile(`^\$(?:\{([A-Za-z0-9_]+)\}|([A-Za-z0-9_]+))`)
+
+type accessLogFormat struct {
+	re *regexp.Regexp
+	// variable of each capture group
+	variables []string
+}
+
+// newAccessLogFormat compiles nginx log_format template. Variable values extend to the literal
+// character following the variable, which may appear in the value only escaped.
+func newAccessLogFormat(template string) (*accessLogFormat, error) {
+	if template == "" {
+		template = DefaultNginxLogFormat
+	}
+
+	f := &accessLogFormat{}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(template); {
+		if template[i] != '$' {
+			sb.WriteString(regexp.QuoteMeta(template[i : i+1]))
+			i++
+			continue
+		}
+
+		m := accessLogVariableName.FindStringSubmatch(template[i:])
+		if m == nil {
+			return nil, fmt.Errorf("invalid log format variable at position %d", i)
+		}
+
+		name := m[1] + m[2]
+		i += len(m[0])
+		switch {
+		case i == len(template):
+			sb.WriteString("(.*)")
+		case template[i] == '$':
+			sb.WriteString(`(\S*)`)
+		default:
+			sb.WriteString(`((?:[^` + regexp.QuoteMeta(template[i:i+1]) + `\\]|\\.)*)`)
+		}
+		f.variables = append(f.variables, name)
+	}
+	sb.WriteString("$")
+
+	if len(f.variables) == 0 {
+		return nil, errors.New("log format does not contain any variable")
+	}
+
+	var err error
+	f.re, err = regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not compile log format, %w", err)
+	}
+
+	return f, nil
+}
+
+// schemaFields returns fields set by variables of the format
+func (f *accessLogFormat) schemaFields() []SchemaField {
+	fields := []SchemaField{}
+	seen := map[string]bool{}
+	for _, name := range f.variables {
+		v, ok := accessLogVariables[name]
+		if !ok {
+			v.fields = []SchemaField{{Name: name, Type: FieldTypeString}}
+		}
+
+		for _, sf := range v.fields {
+			if !seen[sf.Name] {
+				seen[sf.Name] = true
+				fields = append(fields, sf)
+			}
+		}
+	}
+
+	return fields
+}
+
+func accessLogSchema(template string) func(opts Options) (Schema, error) {
+	return func(opts Options) (Schema, error) {
+		f, err := newAccessLogFormat(template)
+		if err != nil {
+			return Schema{}, fmt.Errorf("invalid log format, %w", err)
+		}
+
+		return Schema{
+			Fields: append([]SchemaField{
+				{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+				{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+			}, f.schemaFields()...),
+			SequentialID: !opts.deterministicUID(),
+		}, nil
+	}
+}
+
+type accessLogLineParser struct {
+	format       *accessLogFormat
+	uidGenerator *uidGenerator
+}
+
+// NewAccessLogLineParser creates parser of access log lines written with nginx log_format
+// template, by default nginx combined format
+func NewAccessLogLineParser(template string, opts Options) (*accessLogLineParser, error) {
+	f, err := newAccessLogFormat(template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log format, %w", err)
+	}
+
+	return &accessLogLineParser{
+		format:       f,
+		uidGenerator: newUIDGenerator(opts),
+	}, nil
+}
+
+func (p *accessLogLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *accessLogLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	m := p.format.re.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if m == nil {
+		return nil, errors.New("line does not match access log format")
+	}
+
+	entry := map[string]interface{}{}
+	for i, name := range p.format.variables {
+		// empty values are logged as -
+		value := m[i+1]
+		if value == "" || value == "-" {
+			continue
+		}
+
+		err := p.setField(entry, name, value)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s '%s', %w", name, value, err)
+		}
+	}
+
+	entry["server_timestamp"] = time.Now().UTC()
+	uid, err := p.uidGenerator.uid(line, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	entry["uid"] = uid
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal access log entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+func (p *accessLogLineParser) setField(entry map[string]interface{}, name string, value string) error {
+	v, ok := accessLogVariables[name]
+	if !ok {
+		entry[name] = accessLogUnescape(value)
+		return nil
+	}
+
+	if name == "request" {
+		request := accessLogUnescape(value)
+		parts := strings.Split(request, " ")
+		if len(parts) == 3 {
+			entry["method"], entry["path"], entry["protocol"] = parts[0], parts[1], parts[2]
+		} else {
+			// malformed requests are stored as is
+			entry["request"] = request
+		}
+		return nil
+	}
+
+	field := v.fields[0]
+	switch field.Type {
+	case FieldTypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		entry[field.Name] = n
+	case FieldTypeFloat:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		entry[field.Name] = n
+	case FieldTypeTimestamp:
+		ts, err := accessLogTimestamp(v.layout, value)
+		if err != nil {
+			return err
+		}
+		entry[field.Name] = ts
+	default:
+		entry[field.Name] = accessLogUnescape(value)
+	}
+
+	return nil
+}
+
+func accessLogTimestamp(layout string, value string) (time.Time, error) {
+	if layout != "unix" {
+		return time.Parse(layout, value)
+	}
+
+	sec, frac, _ := strings.Cut(value, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var ms int64
+	if frac != "" {
+		ms, err = strconv.ParseInt((frac + "000")[:3], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return time.Unix(s, ms*int64(time.Millisecond)).UTC(), nil
+}
+
+// accessLogUnescape decodes nginx \xHH and Apache \", \\, \n and \t escapes
+func accessLogUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		if s[i+1] == 'x' && i+3 < len(s) {
+			b, err := hex.DecodeString(s[i+2 : i+4])
+			if err == nil {
+				sb.Write(b)
+				i += 3
+				continue
+			}
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogParse(t *testing.T) {
+	type testData struct {
+		format    string
+		line      string
+		expected  map[string]interface{}
+		expectErr bool
+	}
+
+	tdd := []testData{
+		{
+			format: CommonLogFormat,
+			line:   `10.0.0.5 - frank [10/Oct/2023:13:55:36 -0700] "GET /admin/users?id=1 HTTP/1.1" 200 2326`,
+			expected: map[string]interface{}{
+				"remote_addr": "10.0.0.5", "user": "frank", "timestamp": "2023-10-10T13:55:36-07:00",
+				"method": "GET", "path": "/admin/users?id=1", "protocol": "HTTP/1.1", "status": float64(200), "bytes": float64(2326),
+			},
+		},
+		{
+			format: CombinedLogFormat,
+			line:   `10.0.0.5 - - [10/Oct/2023:13:55:36 +0000] "POST /login HTTP/1.1" 302 - "https://admin.example.com/" "Mozilla/5.0 \"quoted\" (X11)"`,
+			expected: map[string]interface{}{
+				"remote_addr": "10.0.0.5", "timestamp": "2023-10-10T13:55:36Z",
+				"method": "POST", "path": "/login", "protocol": "HTTP/1.1", "status": float64(302),
+				"referer": "https://admin.example.com/", "user_agent": `Mozilla/5.0 "quoted" (X11)`,
+			},
+		},
+		{
+			format: CombinedLogFormat,
+			line:   `10.0.0.6 - - [10/Oct/2023:13:55:37 +0000] "\x16\x03\x01" 400 157 "-" "-"`,
+			expected: map[string]interface{}{
+				"remote_addr": "10.0.0.6", "timestamp": "2023-10-10T13:55:37Z",
+				"request": "\x16\x03\x01", "status": float64(400), "bytes": float64(157),
+			},
+		},
+		{
+			format: "",
+			line:   `10.0.0.5 - admin [10/Oct/2023:13:55:36 +0000] "GET / HTTP/2.0" 200 612 "-" "curl/8.0"`,
+			expected: map[string]interface{}{
+				"remote_addr": "10.0.0.5", "user": "admin", "timestamp": "2023-10-10T13:55:36Z",
+				"method": "GET", "path": "/", "protocol": "HTTP/2.0", "status": float64(200), "bytes": float64(612), "user_agent": "curl/8.0",
+			},
+		},
+		{
+			format: `$remote_addr [$time_iso8601] "$request_method $request_uri" $status $request_time ${upstream_addr} "$http_x_forwarded_for"`,
+			line:   `10.0.0.5 [2023-10-10T13:55:36+02:00] "DELETE /api/v1/users/7" 204 0.013 127.0.0.1:8080 "203.0.113.7"`,
+			expected: map[string]interface{}{
+				"remote_addr": "10.0.0.5", "timestamp": "2023-10-10T13:55:36+02:00", "method": "DELETE", "path": "/api/v1/users/7",
+				"status": float64(204), "request_time": 0.013, "upstream_addr": "127.0.0.1:8080", "http_x_forwarded_for": "203.0.113.7",
+			},
+		},
+		{
+			format: `$msec $remote_addr $status`,
+			line:   `1696946136.123 10.0.0.5 200`,
+			expected: map[string]interface{}{
+				"timestamp": "2023-10-10T13:55:36.123Z", "remote_addr": "10.0.0.5", "status": float64(200),
+			},
+		},
+		{
+			format:    CommonLogFormat,
+			line:      `10.0.0.5 - frank [10/Oct/2023:13:55:36 -0700] "GET / HTTP/1.1" OK 2326`,
+			expectErr: true,
+		},
+		{
+			format:    CommonLogFormat,
+			line:      `10.0.0.5 - frank [yesterday] "GET / HTTP/1.1" 200 2326`,
+			expectErr: true,
+		},
+		{
+			format:    CombinedLogFormat,
+			line:      `some invalid line that cannot be parsed`,
+			expectErr: true,
+		},
+	}
+
+	for _, td := range tdd {
+		p, err := NewAccessLogLineParser(td.format, Options{})
+		require.NoError(t, err)
+
+		b, err := p.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err, td.line)
+			continue
+		}
+
+		require.NoError(t, err, td.line)
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.NotEmpty(t, entry["uid"])
+		assert.NotEmpty(t, entry["server_timestamp"])
+		delete(entry, "uid")
+		delete(entry, "server_timestamp")
+
+		expectedTS, err := time.Parse(time.RFC3339Nano, td.expected["timestamp"].(string))
+		require.NoError(t, err)
+		actualTS, err := time.Parse(time.RFC3339Nano, entry["timestamp"].(string))
+		require.NoError(t, err)
+		assert.True(t, expectedTS.Equal(actualTS), td.line)
+		delete(entry, "timestamp")
+		delete(td.expected, "timestamp")
+
+		assert.Equal(t, td.expected, entry, td.line)
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	_, err := newAccessLogFormat(`$remote_addr $`)
+	assert.Error(t, err)
+
+	_, err = newAccessLogFormat(`no variables`)
+	assert.Error(t, err)
+
+	s, err := accessLogSchema(`$remote_addr $remote_user "$request" $status $upstream_addr`)(Options{})
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, f := range s.Indexed() {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"uid", "server_timestamp", "remote_addr", "user", "method", "status"}, names)
+	assert.Equal(t, "upstream_addr", s.Fields[len(s.Fields)-1].Name)
+	assert.True(t, s.SequentialID)
+}
@@ -0,0 +1,441 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "auditd",
+		Description: "linux audit log, records of an event are assembled by event serial and correlated into single entry",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewAuditdLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return Schema{
+				Fields: []SchemaField{
+					{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+					{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+					{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+					{Name: "serial", Type: FieldTypeInteger},
+					{Name: "node", Type: FieldTypeString},
+					{Name: "type", Type: FieldTypeString, Size: 32, Index: true},
+					{Name: "types", Type: FieldTypeArray},
+					{Name: "auid", Type: FieldTypeInteger, Index: true},
+					{Name: "process_uid", Type: FieldTypeInteger, Index: true},
+					{Name: "pid", Type: FieldTypeInteger},
+					{Name: "ppid", Type: FieldTypeInteger},
+					{Name: "exe", Type: FieldTypeString, Index: true},
+					{Name: "comm", Type: FieldTypeString},
+					{Name: "arch", Type: FieldTypeString},
+					{Name: "syscall", Type: FieldTypeString, Size: 32, Index: true},
+					{Name: "success", Type: FieldTypeBoolean, Index: true},
+					{Name: "exit", Type: FieldTypeInteger},
+					{Name: "key", Type: FieldTypeString, Index: true},
+					{Name: "tty", Type: FieldTypeString},
+					{Name: "cwd", Type: FieldTypeString},
+					{Name: "argv", Type: FieldTypeArray},
+					{Name: "proctitle", Type: FieldTypeString},
+					{Name: "paths", Type: FieldTypeArray},
+					{Name: "records", Type: FieldTypeArray},
+				},
+				SequentialID: !opts.deterministicUID(),
+			}, nil
+		},
+		// records of an event are written consecutively, multi-record events end with EOE
+		Multiline: service.MultilineOptions{
+			Key: `^(node=\S+ )?type=\S+ msg=audit\(([^)]*)\)`,
+			End: `^(?:node=\S+ )?type=EOE `,
+		},
+	})
+}
+
+const (
+	auditdTypeSyscall   = "SYSCALL"
+	auditdTypeExecve    = "EXECVE"
+	auditdTypeCWD       = "CWD"
+	auditdTypePath      = "PATH"
+	auditdTypeProctitle = "PROCTITLE"
+	// end of multi-record event
+	auditdTypeEOE = "EOE"
+)
+
+// node prefix is added when records are forwarded from other hosts
+var auditdRecordHeader = regexp.MustCompile(`^(?:node=(\S+) )?type=(\S+) msg=audit\((\d+)\.(\d+):(\d+)\):\s*(.*)$`)
+
+// fields with untrusted strings, which are written quoted or hex encoded
+var auditdEncodedFields = map[string]bool{
+	"acct": true, "cmd": true, "comm": true, "cwd": true, "data": true, "exe": true, "file": true,
+	"key": true, "name": true, "ocomm": true, "path": true, "proctitle": true, "vm": true, "watch": true,
+}
+
+var auditdExecveArg = regexp.MustCompile(`^a\d+(\[\d+\])?$`)
+
+type auditdEntry struct {
+	UID             string    `json:"uid"`
+	ServerTimestamp time.Time `json:"server_timestamp"`
+	Timestamp       time.Time `json:"timestamp"`
+	Serial          int64     `json:"serial"`
+	Node            string    `json:"node,omitempty"`
+	// Type is SYSCALL for syscall events, otherwise type of the first record
+	Type  string   `json:"type"`
+	Types []string `json:"types"`
+	Auid  *int64   `json:"auid,omitempty"`
+	// ProcessUID is uid field of audit record, uid is entry identifier as in other parsers
+	ProcessUID *int64 `json:"process_uid,omitempty"`
+	PID        int64  `json:"pid,omitempty"`
+	PPID       int64  `json:"ppid,omitempty"`
+	Exe        string `json:"exe,omitempty"`
+	Comm       string `json:"comm,omitempty"`
+	Arch       string `json:"arch,omitempty"`
+	// Syscall is syscall name of enriched logs, or number
+	Syscall   string   `json:"syscall,omitempty"`
+	Success   *bool    `json:"success,omitempty"`
+	Exit      *int64   `json:"exit,omitempty"`
+	Key       string   `json:"key,omitempty"`
+	TTY       string   `json:"tty,omitempty"`
+	CWD       string   `json:"cwd,omitempty"`
+	Argv      []string `json:"argv,omitempty"`
+	Proctitle string   `json:"proctitle,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	// Records are decoded fields of all records with their type
+	Records []map[string]string `json:"records"`
+}
+
+type auditdRecord struct {
+	node      string
+	typ       string
+	timestamp time.Time
+	serial    int64
+	fields    map[string]string
+}
+
+type auditdEvent struct {
+	records []*auditdRecord
+	lines   []string
+}
+
+func (e *auditdEvent) add(r *auditdRecord, line string) {
+	e.records = append(e.records, r)
+	e.lines = append(e.lines, line)
+}
+
+type auditdLineParser struct {
+	uidGenerator *uidGenerator
+}
+
+func NewAuditdLineParser(opts Options) *auditdLineParser {
+	return &auditdLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *auditdLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt correlates records of an event into single entry. Records sharing event serial are
+// expected to be assembled before they are parsed, see parser Multiline options, a single
+// record is stored as an event on its own. EOE record is not stored.
+func (p *auditdLineParser) ParseAt(record string, position service.Position) ([]byte, error) {
+	event := &auditdEvent{}
+	var first *auditdRecord
+	for _, line := range strings.Split(record, "\n") {
+		r, err := parseAuditdRecord(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if first == nil {
+			first = r
+		} else if first.node != r.node || first.serial != r.serial {
+			return nil, fmt.Errorf("records of events %d and %d are mixed", first.serial, r.serial)
+		}
+
+		if r.typ != auditdTypeEOE {
+			event.add(r, line)
+		}
+	}
+
+	if len(event.records) == 0 {
+		return nil, fmt.Errorf("end of event %d without records, %w", first.serial, service.ErrSkipLine)
+	}
+
+	return p.marshal(event, position)
+}
+
+func (p *auditdLineParser) marshal(event *auditdEvent, position service.Position) ([]byte, error) {
+	entry := event.entry()
+	entry.ServerTimestamp = time.Now().UTC()
+
+	var err error
+	entry.UID, err = p.uidGenerator.uid(strings.Join(event.lines, "\n"), position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal auditd entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+// entry flattens fields of the event, values of SYSCALL record take precedence
+func (e *auditdEvent) entry() *auditdEntry {
+	first := e.records[0]
+	entry := &auditdEntry{
+		Timestamp: first.timestamp,
+		Serial:    first.serial,
+		Node:      first.node,
+		Type:      first.typ,
+	}
+
+	ordered := []*auditdRecord{}
+	for _, r := range e.records {
+		entry.Types = append(entry.Types, r.typ)
+		record := map[string]string{"type": r.typ}
+		for k, v := range r.fields {
+			record[k] = v
+		}
+		entry.Records = append(entry.Records, record)
+
+		switch r.typ {
+		case auditdTypeSyscall:
+			entry.Type = r.typ
+			ordered = append([]*auditdRecord{r}, ordered...)
+			continue
+		case auditdTypeExecve:
+			entry.Argv = auditdArgv(r.fields)
+		case auditdTypeCWD:
+			entry.CWD = r.fields["cwd"]
+		case auditdTypePath:
+			if name, ok := r.fields["name"]; ok && name != "(null)" {
+				entry.Paths = append(entry.Paths, name)
+			}
+		case auditdTypeProctitle:
+			entry.Proctitle = r.fields["proctitle"]
+		}
+
+		ordered = append(ordered, r)
+	}
+
+	lookup := func(keys ...string) (string, bool) {
+		for _, r := range ordered {
+			for _, k := range keys {
+				if v, ok := r.fields[k]; ok && v != "" && v != "?" && v != "(null)" {
+					return v, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	ints := []struct {
+		key   string
+		value **int64
+	}{
+		{"auid", &entry.Auid},
+		{"uid", &entry.ProcessUID},
+		{"exit", &entry.Exit},
+	}
+	for _, i := range ints {
+		if v, ok := lookup(i.key); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err == nil {
+				*i.value = &n
+			}
+		}
+	}
+
+	if v, ok := lookup("pid"); ok {
+		entry.PID, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v, ok := lookup("ppid"); ok {
+		entry.PPID, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	entry.Exe, _ = lookup("exe")
+	entry.Comm, _ = lookup("comm")
+	entry.Arch, _ = lookup("ARCH", "arch")
+	entry.Syscall, _ = lookup("SYSCALL", "syscall")
+	entry.Key, _ = lookup("key")
+	entry.TTY, _ = lookup("tty", "terminal")
+
+	// syscall success, or result of userspace messages
+	if v, ok := lookup("success", "res"); ok {
+		var success bool
+		switch v {
+		case "yes", "success", "1":
+			success = true
+			entry.Success = &success
+		case "no", "failed", "0":
+			entry.Success = &success
+		}
+	}
+
+	return entry
+}
+
+// auditdArgv returns arguments of EXECVE record, long arguments are split into a<n>[<i>] fields
+func auditdArgv(fields map[string]string) []string {
+	argc, err := strconv.Atoi(fields["argc"])
+	if err != nil {
+		return nil
+	}
+
+	argv := []string{}
+	for i := 0; i < argc; i++ {
+		if v, ok := fields[fmt.Sprintf("a%d", i)]; ok {
+			argv = append(argv, v)
+			continue
+		}
+
+		var arg strings.Builder
+		for j := 0; ; j++ {
+			v, ok := fields[fmt.Sprintf("a%d[%d]", i, j)]
+			if !ok {
+				break
+			}
+			arg.WriteString(v)
+		}
+		argv = append(argv, arg.String())
+	}
+
+	return argv
+}
+
+func parseAuditdRecord(line string) (*auditdRecord, error) {
+	// enriched logs append interpreted fields after group separator
+	raw, enriched, _ := strings.Cut(strings.TrimRight(line, "\r\n"), "\x1d")
+	m := auditdRecordHeader.FindStringSubmatch(raw)
+	if m == nil {
+		return nil, errors.New("not an audit record")
+	}
+
+	sec, err := strconv.ParseInt(m[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit record timestamp, %w", err)
+	}
+
+	ms, err := strconv.ParseInt(m[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit record timestamp, %w", err)
+	}
+
+	serial, err := strconv.ParseInt(m[5], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit record serial, %w", err)
+	}
+
+	r := &auditdRecord{
+		node:      m[1],
+		typ:       m[2],
+		timestamp: time.Unix(sec, ms*int64(time.Millisecond)).UTC(),
+		serial:    serial,
+		fields:    map[string]string{},
+	}
+
+	r.parseFields(m[6])
+	r.parseFields(enriched)
+	return r, nil
+}
+
+// parseFields parses key=value pairs with optionally quoted values. Userspace messages have
+// nested pairs in msg='...', which are flattened.
+func (r *auditdRecord) parseFields(s string) {
+	for {
+		s = strings.TrimLeft(s, " ")
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return
+		}
+
+		key := s[:eq]
+		if sp := strings.IndexByte(key, ' '); sp >= 0 {
+			// token without value
+			s = s[sp:]
+			continue
+		}
+
+		s = s[eq+1:]
+		var value string
+		quoted := len(s) > 0 && (s[0] == '"' || s[0] == '\'')
+		if quoted {
+			quote := s[0]
+			end := strings.IndexByte(s[1:], quote)
+			if end < 0 {
+				// unterminated value till end of line
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+
+			if quote == '\'' && strings.Contains(value, "=") {
+				r.parseFields(value)
+				continue
+			}
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+
+			value, s = s[:end], s[end:]
+			if auditdEncodedFields[key] || r.typ == auditdTypeExecve && auditdExecveArg.MatchString(key) {
+				value = auditdDecode(key, value)
+			}
+		}
+
+		r.fields[key] = value
+	}
+}
+
+// auditdDecode decodes hex encoded value, values which are not hex, e.g. (null), are kept
+func auditdDecode(key string, value string) string {
+	if len(value)%2 != 0 || strings.ToUpper(value) != value {
+		return value
+	}
+
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+
+	switch key {
+	case "proctitle":
+		// arguments are separated with NUL
+		return strings.TrimRight(strings.ReplaceAll(string(b), "\x00", " "), " ")
+	case "key":
+		// multiple keys are separated with SOH
+		return strings.ReplaceAll(string(b), "\x01", ",")
+	}
+
+	return string(b)
+}
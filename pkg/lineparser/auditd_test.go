@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseAuditdLines assembles records of events as file tail does and parses them
+func parseAuditdLines(t *testing.T, p *auditdLineParser, lines []string) []auditdEntry {
+	entries := []auditdEntry{}
+	for i, r := range assembleRecords(t, "auditd", lines) {
+		b, err := p.Parse(r)
+		if err != nil {
+			require.ErrorIs(t, err, service.ErrSkipLine, "record %d", i)
+			continue
+		}
+
+		var entry auditdEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestAuditdSyscallEvent(t *testing.T) {
+	lines := []string{
+		"type=SYSCALL msg=audit(1675458901.123:4567): arch=c000003e syscall=59 success=yes exit=0 a0=55d0 a1=55d1 a2=55d2 a3=0 items=2 ppid=1200 pid=1300 auid=1000 uid=0 gid=0 euid=0 tty=pts0 ses=3 comm=\"cat\" exe=\"/usr/bin/cat\" key=\"passwd\"\x1dARCH=x86_64 SYSCALL=execve AUID=\"alice\" UID=\"root\"",
+		`type=EXECVE msg=audit(1675458901.123:4567): argc=3 a0="cat" a1=2F6574632F706173737764 a2_len=4 a2[0]=2D2D a2[1]=6E6F`,
+		`type=CWD msg=audit(1675458901.123:4567): cwd=2F686F6D652F616C69636520646F6373`,
+		`type=PATH msg=audit(1675458901.123:4567): item=0 name="/usr/bin/cat" inode=123 dev=08:01 mode=0100755 ouid=0 ogid=0 rdev=00:00 nametype=NORMAL`,
+		`type=PATH msg=audit(1675458901.123:4567): item=1 name="/etc/passwd" inode=456 dev=08:01 mode=0100644 ouid=0 ogid=0 rdev=00:00 nametype=NORMAL`,
+		`type=PROCTITLE msg=audit(1675458901.123:4567): proctitle=636174002F6574632F706173737764`,
+		`type=EOE msg=audit(1675458901.123:4567): `,
+	}
+
+	p := NewAuditdLineParser(Options{})
+	entries := parseAuditdLines(t, p, lines)
+	require.Len(t, entries, 1)
+
+	entry := entries[0]
+	assert.NotEmpty(t, entry.UID)
+	assert.Equal(t, time.Date(2023, 2, 3, 21, 15, 1, 123000000, time.UTC), entry.Timestamp)
+	assert.Equal(t, int64(4567), entry.Serial)
+	assert.Equal(t, "SYSCALL", entry.Type)
+	assert.Equal(t, []string{"SYSCALL", "EXECVE", "CWD", "PATH", "PATH", "PROCTITLE"}, entry.Types)
+	require.NotNil(t, entry.Auid)
+	assert.Equal(t, int64(1000), *entry.Auid)
+	require.NotNil(t, entry.ProcessUID)
+	assert.Equal(t, int64(0), *entry.ProcessUID)
+	assert.Equal(t, int64(1300), entry.PID)
+	assert.Equal(t, int64(1200), entry.PPID)
+	assert.Equal(t, "/usr/bin/cat", entry.Exe)
+	assert.Equal(t, "cat", entry.Comm)
+	assert.Equal(t, "x86_64", entry.Arch)
+	assert.Equal(t, "execve", entry.Syscall)
+	require.NotNil(t, entry.Success)
+	assert.True(t, *entry.Success)
+	require.NotNil(t, entry.Exit)
+	assert.Equal(t, int64(0), *entry.Exit)
+	assert.Equal(t, "passwd", entry.Key)
+	assert.Equal(t, "pts0", entry.TTY)
+	assert.Equal(t, "/home/alice docs", entry.CWD)
+	assert.Equal(t, []string{"cat", "/etc/passwd", "--no"}, entry.Argv)
+	assert.Equal(t, "cat /etc/passwd", entry.Proctitle)
+	assert.Equal(t, []string{"/usr/bin/cat", "/etc/passwd"}, entry.Paths)
+	require.Len(t, entry.Records, 6)
+	assert.Equal(t, "alice", entry.Records[0]["AUID"])
+	assert.Equal(t, "55d0", entry.Records[0]["a0"])
+	assert.Equal(t, "0100644", entry.Records[4]["mode"])
+}
+
+func TestAuditdUserspaceAndIncompleteEvents(t *testing.T) {
+	lines := []string{
+		`type=USER_LOGIN msg=audit(1675458905.000:4570): pid=2001 uid=0 auid=1000 ses=4 subj=unconfined msg='op=login id=1000 exe="/usr/sbin/sshd" hostname=10.0.0.5 addr=10.0.0.5 terminal=/dev/pts/1 res=failed'`,
+		`node=web1 type=CONFIG_CHANGE msg=audit(1675458910.000:4571): auid=1000 ses=4 op=add_rule key=70617373776401657463 list=4 res=1`,
+		`node=web1 type=SYSCALL msg=audit(1675458911.000:4572): arch=c000003e syscall=2 success=no exit=-13 ppid=1 pid=3000 auid=4294967295 uid=33 comm="php" exe="/usr/bin/php" key=(null)`,
+		`node=web1 type=PATH msg=audit(1675458911.000:4572): item=0 name=(null) nametype=UNKNOWN`,
+		`node=web1 type=EOE msg=audit(1675458911.000:4572): `,
+		`node=web1 type=EOE msg=audit(1675458911.000:4572): `,
+	}
+
+	p := NewAuditdLineParser(Options{})
+	entries := parseAuditdLines(t, p, lines)
+	require.Len(t, entries, 3)
+
+	login := entries[0]
+	assert.Equal(t, "USER_LOGIN", login.Type)
+	assert.Equal(t, int64(1000), *login.Auid)
+	assert.Equal(t, int64(0), *login.ProcessUID)
+	assert.Equal(t, "/usr/sbin/sshd", login.Exe)
+	assert.Equal(t, "/dev/pts/1", login.TTY)
+	require.NotNil(t, login.Success)
+	assert.False(t, *login.Success)
+	assert.Equal(t, "10.0.0.5", login.Records[0]["addr"])
+
+	// assembled until the record of the next event
+	config := entries[1]
+	assert.Equal(t, "CONFIG_CHANGE", config.Type)
+	assert.Equal(t, "web1", config.Node)
+	assert.Equal(t, "passwd,etc", config.Key)
+	assert.True(t, *config.Success)
+
+	denied := entries[2]
+	assert.Equal(t, "SYSCALL", denied.Type)
+	assert.Equal(t, []string{"SYSCALL", "PATH"}, denied.Types)
+	assert.Equal(t, int64(4294967295), *denied.Auid)
+	assert.Equal(t, int64(33), *denied.ProcessUID)
+	assert.Equal(t, "2", denied.Syscall)
+	assert.False(t, *denied.Success)
+	assert.Equal(t, int64(-13), *denied.Exit)
+	assert.Empty(t, denied.Key)
+	assert.Empty(t, denied.Paths)
+}
+
+func TestAuditdInvalidRecords(t *testing.T) {
+	p := NewAuditdLineParser(Options{})
+	for _, line := range []string{
+		`some invalid line that cannot be parsed`,
+		`type=SYSCALL msg=audit(invalid:1): syscall=2`,
+		`type=SYSCALL msg=audit(1675458911.000:99999999999999999999): syscall=2`,
+		"type=SYSCALL msg=audit(1675458911.000:1): syscall=2\ntype=PATH msg=audit(1675458911.000:2): item=0",
+		"type=SYSCALL msg=audit(1675458911.000:1): syscall=2\nnot an audit record",
+	} {
+		_, err := p.Parse(line)
+		assert.Error(t, err, line)
+		assert.NotErrorIs(t, err, service.ErrSkipLine, line)
+	}
+}
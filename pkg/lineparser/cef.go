@@ -0,0 +1,336 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "cef",
+		Description: "ArcSight Common Event Format events, optionally with syslog prefix",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewCEFLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return securityEventSchema(opts,
+				SchemaField{Name: "cef_version", Type: FieldTypeInteger},
+				SchemaField{Name: "name", Type: FieldTypeString},
+				SchemaField{Name: "spt", Type: FieldTypeInteger},
+				SchemaField{Name: "dpt", Type: FieldTypeInteger},
+				SchemaField{Name: "duser", Type: FieldTypeString},
+				SchemaField{Name: "shost", Type: FieldTypeString},
+				SchemaField{Name: "dhost", Type: FieldTypeString},
+				SchemaField{Name: "act", Type: FieldTypeString},
+				SchemaField{Name: "proto", Type: FieldTypeString},
+				SchemaField{Name: "outcome", Type: FieldTypeString},
+				SchemaField{Name: "msg", Type: FieldTypeString},
+				SchemaField{Name: "rt", Type: FieldTypeTimestamp},
+			), nil
+		},
+	})
+}
+
+// cefExtensionTypes are types of extension keys which are not strings
+var cefExtensionTypes = func() map[string]string {
+	types := map[string]string{}
+	for _, k := range []string{"spt", "dpt", "cnt", "in", "out", "fsize", "oldFileSize", "cn1", "cn2", "cn3",
+		"dvcpid", "spid", "dpid", "type", "sourceTranslatedPort", "destinationTranslatedPort", "deviceDirection"} {
+		types[k] = FieldTypeInteger
+	}
+	for _, k := range []string{"cfp1", "cfp2", "cfp3", "cfp4", "slat", "slong", "dlat", "dlong"} {
+		types[k] = FieldTypeFloat
+	}
+	for _, k := range []string{"rt", "start", "end", "art", "deviceCustomDate1", "deviceCustomDate2", "flexDate1",
+		"fileCreateTime", "fileModificationTime", "oldFileCreateTime", "oldFileModificationTime"} {
+		types[k] = FieldTypeTimestamp
+	}
+
+	return types
+}()
+
+// CEF severity names, mapped to the highest value of their range
+var cefSeverities = map[string]int{
+	"low": 3, "medium": 6, "high": 8, "very-high": 10,
+}
+
+// timestamp formats of CEF and LEEF events, without year the most recent one is assumed
+var securityEventTimestampLayouts = []string{
+	"Jan 2 2006 15:04:05.000 MST",
+	"Jan 2 2006 15:04:05.000",
+	"Jan 2 2006 15:04:05 MST",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 15:04:05.000 MST",
+	"Jan 2 15:04:05.000",
+	"Jan 2 15:04:05 MST",
+	"Jan 2 15:04:05",
+	time.RFC3339Nano,
+}
+
+// securityEventSchema returns fields common for CEF and LEEF followed by format fields
+func securityEventSchema(opts Options, fields ...SchemaField) Schema {
+	return Schema{
+		Fields: append([]SchemaField{
+			{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+			{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+			{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+			{Name: "hostname", Type: FieldTypeString},
+			{Name: "app", Type: FieldTypeString},
+			{Name: "deviceVendor", Type: FieldTypeString, Size: 128, Index: true},
+			{Name: "deviceProduct", Type: FieldTypeString, Size: 128, Index: true},
+			{Name: "deviceVersion", Type: FieldTypeString},
+			{Name: "signatureId", Type: FieldTypeString, Size: 128, Index: true},
+			{Name: "severity", Type: FieldTypeInteger, Index: true},
+			{Name: "src", Type: FieldTypeString, Size: 64, Index: true},
+			{Name: "dst", Type: FieldTypeString, Size: 64, Index: true},
+			{Name: "suser", Type: FieldTypeString, Index: true},
+		}, fields...),
+		SequentialID: !opts.deterministicUID(),
+	}
+}
+
+type cefLineParser struct {
+	syslog       *syslogLineParser
+	uidGenerator *uidGenerator
+}
+
+func NewCEFLineParser(opts Options) *cefLineParser {
+	return &cefLineParser{
+		syslog:       NewSyslogLineParser(opts),
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *cefLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt parses CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+func (p *cefLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	entry, event, err := p.syslog.securityEventPrefix(line, "CEF:")
+	if err != nil {
+		return nil, err
+	}
+
+	header := splitEscaped(event, '|', 8)
+	if len(header) < 8 {
+		return nil, fmt.Errorf("invalid CEF header, %d fields", len(header))
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(header[0], "CEF:"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CEF version, %w", err)
+	}
+
+	for k, v := range parseCEFExtension(header[7]) {
+		typed, err := securityEventValue(cefExtensionTypes[k], v, securityEventTimestampLayouts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CEF extension %s '%s', %w", k, v, err)
+		}
+
+		entry[k] = typed
+	}
+
+	entry["cef_version"] = version
+	entry["deviceVendor"] = header[1]
+	entry["deviceProduct"] = header[2]
+	entry["deviceVersion"] = header[3]
+	entry["signatureId"] = header[4]
+	entry["name"] = header[5]
+
+	severity := strings.TrimSpace(header[6])
+	if n, err := strconv.Atoi(severity); err == nil {
+		entry["severity"] = n
+	} else if n, ok := cefSeverities[strings.ToLower(severity)]; ok {
+		entry["severity"] = n
+	}
+
+	// event time, syslog timestamp otherwise
+	if rt, ok := entry["rt"]; ok {
+		entry["timestamp"] = rt
+	}
+
+	return marshalSecurityEvent(p.uidGenerator, entry, line, position)
+}
+
+// securityEventPrefix returns hostname, app and timestamp of syslog prefix preceding the event
+// marker, and the event
+func (p *syslogLineParser) securityEventPrefix(line string, marker string) (map[string]interface{}, string, error) {
+	line = strings.TrimRight(line, "\r\n\x00")
+	pos := strings.Index(line, marker)
+	if pos < 0 {
+		return nil, "", fmt.Errorf("not a %s event", strings.TrimSuffix(marker, ":"))
+	}
+
+	entry := map[string]interface{}{}
+	if pos == 0 {
+		return entry, line, nil
+	}
+
+	s, err := p.parseEntry(line)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid syslog prefix, %w", err)
+	}
+
+	if !s.Timestamp.IsZero() {
+		entry["timestamp"] = s.Timestamp
+	}
+	if s.Hostname != "" {
+		entry["hostname"] = s.Hostname
+	}
+	// event right after hostname is parsed as tag
+	if s.App != "" && s.App+":" != marker {
+		entry["app"] = s.App
+	}
+
+	return entry, line[pos:], nil
+}
+
+func marshalSecurityEvent(g *uidGenerator, entry map[string]interface{}, line string, position service.Position) ([]byte, error) {
+	entry["server_timestamp"] = time.Now().UTC()
+	uid, err := g.uid(line, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	entry["uid"] = uid
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal security event, %w", err)
+	}
+
+	return bytes, nil
+}
+
+// splitEscaped splits s at unescaped separators into at most n fields, \<separator> and \\
+// are unescaped except in the last field
+func splitEscaped(s string, separator byte, n int) []string {
+	fields := []string{}
+	var field strings.Builder
+	for i := 0; i < len(s); i++ {
+		if len(fields) == n-1 {
+			field.WriteString(s[i:])
+			break
+		}
+
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == separator || s[i+1] == '\\') {
+			i++
+			field.WriteByte(s[i])
+			continue
+		}
+
+		if s[i] == separator {
+			fields = append(fields, field.String())
+			field.Reset()
+			continue
+		}
+
+		field.WriteByte(s[i])
+	}
+
+	return append(fields, field.String())
+}
+
+// parseCEFExtension parses space separated key=value pairs, values may contain spaces and
+// escaped \=, \\, \n and \r
+func parseCEFExtension(s string) map[string]string {
+	// positions of unescaped =
+	eqs := []int{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+
+		if s[i] == '=' {
+			eqs = append(eqs, i)
+		}
+	}
+
+	fields := map[string]string{}
+	keyStart := 0
+	for i, eq := range eqs {
+		key := strings.TrimSpace(s[keyStart:eq])
+		valueEnd := len(s)
+		if i+1 < len(eqs) {
+			// value ends with the last space before the next key
+			next := strings.LastIndexByte(s[eq+1:eqs[i+1]], ' ')
+			if next >= 0 {
+				valueEnd = eq + 1 + next
+			} else {
+				valueEnd = eqs[i+1]
+			}
+		}
+
+		if key != "" {
+			fields[key] = cefUnescaper.Replace(strings.TrimRight(s[eq+1:valueEnd], " "))
+		}
+		keyStart = valueEnd
+	}
+
+	return fields
+}
+
+var cefUnescaper = strings.NewReplacer(`\=`, `=`, `\\`, `\`, `\n`, "\n", `\r`, "\r", `\|`, `|`)
+
+// securityEventValue converts value of typed field, timestamps can be also milliseconds
+// since epoch
+func securityEventValue(typ string, value string, layouts []string) (interface{}, error) {
+	switch typ {
+	case FieldTypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case FieldTypeFloat:
+		return strconv.ParseFloat(value, 64)
+	case FieldTypeTimestamp:
+		return securityEventTimestamp(value, layouts)
+	default:
+		return value, nil
+	}
+}
+
+func securityEventTimestamp(value string, layouts []string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+
+	for _, layout := range layouts {
+		ts, err := time.ParseInLocation(layout, value, time.UTC)
+		if err != nil {
+			continue
+		}
+
+		if ts.Year() == 0 {
+			now := time.Now()
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+		}
+
+		return ts, nil
+	}
+
+	return time.Time{}, errors.New("could not parse timestamp")
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCEFParse(t *testing.T) {
+	type testData struct {
+		line      string
+		expected  map[string]interface{}
+		expectErr bool
+	}
+
+	tdd := []testData{
+		{
+			line: `CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232`,
+			expected: map[string]interface{}{
+				"cef_version": float64(0), "deviceVendor": "Security", "deviceProduct": "threatmanager", "deviceVersion": "1.0",
+				"signatureId": "100", "name": "worm successfully stopped", "severity": float64(10),
+				"src": "10.0.0.1", "dst": "2.1.2.2", "spt": float64(1232),
+			},
+		},
+		{
+			line: `<134>Feb  3 21:15:01 fw01 CEF:0|Palo Alto Networks|PAN-OS|10.1|end|TRAFFIC|3|rt=Feb 03 2023 21:15:01.123 UTC src=10.0.0.5 dst=8.8.8.8 dpt=53 suser=corp\\alice msg=rule a\=b matched act=allow`,
+			expected: map[string]interface{}{
+				"timestamp": "2023-02-03T21:15:01.123Z", "rt": "2023-02-03T21:15:01.123Z", "hostname": "fw01",
+				"cef_version": float64(0), "deviceVendor": "Palo Alto Networks", "deviceProduct": "PAN-OS", "deviceVersion": "10.1",
+				"signatureId": "end", "name": "TRAFFIC", "severity": float64(3),
+				"src": "10.0.0.5", "dst": "8.8.8.8", "dpt": float64(53), "suser": `corp\alice`, "msg": "rule a=b matched", "act": "allow",
+			},
+		},
+		{
+			line: `<134>1 2023-02-03T21:15:01Z ids01 snort - - - CEF:1|Vendor\|X|Prod|1|sig|Name with \\ backslash|Very-High|`,
+			expected: map[string]interface{}{
+				"timestamp": "2023-02-03T21:15:01Z", "hostname": "ids01", "app": "snort",
+				"cef_version": float64(1), "deviceVendor": "Vendor|X", "deviceProduct": "Prod", "deviceVersion": "1",
+				"signatureId": "sig", "name": `Name with \ backslash`, "severity": float64(10),
+			},
+		},
+		{
+			line: `CEF:0|Vendor|Prod|1|sig|name|Unknown|start=1675458901123 cs1Label=policy cs1=allow all  dhost=db01`,
+			expected: map[string]interface{}{
+				"cef_version": float64(0), "deviceVendor": "Vendor", "deviceProduct": "Prod", "deviceVersion": "1",
+				"signatureId": "sig", "name": "name", "start": "2023-02-03T21:15:01.123Z",
+				"cs1Label": "policy", "cs1": "allow all", "dhost": "db01",
+			},
+		},
+		{line: `CEF:0|Vendor|Prod|1|sig|name|5|spt=http`, expectErr: true},
+		{line: `CEF:0|Vendor|Prod|1|sig|name|5|rt=yesterday`, expectErr: true},
+		{line: `CEF:x|Vendor|Prod|1|sig|name|5|`, expectErr: true},
+		{line: `CEF:0|Vendor|Prod|1|sig`, expectErr: true},
+		{line: `<999>Feb  3 21:15:01 fw01 CEF:0|Vendor|Prod|1|sig|name|5|`, expectErr: true},
+		{line: `some invalid line that cannot be parsed`, expectErr: true},
+	}
+
+	p := NewCEFLineParser(Options{})
+	for _, td := range tdd {
+		b, err := p.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err, td.line)
+			continue
+		}
+
+		require.NoError(t, err, td.line)
+		assertSecurityEvent(t, td.expected, b)
+	}
+}
+
+// assertSecurityEvent compares parsed entry without uid and server timestamp, timestamps are
+// compared as instants
+func assertSecurityEvent(t *testing.T, expected map[string]interface{}, b []byte) {
+	entry := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(b, &entry))
+	assert.NotEmpty(t, entry["uid"])
+	assert.NotEmpty(t, entry["server_timestamp"])
+	delete(entry, "uid")
+	delete(entry, "server_timestamp")
+
+	for k, v := range expected {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		e, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			continue
+		}
+
+		require.Contains(t, entry, k)
+		a, err := time.Parse(time.RFC3339Nano, entry[k].(string))
+		require.NoError(t, err)
+		assert.True(t, e.Equal(a), "%s: %s", k, entry[k])
+		entry[k] = v
+	}
+
+	assert.Equal(t, expected, entry)
+}
@@ -0,0 +1,396 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "custom",
+		Description: "lines matching regular expression or grok pattern of --parser-definition",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewCustomLineParser(opts)
+		},
+		Schema: func(opts Options) (Schema, error) {
+			if opts.Definition == nil {
+				return Schema{}, errors.New("custom parser requires parser definition")
+			}
+
+			return opts.Definition.Schema(), nil
+		},
+	})
+}
+
+// named timestamp formats, other formats are considered as go time layouts
+var timestampFormats = map[string]string{
+	"RFC3339":     time.RFC3339Nano,
+	"RFC3339Nano": time.RFC3339Nano,
+	"syslog":      time.Stamp,
+	"httpdate":    "02/Jan/2006:15:04:05 -0700",
+}
+
+// fields set by custom parser itself
+var customReservedFields = []string{"uid", "server_timestamp"}
+
+// Definition describes line format parsed by custom parser and the collection schema for
+// parsed entries. It is read from YAML or JSON file and stored with parser options.
+type Definition struct {
+	Name string `json:"name" yaml:"name"`
+	// Pattern is regular expression with named groups, e.g. (?P<host>\S+)
+	Pattern string `json:"pattern,omitempty" yaml:"pattern"`
+	// Grok is grok-style pattern, e.g. %{IPORHOST:host} %{INT:pid:int}
+	Grok string `json:"grok,omitempty" yaml:"grok"`
+	// Patterns are additional grok patterns which can be referenced from Grok
+	Patterns map[string]string `json:"patterns,omitempty" yaml:"patterns"`
+	Fields   []DefinitionField `json:"fields,omitempty" yaml:"fields"`
+	// SkipUnmatched makes lines not matching the pattern skipped instead of invalid
+	SkipUnmatched bool `json:"skip_unmatched,omitempty" yaml:"skip_unmatched"`
+}
+
+type DefinitionField struct {
+	Name string `json:"name" yaml:"name"`
+	// Type is one of string, integer, float, boolean or timestamp, default string
+	Type string `json:"type,omitempty" yaml:"type"`
+	// Formats of timestamp field, tried in order. Go time layouts, or RFC3339, RFC3339Nano,
+	// syslog, httpdate, unix and unix_ms. Default RFC3339.
+	Formats []string `json:"formats,omitempty" yaml:"formats"`
+	// Timezone of timestamps without zone, default UTC
+	Timezone string `json:"timezone,omitempty" yaml:"timezone"`
+	// Index adds the field to indexes or columns of created collections
+	Index bool `json:"index,omitempty" yaml:"index"`
+	// Size is maximum length of indexed string field, default 256
+	Size int `json:"size,omitempty" yaml:"size"`
+}
+
+// ReadDefinition reads and validates custom parser definition from YAML or JSON file
+func ReadDefinition(path string) (*Definition, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read parser definition, %w", err)
+	}
+
+	var d Definition
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&d)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode parser definition %s, %w", path, err)
+	}
+
+	err = d.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser definition %s, %w", path, err)
+	}
+
+	return &d, nil
+}
+
+func (d *Definition) Validate() error {
+	_, err := d.compile()
+	return err
+}
+
+// Schema returns uid, server_timestamp and captured fields, definition should be validated first
+func (d *Definition) Schema() Schema {
+	s := Schema{Fields: []SchemaField{
+		{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+		{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+	}}
+
+	cd, err := d.compile()
+	if err != nil {
+		return s
+	}
+
+	declared := map[string]DefinitionField{}
+	for _, f := range d.Fields {
+		declared[f.Name] = f
+	}
+
+	seen := map[string]bool{}
+	for _, name := range cd.re.SubexpNames() {
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		f := SchemaField{Name: name, Type: FieldTypeString}
+		if cf, ok := cd.fields[name]; ok {
+			f.Type = cf.typ
+		}
+
+		if df, ok := declared[name]; ok {
+			f.Size = df.Size
+			f.Index = df.Index
+		}
+
+		s.Fields = append(s.Fields, f)
+	}
+
+	return s
+}
+
+type customField struct {
+	typ      string
+	formats  []string
+	location *time.Location
+}
+
+type compiledDefinition struct {
+	re     *regexp.Regexp
+	fields map[string]*customField
+}
+
+func (d *Definition) compile() (*compiledDefinition, error) {
+	pattern := d.Pattern
+	types := map[string]string{}
+	if d.Pattern == "" && d.Grok == "" || d.Pattern != "" && d.Grok != "" {
+		return nil, errors.New("exactly one of pattern and grok needs to be set")
+	}
+
+	if d.Grok != "" {
+		var err error
+		pattern, types, err = expandGrok(d.Grok, d.Patterns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grok pattern, %w", err)
+		}
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern, %w", err)
+	}
+
+	captured := map[string]bool{}
+	for _, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+
+		for _, r := range customReservedFields {
+			if name == r {
+				return nil, fmt.Errorf("field %s is set by parser and cannot be captured", name)
+			}
+		}
+
+		captured[name] = true
+	}
+
+	if len(captured) == 0 {
+		return nil, errors.New("pattern does not capture any field")
+	}
+
+	cd := &compiledDefinition{re: re, fields: map[string]*customField{}}
+	for name, typ := range types {
+		cd.fields[name] = &customField{typ: typ}
+	}
+
+	for _, f := range d.Fields {
+		if !captured[f.Name] {
+			return nil, fmt.Errorf("field %s is not captured by pattern", f.Name)
+		}
+
+		cf := &customField{typ: f.Type, formats: f.Formats, location: time.UTC}
+		if cf.typ == "" {
+			cf.typ = FieldTypeString
+		}
+
+		switch cf.typ {
+		case FieldTypeString, FieldTypeInteger, FieldTypeFloat, FieldTypeBoolean:
+			if len(f.Formats) > 0 || f.Timezone != "" {
+				return nil, fmt.Errorf("formats and timezone can be used only with timestamp field %s", f.Name)
+			}
+		case FieldTypeTimestamp:
+			if len(cf.formats) == 0 {
+				cf.formats = []string{"RFC3339"}
+			}
+
+			if f.Timezone != "" {
+				cf.location, err = time.LoadLocation(f.Timezone)
+				if err != nil {
+					return nil, fmt.Errorf("invalid timezone of field %s, %w", f.Name, err)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("not supported type %s of field %s", f.Type, f.Name)
+		}
+
+		if f.Size < 0 || f.Size > 0 && cf.typ != FieldTypeString {
+			return nil, fmt.Errorf("size can be used only with string field %s", f.Name)
+		}
+
+		cd.fields[f.Name] = cf
+	}
+
+	return cd, nil
+}
+
+type customLineParser struct {
+	name          string
+	definition    *compiledDefinition
+	skipUnmatched bool
+	now           func() time.Time
+	uidGenerator  *uidGenerator
+}
+
+func NewCustomLineParser(opts Options) (*customLineParser, error) {
+	if opts.Definition == nil {
+		return nil, errors.New("custom parser requires parser definition")
+	}
+
+	cd, err := opts.Definition.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser definition, %w", err)
+	}
+
+	name := opts.Definition.Name
+	if name == "" {
+		name = "custom"
+	}
+
+	return &customLineParser{
+		name:          name,
+		definition:    cd,
+		skipUnmatched: opts.Definition.SkipUnmatched,
+		now:           time.Now,
+		uidGenerator:  newUIDGenerator(opts),
+	}, nil
+}
+
+func (p *customLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *customLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	m := p.definition.re.FindStringSubmatchIndex(line)
+	if m == nil {
+		if p.skipUnmatched {
+			return nil, fmt.Errorf("line does not match %s pattern, %w", p.name, service.ErrSkipLine)
+		}
+
+		return nil, fmt.Errorf("line does not match %s pattern", p.name)
+	}
+
+	entry := map[string]interface{}{}
+	for i, name := range p.definition.re.SubexpNames() {
+		// not named or not participating groups
+		if name == "" || m[2*i] < 0 {
+			continue
+		}
+
+		v, err := p.convert(name, line[m[2*i]:m[2*i+1]])
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %s, %w", name, err)
+		}
+
+		if v != nil {
+			entry[name] = v
+		}
+	}
+
+	entry["server_timestamp"] = p.now().UTC()
+	uid, err := p.uidGenerator.uid(line, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	entry["uid"] = uid
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal %s entry, %w", p.name, err)
+	}
+
+	return bytes, nil
+}
+
+// convert returns typed value of captured field, empty values of non string fields are omitted
+func (p *customLineParser) convert(name string, value string) (interface{}, error) {
+	f, ok := p.definition.fields[name]
+	if !ok || f.typ == FieldTypeString {
+		return value, nil
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+
+	switch f.typ {
+	case FieldTypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case FieldTypeFloat:
+		return strconv.ParseFloat(value, 64)
+	case FieldTypeBoolean:
+		return strconv.ParseBool(value)
+	default:
+		return p.parseTimestamp(f, value)
+	}
+}
+
+func (p *customLineParser) parseTimestamp(f *customField, value string) (time.Time, error) {
+	for _, format := range f.formats {
+		switch format {
+		case "unix", "unix_ms":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+
+			if format == "unix_ms" {
+				n /= 1000
+			}
+
+			sec := int64(n)
+			return time.Unix(sec, int64((n-float64(sec))*1e9)).UTC(), nil
+		}
+
+		layout, ok := timestampFormats[format]
+		if !ok {
+			layout = format
+		}
+
+		ts, err := time.ParseInLocation(layout, strings.TrimSpace(value), f.location)
+		if err != nil {
+			continue
+		}
+
+		// layouts without year, assume the most recent one
+		if ts.Year() == 0 {
+			now := p.now()
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+		}
+
+		return ts, nil
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse timestamp '%s' with formats %s", value, strings.Join(f.formats, ", "))
+}
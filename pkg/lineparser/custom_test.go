@@ -0,0 +1,168 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const sshdDefinition = `
+name: sshd
+grok: '%{SYSLOGTIMESTAMP:timestamp} %{IPORHOST:hostname} sshd\[%{POSINT:pid:int}\]: %{WORD:result} %{WORD:method} for (?:invalid user )?%{USERNAME:user} from %{IP:ip} port %{INT:port}'
+skip_unmatched: true
+fields:
+  - name: timestamp
+    type: timestamp
+    formats: [syslog]
+    index: true
+  - name: user
+    index: true
+    size: 64
+  - name: port
+    type: integer
+    index: true
+`
+
+func TestCustomParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sshd.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(sshdDefinition), 0644))
+
+	d, err := ReadDefinition(path)
+	require.NoError(t, err)
+
+	p, err := NewCustomLineParser(Options{Definition: d})
+	require.NoError(t, err)
+	p.now = func() time.Time { return time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	b, err := p.Parse(`Feb  3 21:15:01 bastion sshd[4321]: Accepted publickey for root from 10.0.0.7 port 52144 ssh2`)
+	require.NoError(t, err)
+
+	entry := gjson.ParseBytes(b)
+	assert.Equal(t, "2023-02-03T21:15:01Z", entry.Get("timestamp").String())
+	assert.Equal(t, "bastion", entry.Get("hostname").String())
+	assert.Equal(t, gjson.Number, entry.Get("pid").Type)
+	assert.Equal(t, int64(4321), entry.Get("pid").Int())
+	assert.Equal(t, "Accepted", entry.Get("result").String())
+	assert.Equal(t, "root", entry.Get("user").String())
+	assert.Equal(t, "10.0.0.7", entry.Get("ip").String())
+	assert.Equal(t, int64(52144), entry.Get("port").Int())
+	assert.Len(t, entry.Get("uid").String(), 36)
+	assert.True(t, entry.Get("server_timestamp").Exists())
+
+	// timestamp without year in the future is considered as from previous year
+	b, err = p.Parse(`Dec 24 10:00:00 bastion sshd[1]: Failed password for invalid user admin from 10.0.0.8 port 22 ssh2`)
+	require.NoError(t, err)
+	assert.Equal(t, "2022-12-24T10:00:00Z", gjson.GetBytes(b, "timestamp").String())
+
+	_, err = p.Parse(`Feb  3 21:15:01 bastion sshd[4321]: Connection closed by 10.0.0.7`)
+	assert.ErrorIs(t, err, service.ErrSkipLine)
+
+	assert.Equal(t, Schema{Fields: []SchemaField{
+		{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+		{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+		{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+		{Name: "hostname", Type: FieldTypeString},
+		{Name: "pid", Type: FieldTypeInteger},
+		{Name: "result", Type: FieldTypeString},
+		{Name: "method", Type: FieldTypeString},
+		{Name: "user", Type: FieldTypeString, Size: 64, Index: true},
+		{Name: "ip", Type: FieldTypeString},
+		{Name: "port", Type: FieldTypeInteger, Index: true},
+	}}, d.Schema())
+}
+
+func TestCustomParsePattern(t *testing.T) {
+	p, err := NewCustomLineParser(Options{UIDMode: UIDModeContent, Definition: &Definition{
+		Pattern: `^(?P<ts>\S+) (?P<ok>\w+) (?P<duration>[\d.]+)(?: (?P<note>.*))?$`,
+		Fields: []DefinitionField{
+			{Name: "ts", Type: FieldTypeTimestamp, Formats: []string{"unix_ms", "2006-01-02T15:04:05"}, Timezone: "Europe/Warsaw"},
+			{Name: "ok", Type: FieldTypeBoolean},
+			{Name: "duration", Type: FieldTypeFloat},
+		},
+	}})
+	require.NoError(t, err)
+
+	b, err := p.ParseAt(`1675458901500 true 1.5`, testPosition("file:1"))
+	require.NoError(t, err)
+	assert.Equal(t, "2023-02-03T21:15:01.5Z", gjson.GetBytes(b, "ts").String())
+	assert.True(t, gjson.GetBytes(b, "ok").Bool())
+	assert.Equal(t, 1.5, gjson.GetBytes(b, "duration").Float())
+	assert.False(t, gjson.GetBytes(b, "note").Exists())
+
+	b, err = p.ParseAt(`2023-02-03T22:15:01 false 2 slow`, testPosition("file:2"))
+	require.NoError(t, err)
+	assert.Equal(t, "2023-02-03T22:15:01+01:00", gjson.GetBytes(b, "ts").String())
+	assert.Equal(t, "slow", gjson.GetBytes(b, "note").String())
+
+	_, err = p.Parse(`yesterday true 1`)
+	assert.Error(t, err)
+
+	_, err = p.Parse(`not matching`)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrSkipLine)
+}
+
+func TestDefinitionValidate(t *testing.T) {
+	assert.NoError(t, (&Definition{Pattern: `(?P<a>\w+)`}).Validate())
+	assert.NoError(t, (&Definition{Grok: `%{PAIR:a}`, Patterns: map[string]string{"PAIR": `%{WORD}=%{WORD}`}}).Validate())
+
+	assert.Error(t, (&Definition{}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+)`, Grok: `%{WORD:a}`}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(\w+)`}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+`}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<uid>\w+)`}).Validate())
+	assert.Error(t, (&Definition{Grok: `%{UNKNOWN:a}`}).Validate())
+	assert.Error(t, (&Definition{Grok: `%{WORD:a:long}`}).Validate())
+	assert.Error(t, (&Definition{Grok: `%{LOOP:a}`, Patterns: map[string]string{"LOOP": `%{LOOP}`}}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+)`, Fields: []DefinitionField{{Name: "b"}}}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+)`, Fields: []DefinitionField{{Name: "a", Type: "date"}}}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+)`, Fields: []DefinitionField{{Name: "a", Formats: []string{"unix"}}}}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+)`, Fields: []DefinitionField{{Name: "a", Type: FieldTypeTimestamp, Timezone: "Nowhere/City"}}}).Validate())
+	assert.Error(t, (&Definition{Pattern: `(?P<a>\w+)`, Fields: []DefinitionField{{Name: "a", Type: FieldTypeInteger, Size: 10}}}).Validate())
+
+	assert.Error(t, Options{Definition: &Definition{}}.Validate())
+
+	_, err := NewCustomLineParser(Options{})
+	assert.Error(t, err)
+}
+
+func TestReadDefinition(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "definition.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"name":"kv","pattern":"(?P<key>\\w+)=(?P<value>\\d+)","fields":[{"name":"value","type":"integer","index":true}]}`), 0644))
+
+	d, err := ReadDefinition(path)
+	require.NoError(t, err)
+	assert.Equal(t, "kv", d.Name)
+	assert.Equal(t, FieldTypeInteger, d.Fields[0].Type)
+
+	// typos in definition are reported
+	require.NoError(t, os.WriteFile(path, []byte(`{"name":"kv","patern":"(?P<key>\\w+)"}`), 0644))
+	_, err = ReadDefinition(path)
+	assert.Error(t, err)
+
+	_, err = ReadDefinition(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,356 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+const (
+	k8sStageRequestReceived  = "RequestReceived"
+	k8sStageResponseStarted  = "ResponseStarted"
+	k8sStageResponseComplete = "ResponseComplete"
+	k8sStagePanic            = "Panic"
+
+	// max number of audit IDs remembered when merging stages
+	k8sAuditMergeWindow = 10000
+	// time after last stage when stages of an event without final stage are stored
+	k8sAuditMergeTimeout = time.Minute
+)
+
+// k8sAuditSchema is the same for both k8s audit parsers
+var k8sAuditSchema = staticSchema(
+	SchemaField{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+	SchemaField{Name: "server_timestamp", Type: FieldTypeTimestamp},
+	SchemaField{Name: "audit_id", Type: FieldTypeString, Size: 36, Index: true},
+	SchemaField{Name: "stage", Type: FieldTypeString, Size: 32, Index: true},
+	SchemaField{Name: "stages", Type: FieldTypeArray},
+	SchemaField{Name: "level", Type: FieldTypeString},
+	SchemaField{Name: "verb", Type: FieldTypeString, Size: 32, Index: true},
+	SchemaField{Name: "request_uri", Type: FieldTypeString},
+	SchemaField{Name: "username", Type: FieldTypeString, Size: 256, Index: true},
+	SchemaField{Name: "user_groups", Type: FieldTypeArray},
+	SchemaField{Name: "source_ip", Type: FieldTypeString},
+	SchemaField{Name: "user_agent", Type: FieldTypeString},
+	SchemaField{Name: "api_group", Type: FieldTypeString},
+	SchemaField{Name: "api_version", Type: FieldTypeString},
+	SchemaField{Name: "resource", Type: FieldTypeString, Size: 256, Index: true},
+	SchemaField{Name: "subresource", Type: FieldTypeString},
+	SchemaField{Name: "namespace", Type: FieldTypeString, Size: 256, Index: true},
+	SchemaField{Name: "name", Type: FieldTypeString, Size: 256, Index: true},
+	SchemaField{Name: "response_code", Type: FieldTypeInteger, Index: true},
+	SchemaField{Name: "request_received_timestamp", Type: FieldTypeTimestamp},
+	SchemaField{Name: "stage_timestamp", Type: FieldTypeTimestamp, Index: true},
+	SchemaField{Name: "event", Type: FieldTypeObject},
+)
+
+func init() {
+	Register(Parser{
+		Name:        "k8saudit",
+		Description: "kubernetes audit events, each stage stored as separate entry",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewK8sAuditLineParser(opts), nil
+		},
+		Schema: k8sAuditSchema,
+	})
+
+	Register(Parser{
+		Name:        "k8sauditmerged",
+		Description: "kubernetes audit events, single entry per audit id with merged stages",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewK8sAuditMergedLineParser(opts), nil
+		},
+		Schema: k8sAuditSchema,
+	})
+}
+
+// subset of audit.k8s.io/v1 Event
+type k8sAuditEvent struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Level      string `json:"level"`
+	AuditID    string `json:"auditID"`
+	Stage      string `json:"stage"`
+	RequestURI string `json:"requestURI"`
+	Verb       string `json:"verb"`
+	User       struct {
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	} `json:"user"`
+	SourceIPs []string `json:"sourceIPs"`
+	UserAgent string   `json:"userAgent"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		APIVersion  string `json:"apiVersion"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+	RequestReceivedTimestamp time.Time `json:"requestReceivedTimestamp"`
+	StageTimestamp           time.Time `json:"stageTimestamp"`
+}
+
+type k8sAuditEntry struct {
+	UID                      string          `json:"uid"`
+	ServerTimestamp          time.Time       `json:"server_timestamp"`
+	AuditID                  string          `json:"audit_id"`
+	Stage                    string          `json:"stage"`
+	Stages                   []string        `json:"stages,omitempty"`
+	Level                    string          `json:"level"`
+	Verb                     string          `json:"verb"`
+	RequestURI               string          `json:"request_uri"`
+	Username                 string          `json:"username"`
+	UserGroups               []string        `json:"user_groups,omitempty"`
+	SourceIP                 string          `json:"source_ip,omitempty"`
+	UserAgent                string          `json:"user_agent,omitempty"`
+	APIGroup                 string          `json:"api_group,omitempty"`
+	APIVersion               string          `json:"api_version,omitempty"`
+	Resource                 string          `json:"resource,omitempty"`
+	Subresource              string          `json:"subresource,omitempty"`
+	Namespace                string          `json:"namespace,omitempty"`
+	Name                     string          `json:"name,omitempty"`
+	ResponseCode             int             `json:"response_code,omitempty"`
+	RequestReceivedTimestamp time.Time       `json:"request_received_timestamp"`
+	StageTimestamp           time.Time       `json:"stage_timestamp"`
+	Event                    json.RawMessage `json:"event"`
+}
+
+// k8sAuditPending is an event waiting for its final stage, with the last stage received and
+// positions of all received stages
+type k8sAuditPending struct {
+	entry     *k8sAuditEntry
+	line      string
+	position  service.Position
+	positions []service.Position
+	stages    []string
+	updated   time.Time
+}
+
+type k8sAuditLineParser struct {
+	uidGenerator *uidGenerator
+	mergeStages  bool
+	pending      map[string]*k8sAuditPending
+	emitted      map[string]struct{}
+	window       []string
+	// pending events evicted from the window, stored with next flush
+	evicted []*k8sAuditPending
+	// positions of stages merged into the last parsed entry
+	merged []service.Position
+}
+
+// NewK8sAuditLineParser returns parser storing each stage of an audit event as separate entry.
+func NewK8sAuditLineParser(opts Options) *k8sAuditLineParser {
+	return &k8sAuditLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+// NewK8sAuditMergedLineParser returns parser which stores single entry per audit ID. Stages
+// preceding ResponseComplete or Panic are held and merged into it, duplicates of already
+// stored audit IDs are skipped. Events which do not reach final stage within
+// k8sAuditMergeTimeout, or are evicted from the merge window, are returned by Flush with the
+// stages collected so far.
+func NewK8sAuditMergedLineParser(opts Options) *k8sAuditLineParser {
+	return &k8sAuditLineParser{
+		uidGenerator: newUIDGenerator(opts),
+		mergeStages:  true,
+		pending:      map[string]*k8sAuditPending{},
+		emitted:      map[string]struct{}{},
+	}
+}
+
+func (p *k8sAuditLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *k8sAuditLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	var event k8sAuditEvent
+	err := json.Unmarshal([]byte(line), &event)
+	if err != nil {
+		return nil, fmt.Errorf("not a k8s audit event, %w", err)
+	}
+
+	if event.Kind != "Event" || event.APIVersion != "audit.k8s.io/v1" {
+		return nil, fmt.Errorf("not a k8s audit event, kind '%s', apiVersion '%s'", event.Kind, event.APIVersion)
+	}
+
+	if event.AuditID == "" {
+		return nil, errors.New("invalid k8s audit event, missing auditID")
+	}
+
+	switch event.Stage {
+	case k8sStageRequestReceived, k8sStageResponseStarted, k8sStageResponseComplete, k8sStagePanic:
+	default:
+		return nil, fmt.Errorf("invalid k8s audit event stage '%s'", event.Stage)
+	}
+
+	entry := &k8sAuditEntry{
+		AuditID:                  event.AuditID,
+		Stage:                    event.Stage,
+		Level:                    event.Level,
+		Verb:                     event.Verb,
+		RequestURI:               event.RequestURI,
+		Username:                 event.User.Username,
+		UserGroups:               event.User.Groups,
+		UserAgent:                event.UserAgent,
+		RequestReceivedTimestamp: event.RequestReceivedTimestamp,
+		StageTimestamp:           event.StageTimestamp,
+		Event:                    json.RawMessage(line),
+	}
+
+	if len(event.SourceIPs) > 0 {
+		entry.SourceIP = event.SourceIPs[0]
+	}
+
+	if event.ObjectRef != nil {
+		entry.APIGroup = event.ObjectRef.APIGroup
+		entry.APIVersion = event.ObjectRef.APIVersion
+		entry.Resource = event.ObjectRef.Resource
+		entry.Subresource = event.ObjectRef.Subresource
+		entry.Namespace = event.ObjectRef.Namespace
+		entry.Name = event.ObjectRef.Name
+	}
+
+	if event.ResponseStatus != nil {
+		entry.ResponseCode = event.ResponseStatus.Code
+	}
+
+	if p.mergeStages {
+		stages, err := p.merge(entry, line, position)
+		if err != nil {
+			return nil, err
+		}
+		entry.Stages = stages
+	}
+
+	return p.marshal(entry, line, position)
+}
+
+func (p *k8sAuditLineParser) marshal(entry *k8sAuditEntry, line string, position service.Position) ([]byte, error) {
+	var err error
+	entry.ServerTimestamp = time.Now().UTC()
+	entry.UID, err = p.uidGenerator.uid(line, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal k8s audit entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+// merge returns all stages seen for audit ID when the final stage arrives, preceding
+// stages are held pending
+func (p *k8sAuditLineParser) merge(entry *k8sAuditEntry, line string, position service.Position) ([]string, error) {
+	p.merged = nil
+	if _, ok := p.emitted[entry.AuditID]; ok {
+		return nil, service.ErrSkipLine
+	}
+
+	pending, ok := p.pending[entry.AuditID]
+	if !ok {
+		pending = &k8sAuditPending{}
+		p.pending[entry.AuditID] = pending
+		p.remember(entry.AuditID)
+	}
+
+	pending.stages = append(pending.stages, entry.Stage)
+	if entry.Stage != k8sStageResponseComplete && entry.Stage != k8sStagePanic {
+		pending.entry, pending.line, pending.position = entry, line, position
+		if position != nil {
+			pending.positions = append(pending.positions, position)
+		}
+		pending.updated = time.Now()
+		return nil, service.ErrHoldLine
+	}
+
+	delete(p.pending, entry.AuditID)
+	p.emitted[entry.AuditID] = struct{}{}
+	p.merged = pending.positions
+	return pending.stages, nil
+}
+
+// Merged returns positions of held stages merged into the last parsed entry
+func (p *k8sAuditLineParser) Merged() []service.Position {
+	return p.merged
+}
+
+func (p *k8sAuditLineParser) remember(auditID string) {
+	p.window = append(p.window, auditID)
+	if len(p.window) <= k8sAuditMergeWindow {
+		return
+	}
+
+	evicted := p.window[0]
+	p.window = p.window[1:]
+	if pending, ok := p.pending[evicted]; ok {
+		p.evicted = append(p.evicted, pending)
+		delete(p.pending, evicted)
+	}
+	delete(p.emitted, evicted)
+}
+
+// Flush returns entries of events evicted from the merge window and events without final
+// stage within k8sAuditMergeTimeout, or of all pending events when all is set. Entries
+// contain the last received stage and all stages collected so far. Stages of flushed events
+// which arrive later are stored as a new entry.
+func (p *k8sAuditLineParser) Flush(all bool) ([]service.HeldEntry, error) {
+	if !p.mergeStages {
+		return nil, nil
+	}
+
+	flushed := p.evicted
+	p.evicted = nil
+
+	deadline := time.Now().Add(-k8sAuditMergeTimeout)
+	timedOut := []*k8sAuditPending{}
+	for auditID, pending := range p.pending {
+		if all || pending.updated.Before(deadline) {
+			timedOut = append(timedOut, pending)
+			delete(p.pending, auditID)
+		}
+	}
+	sort.Slice(timedOut, func(i, j int) bool {
+		return timedOut[i].updated.Before(timedOut[j].updated)
+	})
+	flushed = append(flushed, timedOut...)
+
+	entries := []service.HeldEntry{}
+	for _, pending := range flushed {
+		pending.entry.Stages = pending.stages
+		b, err := p.marshal(pending.entry, pending.line, pending.position)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, service.HeldEntry{Entry: b, Positions: pending.positions})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestK8sAuditParse(t *testing.T) {
+	type testData struct {
+		line      string
+		expected  *k8sAuditEntry
+		expectErr bool
+	}
+
+	tdd := []testData{
+		{
+			line: `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"77ac29a9-1807-4ef5-bd74-a5e11344a79e","stage":"ResponseComplete","requestURI":"/api/v1/namespaces/kube-system/pods/coredns","verb":"delete","user":{"username":"admin","groups":["system:masters"]},"sourceIPs":["10.0.0.1","::1"],"userAgent":"kubectl/v1.25.6","objectRef":{"resource":"pods","namespace":"kube-system","name":"coredns","apiVersion":"v1"},"responseStatus":{"metadata":{},"code":200},"requestReceivedTimestamp":"2023-03-10T22:38:26.458638Z","stageTimestamp":"2023-03-10T22:38:26.459638Z"}`,
+			expected: &k8sAuditEntry{
+				AuditID:      "77ac29a9-1807-4ef5-bd74-a5e11344a79e",
+				Stage:        "ResponseComplete",
+				Level:        "Metadata",
+				Verb:         "delete",
+				RequestURI:   "/api/v1/namespaces/kube-system/pods/coredns",
+				Username:     "admin",
+				SourceIP:     "10.0.0.1",
+				Resource:     "pods",
+				Namespace:    "kube-system",
+				Name:         "coredns",
+				APIVersion:   "v1",
+				ResponseCode: 200,
+			},
+		},
+		{
+			line:      `{"kind":"EventList","apiVersion":"audit.k8s.io/v1","items":[]}`,
+			expectErr: true,
+		},
+		{
+			line:      `{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","auditID":"1","stage":"RequestReceived"}`,
+			expectErr: true,
+		},
+		{
+			line:      `{"kind":"Event","apiVersion":"audit.k8s.io/v1","auditID":"1","stage":"Unknown"}`,
+			expectErr: true,
+		},
+		{
+			line:      `some invalid line that cannot be parsed`,
+			expectErr: true,
+		},
+	}
+
+	kp := NewK8sAuditLineParser(Options{})
+
+	for _, td := range tdd {
+		b, err := kp.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err)
+			assert.Nil(t, b)
+			continue
+		}
+
+		require.NoError(t, err)
+
+		var entry k8sAuditEntry
+		assert.NoError(t, json.Unmarshal(b, &entry))
+		assert.NotEmpty(t, entry.UID)
+		assert.Equal(t, td.expected.AuditID, entry.AuditID)
+		assert.Equal(t, td.expected.Stage, entry.Stage)
+		assert.Equal(t, td.expected.Level, entry.Level)
+		assert.Equal(t, td.expected.Verb, entry.Verb)
+		assert.Equal(t, td.expected.RequestURI, entry.RequestURI)
+		assert.Equal(t, td.expected.Username, entry.Username)
+		assert.Equal(t, td.expected.SourceIP, entry.SourceIP)
+		assert.Equal(t, td.expected.Resource, entry.Resource)
+		assert.Equal(t, td.expected.Namespace, entry.Namespace)
+		assert.Equal(t, td.expected.Name, entry.Name)
+		assert.Equal(t, td.expected.APIVersion, entry.APIVersion)
+		assert.Equal(t, td.expected.ResponseCode, entry.ResponseCode)
+		assert.JSONEq(t, td.line, string(entry.Event))
+	}
+}
+
+func TestK8sAuditParseMerged(t *testing.T) {
+	f, err := os.Open("../../test/k8s/k8s.log")
+	require.NoError(t, err)
+	defer f.Close()
+
+	kp := NewK8sAuditLineParser(Options{})
+	kmp := NewK8sAuditMergedLineParser(Options{})
+
+	all := 0
+	merged := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		_, err := kp.Parse(scanner.Text())
+		require.NoError(t, err)
+		all++
+
+		b, err := kmp.Parse(scanner.Text())
+		if err == service.ErrHoldLine {
+			continue
+		}
+		require.NoError(t, err)
+
+		var entry k8sAuditEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.NotContains(t, merged, entry.AuditID)
+		assert.Equal(t, entry.Stage, entry.Stages[len(entry.Stages)-1])
+		merged[entry.AuditID] = entry.Stages
+	}
+
+	assert.Equal(t, 2971, all)
+	assert.Len(t, merged, 1376)
+	assert.Equal(t, []string{"RequestReceived", "ResponseComplete"}, merged["d4652481-193e-42f6-9b78-f8651cab5dfe"])
+
+	// replayed final stage is a duplicate
+	_, err = kmp.Parse(`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"d4652481-193e-42f6-9b78-f8651cab5dfe","stage":"ResponseComplete","requestURI":"/api?timeout=32s","verb":"get"}`)
+	assert.ErrorIs(t, err, service.ErrSkipLine)
+
+	// events without final stage are stored on flush
+	held, err := kmp.Flush(true)
+	require.NoError(t, err)
+	for _, e := range held {
+		var entry k8sAuditEntry
+		require.NoError(t, json.Unmarshal(e.Entry, &entry))
+		assert.NotContains(t, merged, entry.AuditID)
+		assert.NotContains(t, entry.Stages, k8sStageResponseComplete)
+		assert.NotContains(t, entry.Stages, k8sStagePanic)
+	}
+
+	held, err = kmp.Flush(true)
+	require.NoError(t, err)
+	assert.Empty(t, held)
+}
+
+func k8sAuditStage(auditID string, stage string) string {
+	return `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"` + auditID + `","stage":"` + stage + `","requestURI":"/api","verb":"watch"}`
+}
+
+func TestK8sAuditMergedFlush(t *testing.T) {
+	flushed := func(t *testing.T, kmp *k8sAuditLineParser, all bool) []k8sAuditEntry {
+		held, err := kmp.Flush(all)
+		require.NoError(t, err)
+
+		entries := []k8sAuditEntry{}
+		for _, e := range held {
+			var entry k8sAuditEntry
+			require.NoError(t, json.Unmarshal(e.Entry, &entry))
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	t.Run("timed out events are stored with collected stages", func(t *testing.T) {
+		kmp := NewK8sAuditMergedLineParser(Options{})
+		for _, line := range []string{
+			k8sAuditStage("a", k8sStageRequestReceived),
+			k8sAuditStage("a", k8sStageResponseStarted),
+			k8sAuditStage("b", k8sStageRequestReceived),
+		} {
+			_, err := kmp.Parse(line)
+			require.ErrorIs(t, err, service.ErrHoldLine)
+		}
+
+		assert.Empty(t, flushed(t, kmp, false))
+
+		kmp.pending["a"].updated = time.Now().Add(-2 * k8sAuditMergeTimeout)
+		entries := flushed(t, kmp, false)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "a", entries[0].AuditID)
+		assert.Equal(t, k8sStageResponseStarted, entries[0].Stage)
+		assert.Equal(t, []string{k8sStageRequestReceived, k8sStageResponseStarted}, entries[0].Stages)
+
+		// final stage arriving after timeout is stored as well
+		b, err := kmp.Parse(k8sAuditStage("a", k8sStageResponseComplete))
+		require.NoError(t, err)
+		var entry k8sAuditEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.Equal(t, []string{k8sStageResponseComplete}, entry.Stages)
+
+		entries = flushed(t, kmp, true)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "b", entries[0].AuditID)
+	})
+
+	t.Run("evicted events are stored with collected stages", func(t *testing.T) {
+		kmp := NewK8sAuditMergedLineParser(Options{})
+		_, err := kmp.Parse(k8sAuditStage("evicted", k8sStageRequestReceived))
+		require.ErrorIs(t, err, service.ErrHoldLine)
+
+		for i := 0; i < k8sAuditMergeWindow; i++ {
+			_, err := kmp.Parse(k8sAuditStage(fmt.Sprint(i), k8sStageResponseComplete))
+			require.NoError(t, err)
+		}
+
+		entries := flushed(t, kmp, false)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "evicted", entries[0].AuditID)
+		assert.Equal(t, []string{k8sStageRequestReceived}, entries[0].Stages)
+	})
+
+	t.Run("positions of held stages are returned with merged entry", func(t *testing.T) {
+		kmp := NewK8sAuditMergedLineParser(Options{})
+		_, err := kmp.ParseAt(k8sAuditStage("a", k8sStageRequestReceived), testPosition("1"))
+		require.ErrorIs(t, err, service.ErrHoldLine)
+		_, err = kmp.ParseAt(k8sAuditStage("b", k8sStageRequestReceived), testPosition("2"))
+		require.ErrorIs(t, err, service.ErrHoldLine)
+
+		_, err = kmp.ParseAt(k8sAuditStage("a", k8sStageResponseComplete), testPosition("3"))
+		require.NoError(t, err)
+		assert.Equal(t, []service.Position{testPosition("1")}, kmp.Merged())
+
+		held, err := kmp.Flush(true)
+		require.NoError(t, err)
+		require.Len(t, held, 1)
+		assert.Equal(t, []service.Position{testPosition("2")}, held[0].Positions)
+	})
+
+	t.Run("stages are not held without merging", func(t *testing.T) {
+		kp := NewK8sAuditLineParser(Options{})
+		_, err := kp.Parse(k8sAuditStage("a", k8sStageRequestReceived))
+		require.NoError(t, err)
+		assert.Empty(t, flushed(t, kp, true))
+	})
+}
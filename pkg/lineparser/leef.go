@@ -0,0 +1,237 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "leef",
+		Description: "IBM QRadar Log Event Extended Format events, optionally with syslog prefix",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewLEEFLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return securityEventSchema(opts,
+				SchemaField{Name: "leef_version", Type: FieldTypeString},
+				SchemaField{Name: "srcPort", Type: FieldTypeInteger},
+				SchemaField{Name: "dstPort", Type: FieldTypeInteger},
+				SchemaField{Name: "cat", Type: FieldTypeString},
+				SchemaField{Name: "proto", Type: FieldTypeString},
+				SchemaField{Name: "identSrc", Type: FieldTypeString},
+				SchemaField{Name: "devTime", Type: FieldTypeTimestamp},
+			), nil
+		},
+	})
+}
+
+// leefAttributeTypes are types of attributes which are not strings
+var leefAttributeTypes = map[string]string{
+	"sev": FieldTypeInteger, "srcPort": FieldTypeInteger, "dstPort": FieldTypeInteger,
+	"srcPreNATPort": FieldTypeInteger, "dstPreNATPort": FieldTypeInteger,
+	"srcPostNATPort": FieldTypeInteger, "dstPostNATPort": FieldTypeInteger,
+	"srcBytes": FieldTypeInteger, "dstBytes": FieldTypeInteger, "totalBytes": FieldTypeInteger,
+	"srcPackets": FieldTypeInteger, "dstPackets": FieldTypeInteger, "totalPackets": FieldTypeInteger,
+	"devTime": FieldTypeTimestamp,
+}
+
+// leefAttributeNames are attributes stored under CEF names, so both formats share indexes
+var leefAttributeNames = map[string]string{
+	"sev":     "severity",
+	"usrName": "suser",
+}
+
+type leefLineParser struct {
+	syslog       *syslogLineParser
+	uidGenerator *uidGenerator
+}
+
+func NewLEEFLineParser(opts Options) *leefLineParser {
+	return &leefLineParser{
+		syslog:       NewSyslogLineParser(opts),
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *leefLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt parses LEEF:1.0|Vendor|Product|Version|EventID|attributes with tab separated
+// attributes, or LEEF:2.0|Vendor|Product|Version|EventID|Delimiter|attributes
+func (p *leefLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	entry, event, err := p.syslog.securityEventPrefix(line, "LEEF:")
+	if err != nil {
+		return nil, err
+	}
+
+	header := splitEscaped(event, '|', 6)
+	if len(header) < 6 {
+		return nil, fmt.Errorf("invalid LEEF header, %d fields", len(header))
+	}
+
+	version := strings.TrimPrefix(header[0], "LEEF:")
+	delimiter := "\t"
+	attributes := header[5]
+	if strings.HasPrefix(version, "2") {
+		header = splitEscaped(event, '|', 7)
+		if len(header) < 7 {
+			return nil, fmt.Errorf("invalid LEEF header, %d fields", len(header))
+		}
+
+		attributes = header[6]
+		if header[5] != "" {
+			delimiter, err = leefDelimiter(header[5])
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if version != "1.0" {
+		return nil, fmt.Errorf("not supported LEEF version %s", version)
+	}
+
+	fields := leefAttributes(attributes, delimiter)
+	layouts := securityEventTimestampLayouts
+	if format, ok := fields["devTimeFormat"]; ok {
+		layout, err := javaTimeLayout(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid devTimeFormat '%s', %w", format, err)
+		}
+		layouts = []string{layout}
+	}
+
+	for k, v := range fields {
+		typed, err := securityEventValue(leefAttributeTypes[k], v, layouts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LEEF attribute %s '%s', %w", k, v, err)
+		}
+
+		if name, ok := leefAttributeNames[k]; ok {
+			k = name
+		}
+		entry[k] = typed
+	}
+
+	entry["leef_version"] = version
+	entry["deviceVendor"] = header[1]
+	entry["deviceProduct"] = header[2]
+	entry["deviceVersion"] = header[3]
+	entry["signatureId"] = header[4]
+
+	// event time, syslog timestamp otherwise
+	if devTime, ok := entry["devTime"]; ok {
+		entry["timestamp"] = devTime
+	}
+
+	return marshalSecurityEvent(p.uidGenerator, entry, line, position)
+}
+
+// leefDelimiter returns delimiter character, or hex encoded one like x5E or 0x5E
+func leefDelimiter(s string) (string, error) {
+	if len(s) == 1 {
+		return s, nil
+	}
+
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0"), "x"))
+	if err != nil || len(b) != 1 {
+		return "", fmt.Errorf("invalid LEEF delimiter '%s'", s)
+	}
+
+	return string(b), nil
+}
+
+// leefAttributes parses key=value pairs, parts without = belong to the previous value
+func leefAttributes(s string, delimiter string) map[string]string {
+	fields := map[string]string{}
+	var last string
+	for _, part := range strings.Split(s, delimiter) {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || key == "" {
+			if last != "" {
+				fields[last] += delimiter + part
+			}
+			continue
+		}
+
+		last = strings.TrimSpace(key)
+		fields[last] = value
+	}
+
+	return fields
+}
+
+// javaTimeTokens are patterns of java SimpleDateFormat used in devTimeFormat
+var javaTimeTokens = map[string]string{
+	"yyyy": "2006", "yy": "06", "MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+	"dd": "02", "d": "2", "HH": "15", "H": "15", "hh": "03", "h": "3", "mm": "04", "m": "4",
+	"ss": "05", "s": "5", "SSS": "000", "a": "PM", "zzz": "MST", "z": "MST", "Z": "-0700",
+	"XXX": "-07:00", "XX": "-0700", "X": "-07", "EEEE": "Monday", "EEE": "Mon",
+}
+
+// javaTimeLayout converts java SimpleDateFormat pattern to go time layout
+func javaTimeLayout(format string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); {
+		c := format[i]
+		switch {
+		case c == '\'' && i+1 < len(format) && format[i+1] == '\'':
+			sb.WriteByte('\'')
+			i += 2
+		case c == '\'':
+			// quoted literal, two quotes within it are a quote
+			j := i + 1
+			for {
+				end := strings.IndexByte(format[j:], '\'')
+				if end < 0 {
+					return "", fmt.Errorf("unterminated quote at position %d", i)
+				}
+				sb.WriteString(format[j : j+end])
+				j += end + 1
+				if j < len(format) && format[j] == '\'' {
+					sb.WriteByte('\'')
+					j++
+					continue
+				}
+				break
+			}
+			i = j
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(format) && format[j] == c {
+				j++
+			}
+
+			layout, ok := javaTimeTokens[format[i:j]]
+			if !ok {
+				return "", fmt.Errorf("not supported pattern %s", format[i:j])
+			}
+			sb.WriteString(layout)
+			i = j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	return sb.String(), nil
+}
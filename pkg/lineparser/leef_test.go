@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLEEFParse(t *testing.T) {
+	type testData struct {
+		line      string
+		expected  map[string]interface{}
+		expectErr bool
+	}
+
+	tdd := []testData{
+		{
+			line: "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5\tcat=anomaly\tsrcPort=81\tdstPort=21\tusrName=joe.black",
+			expected: map[string]interface{}{
+				"leef_version": "1.0", "deviceVendor": "Microsoft", "deviceProduct": "MSExchange", "deviceVersion": "4.0 SP1",
+				"signatureId": "15345", "src": "192.0.2.0", "dst": "172.50.123.1", "severity": float64(5), "cat": "anomaly",
+				"srcPort": float64(81), "dstPort": float64(21), "suser": "joe.black",
+			},
+		},
+		{
+			line: "LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5^url=http://example.com/?a=b^devTime=2023-02-03 22:15:01.123 +0100^devTimeFormat=yyyy-MM-dd HH:mm:ss.SSS Z",
+			expected: map[string]interface{}{
+				"leef_version": "2.0", "deviceVendor": "Lancope", "deviceProduct": "StealthWatch", "deviceVersion": "1.0",
+				"signatureId": "41", "src": "10.0.1.8", "dst": "10.0.0.5", "severity": float64(5), "url": "http://example.com/?a=b",
+				"devTime": "2023-02-03T21:15:01.123Z", "timestamp": "2023-02-03T21:15:01.123Z", "devTimeFormat": "yyyy-MM-dd HH:mm:ss.SSS Z",
+			},
+		},
+		{
+			line: "<13>Feb  3 21:15:01 qradar LEEF:2.0|IBM|QRadar|7.5|login|x5E|usrName=alice^msg=a^b^devTime=Feb 03 2023 21:15:01",
+			expected: map[string]interface{}{
+				"hostname": "qradar", "leef_version": "2.0", "deviceVendor": "IBM", "deviceProduct": "QRadar", "deviceVersion": "7.5",
+				"signatureId": "login", "suser": "alice", "msg": "a^b",
+				"devTime": "2023-02-03T21:15:01Z", "timestamp": "2023-02-03T21:15:01Z",
+			},
+		},
+		{line: "LEEF:3.0|IBM|QRadar|7.5|login|usrName=alice", expectErr: true},
+		{line: "LEEF:2.0|IBM|QRadar|7.5|login|xZZ|usrName=alice", expectErr: true},
+		{line: "LEEF:2.0|IBM|QRadar|7.5|login", expectErr: true},
+		{line: "LEEF:1.0|IBM|QRadar|7.5|login|sev=high", expectErr: true},
+		{line: "LEEF:1.0|IBM|QRadar|7.5|login|devTime=now\tdevTimeFormat=qqq", expectErr: true},
+		{line: "some invalid line that cannot be parsed", expectErr: true},
+	}
+
+	p := NewLEEFLineParser(Options{})
+	for _, td := range tdd {
+		b, err := p.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err, td.line)
+			continue
+		}
+
+		require.NoError(t, err, td.line)
+		assertSecurityEvent(t, td.expected, b)
+	}
+}
+
+func TestJavaTimeLayout(t *testing.T) {
+	for format, expected := range map[string]string{
+		"yyyy-MM-dd'T'HH:mm:ss.SSSXXX": "2006-01-02T15:04:05.000-07:00",
+		"MMM dd yyyy HH:mm:ss":         "Jan 02 2006 15:04:05",
+		"dd/MMM/yyyy:hh:mm:ss a Z":     "02/Jan/2006:03:04:05 PM -0700",
+		"HH 'o''clock'":                "15 o'clock",
+	} {
+		layout, err := javaTimeLayout(format)
+		require.NoError(t, err, format)
+		assert.Equal(t, expected, layout, format)
+	}
+
+	_, err := javaTimeLayout("yyyy-MM-dd'T")
+	assert.Error(t, err)
+}
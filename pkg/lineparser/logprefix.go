@@ -0,0 +1,263 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLogLinePrefix is postgres default log_line_prefix
+const DefaultLogLinePrefix = "%m [%p] "
+
+// patterns of log_line_prefix escapes, values which may contain spaces are matched lazily
+var logLinePrefixEscapes = map[byte]string{
+	'a': `.*?`,                                            // application name
+	'u': `.*?`,                                            // user name
+	'd': `.*?`,                                            // database name
+	'r': `\S*`,                                            // remote host and port
+	'h': `\S*`,                                            // remote host
+	'b': `.*?`,                                            // backend type
+	'p': `\d*`,                                            // process id
+	'P': `\d*`,                                            // parallel group leader process id
+	't': `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} \S+`,        // timestamp without milliseconds
+	'm': `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} \S+`, // timestamp with milliseconds
+	'n': `\d+\.\d{3}`,                                     // timestamp with milliseconds as unix epoch
+	'i': `.*?`,                                            // command tag
+	'e': `[0-9A-Z]{5}`,                                    // SQLSTATE error code
+	'c': `[0-9a-f]+\.[0-9a-f]+`,                           // session id
+	'l': `\d+`,                                            // session line number
+	's': `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} \S+`,        // session start timestamp
+	'v': `\S*`,                                            // virtual transaction id
+	'x': `\d+`,                                            // transaction id
+	'Q': `-?\d+`,                                          // query id
+}
+
+// logLinePrefixFields are named the same as jsonlog fields
+type logLinePrefixFields struct {
+	User            string     `json:"user,omitempty"`
+	DBName          string     `json:"dbname,omitempty"`
+	RemoteHost      string     `json:"remote_host,omitempty"`
+	RemotePort      int        `json:"remote_port,omitempty"`
+	ApplicationName string     `json:"application_name,omitempty"`
+	BackendType     string     `json:"backend_type,omitempty"`
+	PID             int        `json:"pid,omitempty"`
+	LeaderPID       int        `json:"leader_pid,omitempty"`
+	PS              string     `json:"ps,omitempty"`
+	StateCode       string     `json:"state_code,omitempty"`
+	SessionID       string     `json:"session_id,omitempty"`
+	LineNumber      int        `json:"line_num,omitempty"`
+	SessionStart    *time.Time `json:"session_start,omitempty"`
+	VXID            string     `json:"vxid,omitempty"`
+	TXID            int64      `json:"txid,omitempty"`
+	QueryID         int64      `json:"query_id,omitempty"`
+}
+
+// logLinePrefixSchemaFields are fields set by log_line_prefix escapes, indexed the same way
+// as jsonlog fields
+var logLinePrefixSchemaFields = map[byte][]SchemaField{
+	'a': {{Name: "application_name", Type: FieldTypeString}},
+	'u': {{Name: "user", Type: FieldTypeString, Index: true}},
+	'd': {{Name: "dbname", Type: FieldTypeString, Index: true}},
+	'r': {{Name: "remote_host", Type: FieldTypeString}, {Name: "remote_port", Type: FieldTypeInteger}},
+	'h': {{Name: "remote_host", Type: FieldTypeString}},
+	'b': {{Name: "backend_type", Type: FieldTypeString}},
+	'p': {{Name: "pid", Type: FieldTypeInteger}},
+	'P': {{Name: "leader_pid", Type: FieldTypeInteger}},
+	'i': {{Name: "ps", Type: FieldTypeString}},
+	'e': {{Name: "state_code", Type: FieldTypeString}},
+	'c': {{Name: "session_id", Type: FieldTypeString, Index: true}},
+	'l': {{Name: "line_num", Type: FieldTypeInteger}},
+	's': {{Name: "session_start", Type: FieldTypeTimestamp}},
+	'v': {{Name: "vxid", Type: FieldTypeString}},
+	'x': {{Name: "txid", Type: FieldTypeInteger}},
+	'Q': {{Name: "query_id", Type: FieldTypeInteger}},
+}
+
+type logLinePrefix struct {
+	re *regexp.Regexp
+	// escape of each capture group
+	escapes []byte
+}
+
+// newLogLinePrefix compiles postgres log_line_prefix template. Prefix is followed by message
+// severity, which anchors the last escape.
+func newLogLinePrefix(template string) (*logLinePrefix, error) {
+	if template == "" {
+		template = DefaultLogLinePrefix
+	}
+
+	p := &logLinePrefix{}
+	var sb strings.Builder
+	sb.WriteString("^")
+	optional := false
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			sb.WriteString(regexp.QuoteMeta(template[i : i+1]))
+			continue
+		}
+
+		// padding, e.g. %-10u
+		i++
+		padded := false
+		for i < len(template) && (template[i] == '-' || (template[i] >= '0' && template[i] <= '9')) {
+			padded = true
+			i++
+		}
+
+		if i >= len(template) {
+			return nil, errors.New("log line prefix ends with %")
+		}
+
+		escape := template[i]
+		switch escape {
+		case '%':
+			sb.WriteString("%")
+			continue
+		case 'q':
+			// the rest is not printed by non-session processes
+			if !optional {
+				sb.WriteString("(?:")
+				optional = true
+			}
+			continue
+		}
+
+		pattern, ok := logLinePrefixEscapes[escape]
+		if !ok {
+			return nil, fmt.Errorf("not supported log line prefix escape %%%c", escape)
+		}
+
+		if padded {
+			sb.WriteString(" *(" + pattern + ") *")
+		} else {
+			sb.WriteString("(" + pattern + ")")
+		}
+		p.escapes = append(p.escapes, escape)
+	}
+
+	if optional {
+		sb.WriteString(")?")
+	}
+	sb.WriteString(`[A-Z0-9]+:\s+`)
+
+	var err error
+	p.re, err = regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not compile log line prefix, %w", err)
+	}
+
+	return p, nil
+}
+
+// schemaFields returns fields set by escapes of the prefix
+func (p *logLinePrefix) schemaFields() []SchemaField {
+	fields := []SchemaField{}
+	seen := map[string]bool{}
+	for _, escape := range p.escapes {
+		for _, f := range logLinePrefixSchemaFields[escape] {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	return fields
+}
+
+// parse returns prefix fields, timestamp and message following severity
+func (p *logLinePrefix) parse(line string) (*logLinePrefixFields, time.Time, string, error) {
+	var ts time.Time
+	match := p.re.FindStringSubmatchIndex(line)
+	if match == nil {
+		return nil, ts, "", errors.New("invalid log line prefix")
+	}
+
+	fields := &logLinePrefixFields{}
+	for i, escape := range p.escapes {
+		start, end := match[2*i+2], match[2*i+3]
+		if start < 0 {
+			continue
+		}
+
+		v := strings.TrimSpace(line[start:end])
+		if v == "" {
+			continue
+		}
+
+		var err error
+		switch escape {
+		case 'a':
+			fields.ApplicationName = v
+		case 'u':
+			fields.User = v
+		case 'd':
+			fields.DBName = v
+		case 'r':
+			fields.RemoteHost = v
+			if pos := strings.LastIndex(v, "("); pos > 0 && strings.HasSuffix(v, ")") {
+				fields.RemoteHost = v[:pos]
+				fields.RemotePort, err = strconv.Atoi(v[pos+1 : len(v)-1])
+			}
+		case 'h':
+			fields.RemoteHost = v
+		case 'b':
+			fields.BackendType = v
+		case 'p':
+			fields.PID, err = strconv.Atoi(v)
+		case 'P':
+			fields.LeaderPID, err = strconv.Atoi(v)
+		case 't':
+			ts, err = time.Parse("2006-01-02 15:04:05 MST", v)
+		case 'm':
+			ts, err = time.Parse("2006-01-02 15:04:05.000 MST", v)
+		case 'n':
+			var epochMillis int64
+			epochMillis, err = strconv.ParseInt(strings.Replace(v, ".", "", 1), 10, 64)
+			ts = time.UnixMilli(epochMillis).UTC()
+		case 'i':
+			fields.PS = v
+		case 'e':
+			fields.StateCode = v
+		case 'c':
+			fields.SessionID = v
+		case 'l':
+			fields.LineNumber, err = strconv.Atoi(v)
+		case 's':
+			var sessionStart time.Time
+			sessionStart, err = time.Parse("2006-01-02 15:04:05 MST", v)
+			fields.SessionStart = &sessionStart
+		case 'v':
+			fields.VXID = v
+		case 'x':
+			fields.TXID, err = strconv.ParseInt(v, 10, 64)
+		case 'Q':
+			fields.QueryID, err = strconv.ParseInt(v, 10, 64)
+		}
+
+		if err != nil {
+			return nil, ts, "", fmt.Errorf("could not parse log line prefix %%%c '%s', %w", escape, v, err)
+		}
+	}
+
+	return fields, ts, line[match[1]:], nil
+}
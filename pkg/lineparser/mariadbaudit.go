@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "mariadbaudit",
+		Description: "MariaDB server_audit plugin log file",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewMariaDBAuditLineParser(opts), nil
+		},
+		Schema: mysqlAuditSchema,
+	})
+}
+
+// server_audit columns, object and retcode are split from the end as query may contain commas
+const (
+	mariadbTimestamp = iota
+	mariadbServerHost
+	mariadbUsername
+	mariadbHost
+	mariadbConnectionID
+	mariadbQueryID
+	mariadbOperation
+	mariadbDatabase
+	mariadbObjectRetcode
+)
+
+var mariadbUnescaper = strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+
+type mariaDBAuditLineParser struct {
+	uidGenerator *uidGenerator
+}
+
+func NewMariaDBAuditLineParser(opts Options) *mariaDBAuditLineParser {
+	return &mariaDBAuditLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *mariaDBAuditLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt parses line written by server_audit plugin to file,
+// [timestamp],[serverhost],[username],[host],[connectionid],[queryid],[operation],[database],[object],[retcode]
+func (p *mariaDBAuditLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), ",", mariadbObjectRetcode+1)
+	if len(fields) <= mariadbObjectRetcode {
+		return nil, fmt.Errorf("invalid server_audit fields length: %d", len(fields))
+	}
+
+	pos := strings.LastIndex(fields[mariadbObjectRetcode], ",")
+	if pos < 0 {
+		return nil, errors.New("invalid server_audit line, missing retcode")
+	}
+
+	object, retcode := fields[mariadbObjectRetcode][:pos], fields[mariadbObjectRetcode][pos+1:]
+	entry := &mysqlAuditEntry{
+		ServerHost: fields[mariadbServerHost],
+		User:       fields[mariadbUsername],
+		Host:       fields[mariadbHost],
+		Name:       fields[mariadbOperation],
+		DB:         fields[mariadbDatabase],
+	}
+
+	var err error
+	entry.Timestamp, err = time.ParseInLocation("20060102 15:04:05", fields[mariadbTimestamp], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse timestamp '%s': %w", fields[mariadbTimestamp], err)
+	}
+
+	entry.ConnectionID, err = strconv.ParseInt(fields[mariadbConnectionID], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse connection id, %w", err)
+	}
+
+	entry.QueryID, err = strconv.ParseInt(fields[mariadbQueryID], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query id, %w", err)
+	}
+
+	// table events are written without retcode
+	if retcode != "" {
+		entry.Status, err = strconv.Atoi(retcode)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse retcode, %w", err)
+		}
+	}
+
+	switch entry.Name {
+	case "CONNECT":
+		entry.Event = mysqlEventConnect
+	case "DISCONNECT":
+		entry.Event = mysqlEventDisconnect
+	case "FAILED_CONNECT":
+		entry.Event = mysqlEventFailedConnect
+	case "QUERY", "QUERY_DDL", "QUERY_DML", "QUERY_DML_NO_SELECT", "QUERY_DCL":
+		entry.Event = mysqlEventQuery
+		if len(object) >= 2 && object[0] == '\'' && object[len(object)-1] == '\'' {
+			object = mariadbUnescaper.Replace(object[1 : len(object)-1])
+		}
+		entry.Query = object
+		entry.CommandClass = mysqlCommandClass(object)
+	case "READ", "WRITE", "CREATE", "ALTER", "RENAME", "DROP":
+		entry.Event = mysqlEventTable
+		entry.Object = object
+		entry.CommandClass = strings.ToLower(entry.Name)
+	default:
+		return nil, fmt.Errorf("not supported server_audit operation %s", entry.Name)
+	}
+
+	return entry.marshal(p.uidGenerator, line, position)
+}
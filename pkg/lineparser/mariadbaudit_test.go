@@ -0,0 +1,96 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMariaDBAuditParse(t *testing.T) {
+	type testData struct {
+		line      string
+		expected  *mysqlAuditEntry
+		expectErr bool
+	}
+
+	ts := time.Date(2023, 2, 3, 21, 15, 1, 0, time.Local)
+	tdd := []testData{
+		{
+			line: `20230203 21:15:01,db1,root,localhost,12,0,CONNECT,test,,0`,
+			expected: &mysqlAuditEntry{
+				Timestamp: ts, ServerHost: "db1", User: "root", Host: "localhost", ConnectionID: 12,
+				Name: "CONNECT", Event: "connect", DB: "test",
+			},
+		},
+		{
+			line: `20230203 21:15:01,db1,root,localhost,12,45,QUERY,test,'insert into t values (\'a,b\'),(\'c\\d\')',0`,
+			expected: &mysqlAuditEntry{
+				Timestamp: ts, ServerHost: "db1", User: "root", Host: "localhost", ConnectionID: 12, QueryID: 45,
+				Name: "QUERY", Event: "query", CommandClass: "insert", DB: "test", Query: `insert into t values ('a,b'),('c\d')`,
+			},
+		},
+		{
+			line: `20230203 21:15:01,db1,root,localhost,12,46,QUERY_DDL,test,'CREATE TABLE t2 (id int)',1050`,
+			expected: &mysqlAuditEntry{
+				Timestamp: ts, ServerHost: "db1", User: "root", Host: "localhost", ConnectionID: 12, QueryID: 46,
+				Name: "QUERY_DDL", Event: "query", CommandClass: "create", DB: "test", Query: "CREATE TABLE t2 (id int)", Status: 1050,
+			},
+		},
+		{
+			line: `20230203 21:15:01,db1,root,localhost,12,45,WRITE,test,t,`,
+			expected: &mysqlAuditEntry{
+				Timestamp: ts, ServerHost: "db1", User: "root", Host: "localhost", ConnectionID: 12, QueryID: 45,
+				Name: "WRITE", Event: "table", CommandClass: "write", DB: "test", Object: "t",
+			},
+		},
+		{
+			line: `20230203 21:15:01,db1,bob,10.0.0.5,13,0,FAILED_CONNECT,,,1045`,
+			expected: &mysqlAuditEntry{
+				Timestamp: ts, ServerHost: "db1", User: "bob", Host: "10.0.0.5", ConnectionID: 13,
+				Name: "FAILED_CONNECT", Event: "failed_connect", Status: 1045,
+			},
+		},
+		{line: `20230203 21:15:01,db1,root,localhost,12,0,UNKNOWN,test,,0`, expectErr: true},
+		{line: `20230203 21:15:01,db1,root,localhost,x,0,CONNECT,test,,0`, expectErr: true},
+		{line: `2023-02-03 21:15:01,db1,root,localhost,12,0,CONNECT,test,,0`, expectErr: true},
+		{line: `not an audit line`, expectErr: true},
+	}
+
+	p := NewMariaDBAuditLineParser(Options{})
+	for _, td := range tdd {
+		b, err := p.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err, td.line)
+			continue
+		}
+
+		require.NoError(t, err, td.line)
+		var entry mysqlAuditEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.NotEmpty(t, entry.UID)
+		assert.False(t, entry.ServerTimestamp.IsZero())
+		entry.UID, entry.ServerTimestamp = "", time.Time{}
+		assert.True(t, td.expected.Timestamp.Equal(entry.Timestamp))
+		entry.Timestamp = td.expected.Timestamp
+		assert.Equal(t, td.expected, &entry)
+	}
+}
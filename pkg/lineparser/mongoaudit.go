@@ -0,0 +1,217 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "mongoaudit",
+		Description: "MongoDB audit log in JSON format",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewMongoAuditLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return Schema{
+				Fields: []SchemaField{
+					{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+					{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+					{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+					{Name: "atype", Type: FieldTypeString, Size: 64, Index: true},
+					{Name: "user", Type: FieldTypeString, Index: true},
+					{Name: "user_db", Type: FieldTypeString},
+					{Name: "db", Type: FieldTypeString, Index: true},
+					{Name: "ns", Type: FieldTypeString},
+					{Name: "command", Type: FieldTypeString},
+					{Name: "result", Type: FieldTypeInteger, Index: true},
+					{Name: "local_ip", Type: FieldTypeString},
+					{Name: "local_port", Type: FieldTypeInteger},
+					{Name: "remote_ip", Type: FieldTypeString},
+					{Name: "remote_port", Type: FieldTypeInteger},
+					{Name: "connection_uuid", Type: FieldTypeString},
+					{Name: "users", Type: FieldTypeArray},
+					{Name: "roles", Type: FieldTypeArray},
+					{Name: "param", Type: FieldTypeObject},
+				},
+				SequentialID: !opts.deterministicUID(),
+			}, nil
+		},
+	})
+}
+
+type mongoAuditEntry struct {
+	UID             string    `json:"uid"`
+	ServerTimestamp time.Time `json:"server_timestamp"`
+	Timestamp       time.Time `json:"timestamp"`
+	AType           string    `json:"atype"`
+	// User and UserDB are the first of authenticated users
+	User   string `json:"user,omitempty"`
+	UserDB string `json:"user_db,omitempty"`
+	// DB is database of the operation, from param db or namespace
+	DB             string          `json:"db,omitempty"`
+	NS             string          `json:"ns,omitempty"`
+	Command        string          `json:"command,omitempty"`
+	Result         int             `json:"result"`
+	LocalIP        string          `json:"local_ip,omitempty"`
+	LocalPort      int             `json:"local_port,omitempty"`
+	RemoteIP       string          `json:"remote_ip,omitempty"`
+	RemotePort     int             `json:"remote_port,omitempty"`
+	ConnectionUUID string          `json:"connection_uuid,omitempty"`
+	Users          json.RawMessage `json:"users,omitempty"`
+	Roles          json.RawMessage `json:"roles,omitempty"`
+	Param          json.RawMessage `json:"param,omitempty"`
+}
+
+type mongoAuditLineParser struct {
+	uidGenerator *uidGenerator
+}
+
+func NewMongoAuditLineParser(opts Options) *mongoAuditLineParser {
+	return &mongoAuditLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *mongoAuditLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *mongoAuditLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	if !gjson.Valid(line) {
+		return nil, errors.New("not a mongodb audit event, invalid json")
+	}
+
+	r := gjson.Parse(line)
+	entry := &mongoAuditEntry{
+		AType:      r.Get("atype").String(),
+		NS:         r.Get("param.ns").String(),
+		Command:    r.Get("param.command").String(),
+		Result:     int(r.Get("result").Int()),
+		LocalIP:    r.Get("local.ip").String(),
+		LocalPort:  int(r.Get("local.port").Int()),
+		RemoteIP:   r.Get("remote.ip").String(),
+		RemotePort: int(r.Get("remote.port").Int()),
+	}
+
+	if entry.AType == "" {
+		return nil, errors.New("not a mongodb audit event, missing atype")
+	}
+
+	var err error
+	entry.Timestamp, err = mongoAuditTimestamp(r.Get("ts.$date"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mongodb audit event, %w", err)
+	}
+
+	// unix socket connections have path instead of ip and port
+	if entry.LocalIP == "" {
+		entry.LocalIP = r.Get("local.unix").String()
+	}
+	if entry.RemoteIP == "" {
+		entry.RemoteIP = r.Get("remote.unix").String()
+	}
+
+	entry.User = r.Get("users.0.user").String()
+	entry.UserDB = r.Get("users.0.db").String()
+	entry.DB = r.Get("param.db").String()
+	if entry.DB == "" && entry.NS != "" {
+		entry.DB, _, _ = strings.Cut(entry.NS, ".")
+	}
+
+	entry.ConnectionUUID = mongoAuditUUID(r.Get("uuid"))
+	if users := r.Get("users"); users.IsArray() {
+		entry.Users = json.RawMessage(users.Raw)
+	}
+	if roles := r.Get("roles"); roles.IsArray() {
+		entry.Roles = json.RawMessage(roles.Raw)
+	}
+	if param := r.Get("param"); param.IsObject() {
+		entry.Param = json.RawMessage(param.Raw)
+	}
+
+	entry.ServerTimestamp = time.Now().UTC()
+	entry.UID, err = p.uidGenerator.uid(line, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal mongodb audit entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+// older versions write zone offset without colon
+var mongoAuditTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999-0700",
+}
+
+// mongoAuditTimestamp parses $date of relaxed extended json, ISO-8601 string, or canonical
+// extended json, milliseconds since epoch as number or $numberLong
+func mongoAuditTimestamp(date gjson.Result) (time.Time, error) {
+	switch {
+	case date.Type == gjson.String:
+		for _, layout := range mongoAuditTimestampLayouts {
+			ts, err := time.Parse(layout, date.String())
+			if err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("could not parse timestamp '%s'", date.String())
+	case date.Type == gjson.Number:
+		return time.UnixMilli(date.Int()).UTC(), nil
+	case date.Get("$numberLong").Exists():
+		return time.UnixMilli(date.Get("$numberLong").Int()).UTC(), nil
+	default:
+		return time.Time{}, errors.New("missing timestamp")
+	}
+}
+
+// mongoAuditUUID returns connection uuid stored as binary subtype 4, in legacy
+// {"$binary": base64, "$type": "04"} or canonical {"$binary": {"base64": base64, "subType": "04"}} form
+func mongoAuditUUID(r gjson.Result) string {
+	b64 := r.Get("$binary.base64").String()
+	if b64 == "" {
+		b64 = r.Get("$binary").String()
+	}
+
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return ""
+	}
+
+	u, err := uuid.FromBytes(b)
+	if err != nil {
+		return ""
+	}
+
+	return u.String()
+}
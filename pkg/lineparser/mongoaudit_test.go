@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMongoAuditParse(t *testing.T) {
+	type testData struct {
+		line      string
+		expected  *mongoAuditEntry
+		expectErr bool
+	}
+
+	ts := time.Date(2023, 2, 3, 21, 15, 1, 123000000, time.UTC)
+	tdd := []testData{
+		{
+			line: `{ "atype" : "authenticate", "ts" : { "$date" : "2023-02-03T21:15:01.123+00:00" }, "uuid" : { "$binary" : "Z8+hpc2vRrG3Bw+hS9wWsw==", "$type" : "04" }, "local" : { "ip" : "127.0.0.1", "port" : 27017 }, "remote" : { "ip" : "10.0.0.5", "port" : 51234 }, "users" : [ { "user" : "admin", "db" : "admin" } ], "roles" : [ { "role" : "root", "db" : "admin" } ], "param" : { "user" : "admin", "db" : "admin", "mechanism" : "SCRAM-SHA-256" }, "result" : 0 }`,
+			expected: &mongoAuditEntry{
+				Timestamp: ts, AType: "authenticate", User: "admin", UserDB: "admin", DB: "admin",
+				LocalIP: "127.0.0.1", LocalPort: 27017, RemoteIP: "10.0.0.5", RemotePort: 51234,
+				ConnectionUUID: "67cfa1a5-cdaf-46b1-b707-0fa14bdc16b3",
+				Users:          json.RawMessage(`[{"user":"admin","db":"admin"}]`),
+				Roles:          json.RawMessage(`[{"role":"root","db":"admin"}]`),
+				Param:          json.RawMessage(`{"user":"admin","db":"admin","mechanism":"SCRAM-SHA-256"}`),
+			},
+		},
+		{
+			line: `{"atype":"authCheck","ts":{"$date":{"$numberLong":"1675458901123"}},"uuid":{"$binary":{"base64":"Z8+hpc2vRrG3Bw+hS9wWsw==","subType":"04"}},"local":{"unix":"/tmp/mongodb-27017.sock"},"remote":{"unix":"/tmp/mongodb-27017.sock"},"users":[{"user":"app","db":"admin"}],"roles":[],"param":{"command":"find","ns":"shop.orders","args":{"find":"orders"}},"result":13}`,
+			expected: &mongoAuditEntry{
+				Timestamp: ts, AType: "authCheck", User: "app", UserDB: "admin", DB: "shop", NS: "shop.orders", Command: "find", Result: 13,
+				LocalIP: "/tmp/mongodb-27017.sock", RemoteIP: "/tmp/mongodb-27017.sock",
+				ConnectionUUID: "67cfa1a5-cdaf-46b1-b707-0fa14bdc16b3",
+				Users:          json.RawMessage(`[{"user":"app","db":"admin"}]`),
+				Roles:          json.RawMessage(`[]`),
+				Param:          json.RawMessage(`{"command":"find","ns":"shop.orders","args":{"find":"orders"}}`),
+			},
+		},
+		{
+			line: `{"atype":"dropDatabase","ts":{"$date":"2023-02-03T22:15:01.123+0100"},"local":{"ip":"127.0.0.1","port":27017},"remote":{"ip":"127.0.0.1","port":40000},"users":[],"roles":[],"param":{"ns":"shop"},"result":0}`,
+			expected: &mongoAuditEntry{
+				Timestamp: ts, AType: "dropDatabase", DB: "shop", NS: "shop",
+				LocalIP: "127.0.0.1", LocalPort: 27017, RemoteIP: "127.0.0.1", RemotePort: 40000,
+				Users: json.RawMessage(`[]`),
+				Roles: json.RawMessage(`[]`),
+				Param: json.RawMessage(`{"ns":"shop"}`),
+			},
+		},
+		{line: `{"ts":{"$date":"2023-02-03T21:15:01.123+00:00"},"result":0}`, expectErr: true},
+		{line: `{"atype":"authenticate","result":0}`, expectErr: true},
+		{line: `{"atype":"authenticate","ts":{"$date":"yesterday"}}`, expectErr: true},
+		{line: `some invalid line that cannot be parsed`, expectErr: true},
+	}
+
+	p := NewMongoAuditLineParser(Options{})
+	for _, td := range tdd {
+		b, err := p.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err, td.line)
+			assert.Nil(t, b)
+			continue
+		}
+
+		require.NoError(t, err, td.line)
+		var entry mongoAuditEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.NotEmpty(t, entry.UID)
+		assert.False(t, entry.ServerTimestamp.IsZero())
+		assert.True(t, td.expected.Timestamp.Equal(entry.Timestamp), entry.Timestamp)
+
+		// compare json of flattened fields, raw fields are compacted when marshaled
+		entry.UID, entry.ServerTimestamp, entry.Timestamp = "", time.Time{}, td.expected.Timestamp
+		expected, err := json.Marshal(td.expected)
+		require.NoError(t, err)
+		actual, err := json.Marshal(entry)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(expected), string(actual))
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+// normalized events of mysql audit entries, other events are stored lowercased
+const (
+	mysqlEventConnect       = "connect"
+	mysqlEventDisconnect    = "disconnect"
+	mysqlEventFailedConnect = "failed_connect"
+	mysqlEventQuery         = "query"
+	mysqlEventTable         = "table"
+)
+
+// mysqlAuditEntry is common shape of MariaDB, Percona and MySQL Enterprise audit records
+type mysqlAuditEntry struct {
+	UID             string    `json:"uid"`
+	ServerTimestamp time.Time `json:"server_timestamp"`
+	Timestamp       time.Time `json:"timestamp"`
+	// Name is event name as written in the audit log
+	Name string `json:"name"`
+	// Event is normalized event, connect, disconnect, failed_connect, query or table
+	Event string `json:"event"`
+	// CommandClass is sql command, e.g. select or create_table, or table operation
+	CommandClass string `json:"command_class,omitempty"`
+	User         string `json:"user"`
+	Host         string `json:"host,omitempty"`
+	IP           string `json:"ip,omitempty"`
+	OSUser       string `json:"os_user,omitempty"`
+	DB           string `json:"db,omitempty"`
+	Query        string `json:"query,omitempty"`
+	Object       string `json:"object,omitempty"`
+	Status       int    `json:"status"`
+	ConnectionID int64  `json:"connection_id"`
+	QueryID      int64  `json:"query_id,omitempty"`
+	Record       string `json:"record,omitempty"`
+	ServerHost   string `json:"server_host,omitempty"`
+}
+
+func mysqlAuditSchema(opts Options) (Schema, error) {
+	return Schema{
+		Fields: []SchemaField{
+			{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+			{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+			{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+			{Name: "name", Type: FieldTypeString},
+			{Name: "event", Type: FieldTypeString, Size: 32, Index: true},
+			{Name: "command_class", Type: FieldTypeString, Size: 64, Index: true},
+			{Name: "user", Type: FieldTypeString, Index: true},
+			{Name: "host", Type: FieldTypeString, Index: true},
+			{Name: "ip", Type: FieldTypeString},
+			{Name: "os_user", Type: FieldTypeString},
+			{Name: "db", Type: FieldTypeString, Index: true},
+			{Name: "query", Type: FieldTypeString},
+			{Name: "object", Type: FieldTypeString},
+			{Name: "status", Type: FieldTypeInteger, Index: true},
+			{Name: "connection_id", Type: FieldTypeInteger, Index: true},
+			{Name: "query_id", Type: FieldTypeInteger},
+			{Name: "record", Type: FieldTypeString},
+			{Name: "server_host", Type: FieldTypeString},
+		},
+		SequentialID: !opts.deterministicUID(),
+	}, nil
+}
+
+// marshal sets uid and server timestamp of the entry
+func (e *mysqlAuditEntry) marshal(g *uidGenerator, record string, position service.Position) ([]byte, error) {
+	var err error
+	e.ServerTimestamp = time.Now().UTC()
+	e.UID, err = g.uid(record, position, e)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal mysql audit entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+// mysqlCommandClass returns lowercased first keyword of the query
+func mysqlCommandClass(query string) string {
+	fields := strings.Fields(strings.TrimLeft(query, "( \t\n"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimRight(fields[0], ";("))
+}
+
+// Percona combined user, e.g. root[root] @ localhost [127.0.0.1]
+var perconaUser = regexp.MustCompile(`^([^\[]*)\[[^\]]*\] @ (\S*) \[([^\]]*)\]$`)
+
+// perconaAuditEntry normalizes Percona and MySQL Enterprise record fields, with lowercased
+// names of JSON keys or XML attributes and elements
+func perconaAuditEntry(fields map[string]string) (*mysqlAuditEntry, error) {
+	entry := &mysqlAuditEntry{
+		Name:         fields["name"],
+		CommandClass: fields["command_class"],
+		User:         fields["user"],
+		Host:         fields["host"],
+		IP:           fields["ip"],
+		OSUser:       fields["os_user"],
+		DB:           fields["db"],
+		Query:        fields["sqltext"],
+		Record:       fields["record"],
+	}
+
+	// MySQL Enterprise XML record id
+	if entry.Record == "" {
+		entry.Record = fields["record_id"]
+	}
+
+	if entry.Name == "" {
+		return nil, errors.New("missing audit record name")
+	}
+
+	var err error
+	entry.Timestamp, err = parseMySQLAuditTimestamp(fields["timestamp"])
+	if err != nil {
+		return nil, err
+	}
+
+	if m := perconaUser.FindStringSubmatch(entry.User); m != nil {
+		entry.User = m[1]
+		if entry.Host == "" {
+			entry.Host = m[2]
+		}
+		if entry.IP == "" {
+			entry.IP = m[3]
+		}
+	}
+
+	if s := fields["status"]; s != "" {
+		entry.Status, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status, %w", err)
+		}
+	}
+
+	if c := fields["connection_id"]; c != "" {
+		entry.ConnectionID, err = strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection id, %w", err)
+		}
+	}
+
+	switch strings.ToLower(entry.Name) {
+	case "connect":
+		entry.Event = mysqlEventConnect
+		if entry.Status != 0 {
+			entry.Event = mysqlEventFailedConnect
+		}
+	case "quit":
+		entry.Event = mysqlEventDisconnect
+	case "query", "execute", "prepare":
+		entry.Event = mysqlEventQuery
+	default:
+		entry.Event = strings.ToLower(entry.Name)
+	}
+
+	if entry.CommandClass == "" && entry.Event == mysqlEventQuery {
+		entry.CommandClass = mysqlCommandClass(entry.Query)
+	}
+
+	return entry, nil
+}
+
+// Percona writes timestamps in UTC with zone name, MySQL Enterprise JSON without zone
+var mysqlAuditTimestampLayouts = []string{
+	"2006-01-02T15:04:05 MST",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+}
+
+func parseMySQLAuditTimestamp(s string) (time.Time, error) {
+	for _, layout := range mysqlAuditTimestampLayouts {
+		ts, err := time.Parse(layout, s)
+		if err == nil {
+			return ts, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse timestamp '%s'", s)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "mysqlauditjson",
+		Description: "Percona Server and MySQL Enterprise audit_log plugin JSON log, pretty printed records are assembled by opening brace",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewMySQLAuditJSONLineParser(opts), nil
+		},
+		Schema: mysqlAuditSchema,
+		// MySQL Enterprise writes pretty printed array of records, nested objects do not
+		// start a line
+		Multiline: service.MultilineOptions{
+			Start: `^\s*\{`,
+		},
+	})
+}
+
+type mysqlAuditJSONLineParser struct {
+	uidGenerator *uidGenerator
+}
+
+func NewMySQLAuditJSONLineParser(opts Options) *mysqlAuditJSONLineParser {
+	return &mysqlAuditJSONLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *mysqlAuditJSONLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt parses Percona record, written one per line, or MySQL Enterprise record. Lines of
+// pretty printed records are expected to be assembled before they are parsed, see parser
+// Multiline options. Array brackets and separators are ignored.
+func (p *mysqlAuditJSONLineParser) ParseAt(record string, position service.Position) ([]byte, error) {
+	record = strings.TrimSpace(strings.Trim(strings.TrimSpace(record), "[],"))
+	if record == "" {
+		return nil, fmt.Errorf("not a json audit record, %w", service.ErrSkipLine)
+	}
+
+	if !gjson.Valid(record) {
+		return nil, errors.New("invalid json audit record")
+	}
+
+	var entry *mysqlAuditEntry
+	var err error
+	r := gjson.Parse(record)
+	if ar := r.Get("audit_record"); ar.Exists() {
+		entry, err = perconaAuditEntry(mysqlAuditJSONFields(ar))
+	} else if r.Get("class").Exists() {
+		entry, err = mysqlEnterpriseAuditEntry(r)
+	} else {
+		return nil, errors.New("not a Percona or MySQL Enterprise audit record")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.marshal(p.uidGenerator, record, position)
+}
+
+func mysqlAuditJSONFields(r gjson.Result) map[string]string {
+	fields := map[string]string{}
+	r.ForEach(func(key, value gjson.Result) bool {
+		fields[strings.ToLower(key.String())] = value.String()
+		return true
+	})
+
+	return fields
+}
+
+// mysqlEnterpriseAuditEntry normalizes MySQL Enterprise JSON record, event data are stored in
+// class specific objects
+func mysqlEnterpriseAuditEntry(r gjson.Result) (*mysqlAuditEntry, error) {
+	class := r.Get("class").String()
+	name := r.Get("event").String()
+	entry := &mysqlAuditEntry{
+		Name:         class + "." + name,
+		User:         r.Get("account.user").String(),
+		Host:         r.Get("account.host").String(),
+		IP:           r.Get("login.ip").String(),
+		OSUser:       r.Get("login.os").String(),
+		ConnectionID: r.Get("connection_id").Int(),
+		Record:       r.Get("id").String(),
+	}
+
+	var err error
+	entry.Timestamp, err = parseMySQLAuditTimestamp(r.Get("timestamp").String())
+	if err != nil {
+		return nil, err
+	}
+
+	switch class {
+	case "connection":
+		entry.DB = r.Get("connection_data.db").String()
+		entry.Status = int(r.Get("connection_data.status").Int())
+		switch name {
+		case "connect":
+			entry.Event = mysqlEventConnect
+			if entry.Status != 0 {
+				entry.Event = mysqlEventFailedConnect
+			}
+		case "disconnect":
+			entry.Event = mysqlEventDisconnect
+		default:
+			entry.Event = name
+		}
+		entry.CommandClass = name
+	case "general":
+		entry.Event = mysqlEventQuery
+		entry.Query = r.Get("general_data.query").String()
+		entry.Status = int(r.Get("general_data.status").Int())
+		entry.CommandClass = r.Get("general_data.sql_command").String()
+		if entry.CommandClass == "" {
+			entry.CommandClass = mysqlCommandClass(entry.Query)
+		}
+	case "table_access":
+		entry.Event = mysqlEventTable
+		entry.DB = r.Get("table_access_data.db").String()
+		entry.Object = r.Get("table_access_data.table").String()
+		entry.Query = r.Get("table_access_data.query").String()
+		entry.CommandClass = name
+	default:
+		entry.Event = name
+	}
+
+	return entry, nil
+}
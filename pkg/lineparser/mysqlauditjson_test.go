@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLAuditJSONPercona(t *testing.T) {
+	p := NewMySQLAuditJSONLineParser(Options{})
+
+	b, err := p.Parse(`{"audit_record":{"name":"Query","record":"4_2023-02-03T21:15:01","timestamp":"2023-02-03T21:15:01 UTC","command_class":"select","connection_id":"12","status":0,"sqltext":"select * from t where a = \"{\"","user":"root[root] @ localhost [127.0.0.1]","host":"localhost","os_user":"","ip":"","db":"test"}}`)
+	require.NoError(t, err)
+
+	var entry mysqlAuditEntry
+	require.NoError(t, json.Unmarshal(b, &entry))
+	assert.NotEmpty(t, entry.UID)
+	assert.Equal(t, time.Date(2023, 2, 3, 21, 15, 1, 0, time.UTC), entry.Timestamp.UTC())
+	assert.Equal(t, "Query", entry.Name)
+	assert.Equal(t, mysqlEventQuery, entry.Event)
+	assert.Equal(t, "select", entry.CommandClass)
+	assert.Equal(t, "root", entry.User)
+	assert.Equal(t, "localhost", entry.Host)
+	assert.Equal(t, "127.0.0.1", entry.IP)
+	assert.Equal(t, "test", entry.DB)
+	assert.Equal(t, `select * from t where a = "{"`, entry.Query)
+	assert.Equal(t, int64(12), entry.ConnectionID)
+	assert.Equal(t, "4_2023-02-03T21:15:01", entry.Record)
+
+	b, err = p.Parse(`{"audit_record":{"name":"Connect","record":"5_2023-02-03T21:15:01","timestamp":"2023-02-03T21:15:02 UTC","connection_id":"13","status":1045,"user":"bob","priv_user":"","os_login":"","proxy_user":"","host":"","ip":"10.0.0.5","db":""}}`)
+	require.NoError(t, err)
+	entry = mysqlAuditEntry{}
+	require.NoError(t, json.Unmarshal(b, &entry))
+	assert.Equal(t, mysqlEventFailedConnect, entry.Event)
+	assert.Equal(t, 1045, entry.Status)
+	assert.Equal(t, "bob", entry.User)
+
+	_, err = p.Parse(`{"audit_record":{"timestamp":"2023-02-03T21:15:02 UTC"}}`)
+	assert.Error(t, err)
+
+	_, err = p.Parse(`{"other":1}`)
+	assert.Error(t, err)
+
+	_, err = p.Parse(`{"audit_record":`)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrSkipLine)
+	_, err = p.Parse(`[`)
+	assert.ErrorIs(t, err, service.ErrSkipLine)
+	_, err = p.Parse(`{"name":"Quit","timestamp":"invalid"}}`)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrSkipLine)
+}
+
+func TestMySQLAuditJSONEnterprise(t *testing.T) {
+	lines := []string{
+		`[`,
+		`  {`,
+		`    "timestamp": "2023-02-03 21:15:01",`,
+		`    "id": 0,`,
+		`    "class": "general",`,
+		`    "event": "status",`,
+		`    "connection_id": 12,`,
+		`    "account": { "user": "root", "host": "localhost" },`,
+		`    "login": { "user": "root", "os": "", "ip": "127.0.0.1", "proxy": "" },`,
+		`    "general_data": {`,
+		`      "command": "Query",`,
+		`      "sql_command": "insert",`,
+		`      "query": "INSERT INTO t VALUES ('}')",`,
+		`      "status": 0 }`,
+		`  },`,
+		`  {`,
+		`    "timestamp": "2023-02-03 21:15:02",`,
+		`    "id": 1,`,
+		`    "class": "connection",`,
+		`    "event": "disconnect",`,
+		`    "connection_id": 12,`,
+		`    "account": { "user": "root", "host": "localhost" },`,
+		`    "login": { "user": "root", "os": "", "ip": "127.0.0.1", "proxy": "" },`,
+		`    "connection_data": { "connection_type": "tcp/ip" }`,
+		`  }`,
+		`]`,
+	}
+
+	p := NewMySQLAuditJSONLineParser(Options{})
+	var entries []mysqlAuditEntry
+	records := assembleRecords(t, "mysqlauditjson", lines)
+	require.Len(t, records, 3)
+	for i, r := range records {
+		b, err := p.Parse(r)
+		if err != nil {
+			require.ErrorIs(t, err, service.ErrSkipLine, "record %d", i)
+			continue
+		}
+
+		var entry mysqlAuditEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, "general.status", entries[0].Name)
+	assert.Equal(t, mysqlEventQuery, entries[0].Event)
+	assert.Equal(t, "insert", entries[0].CommandClass)
+	assert.Equal(t, "INSERT INTO t VALUES ('}')", entries[0].Query)
+	assert.Equal(t, "root", entries[0].User)
+	assert.Equal(t, "127.0.0.1", entries[0].IP)
+	assert.Equal(t, int64(12), entries[0].ConnectionID)
+	assert.Equal(t, time.Date(2023, 2, 3, 21, 15, 1, 0, time.UTC), entries[0].Timestamp.UTC())
+
+	assert.Equal(t, "connection.disconnect", entries[1].Name)
+	assert.Equal(t, mysqlEventDisconnect, entries[1].Event)
+	assert.Equal(t, "1", entries[1].Record)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "mysqlauditxml",
+		Description: "Percona Server and MySQL Enterprise audit_log plugin XML log, records spanning multiple lines are assembled by AUDIT_RECORD element",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewMySQLAuditXMLLineParser(opts), nil
+		},
+		Schema: mysqlAuditSchema,
+		Multiline: service.MultilineOptions{
+			Start: `^\s*<AUDIT_RECORD`,
+		},
+	})
+}
+
+const mysqlAuditXMLRecord = "AUDIT_RECORD"
+
+type mysqlAuditXMLLineParser struct {
+	uidGenerator *uidGenerator
+}
+
+func NewMySQLAuditXMLLineParser(opts Options) *mysqlAuditXMLLineParser {
+	return &mysqlAuditXMLLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *mysqlAuditXMLLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt parses AUDIT_RECORD element, with fields as attributes (Percona OLD format) or child
+// elements (Percona NEW format and MySQL Enterprise). Lines of the element are expected to be
+// assembled before they are parsed, see parser Multiline options. Document header and AUDIT
+// element lines are skipped.
+func (p *mysqlAuditXMLLineParser) ParseAt(record string, position service.Position) ([]byte, error) {
+	if !strings.Contains(record, "<"+mysqlAuditXMLRecord) {
+		return nil, fmt.Errorf("not an audit record, %w", service.ErrSkipLine)
+	}
+
+	fields, err := mysqlAuditXMLFields(record)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := perconaAuditEntry(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.marshal(p.uidGenerator, record, position)
+}
+
+// mysqlAuditXMLFields returns attributes and child elements of AUDIT_RECORD with lowercased names
+func mysqlAuditXMLFields(record string) (map[string]string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(record[strings.Index(record, "<"+mysqlAuditXMLRecord):]))
+	fields := map[string]string{}
+	depth := 0
+	var name string
+	var value strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("unterminated xml audit record")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid xml audit record, %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				for _, a := range t.Attr {
+					fields[strings.ToLower(a.Name.Local)] = a.Value
+				}
+			} else if depth == 2 {
+				name = strings.ToLower(t.Name.Local)
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				fields[name] = value.String()
+			}
+
+			depth--
+			if depth == 0 {
+				return fields, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLAuditXMLParse(t *testing.T) {
+	type testData struct {
+		name  string
+		lines []string
+	}
+
+	tdd := []testData{
+		{
+			name: "percona new format",
+			lines: []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				`<AUDIT>`,
+				`<AUDIT_RECORD>`,
+				` <NAME>Query</NAME>`,
+				` <RECORD>4_2023-02-03T21:15:01</RECORD>`,
+				` <TIMESTAMP>2023-02-03T21:15:01 UTC</TIMESTAMP>`,
+				` <COMMAND_CLASS>select</COMMAND_CLASS>`,
+				` <CONNECTION_ID>12</CONNECTION_ID>`,
+				` <STATUS>0</STATUS>`,
+				` <SQLTEXT>select * from t where a &lt; 1</SQLTEXT>`,
+				` <USER>root[root] @ localhost [127.0.0.1]</USER>`,
+				` <HOST>localhost</HOST>`,
+				` <OS_USER></OS_USER>`,
+				` <IP></IP>`,
+				` <DB>test</DB>`,
+				`</AUDIT_RECORD>`,
+				`</AUDIT>`,
+			},
+		},
+		{
+			name: "percona old format",
+			lines: []string{
+				`<AUDIT_RECORD`,
+				`  NAME="Query"`,
+				`  RECORD="4_2023-02-03T21:15:01"`,
+				`  TIMESTAMP="2023-02-03T21:15:01 UTC"`,
+				`  COMMAND_CLASS="select"`,
+				`  CONNECTION_ID="12"`,
+				`  STATUS="0"`,
+				`  SQLTEXT="select * from t where a &lt; 1"`,
+				`  USER="root[root] @ localhost [127.0.0.1]"`,
+				`  HOST="localhost"`,
+				`  OS_USER=""`,
+				`  IP=""`,
+				`  DB="test"`,
+				`/>`,
+			},
+		},
+	}
+
+	for _, td := range tdd {
+		t.Run(td.name, func(t *testing.T) {
+			p := NewMySQLAuditXMLLineParser(Options{})
+			var entries []mysqlAuditEntry
+			for i, r := range assembleRecords(t, "mysqlauditxml", td.lines) {
+				b, err := p.Parse(r)
+				if err != nil {
+					require.ErrorIs(t, err, service.ErrSkipLine, "record %d", i)
+					continue
+				}
+
+				var entry mysqlAuditEntry
+				require.NoError(t, json.Unmarshal(b, &entry))
+				entries = append(entries, entry)
+			}
+
+			require.Len(t, entries, 1)
+			entry := entries[0]
+			assert.NotEmpty(t, entry.UID)
+			assert.Equal(t, time.Date(2023, 2, 3, 21, 15, 1, 0, time.UTC), entry.Timestamp.UTC())
+			assert.Equal(t, "Query", entry.Name)
+			assert.Equal(t, mysqlEventQuery, entry.Event)
+			assert.Equal(t, "select", entry.CommandClass)
+			assert.Equal(t, "root", entry.User)
+			assert.Equal(t, "localhost", entry.Host)
+			assert.Equal(t, "127.0.0.1", entry.IP)
+			assert.Equal(t, "test", entry.DB)
+			assert.Equal(t, "select * from t where a < 1", entry.Query)
+			assert.Equal(t, int64(12), entry.ConnectionID)
+		})
+	}
+
+	p := NewMySQLAuditXMLLineParser(Options{})
+	_, err := p.Parse(`<AUDIT_RECORD NAME="Query" TIMESTAMP="invalid"/>`)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrSkipLine)
+
+	_, err = p.Parse(`<AUDIT_RECORD NAME="Query" TIMESTAMP="2023-02-03T21:15:01 UTC" <broken/>`)
+	assert.Error(t, err)
+
+	// unterminated record, e.g. assembly flushed by max lines
+	_, err = p.Parse("<AUDIT_RECORD>\n <NAME>Query</NAME>")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrSkipLine)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	UIDModeRandom  = "random"  // new random uuid for each entry
+	UIDModeContent = "content" // derived from line position and content
+	UIDModeFields  = "fields"  // derived from selected fields of parsed entry
+)
+
+// namespace of deterministic uids
+var uidNamespace = uuid.MustParse("8c5c3a4e-4b43-4c4b-9a5e-2f0c7a0d6b1e")
+
+// Options are stored together with collection configuration, so the collection is always
+// parsed the same way.
+type Options struct {
+	UIDMode   string   `json:"uid_mode,omitempty"`
+	UIDFields []string `json:"uid_fields,omitempty"`
+	// LogLinePrefix is postgres log_line_prefix used by pgaudit stderr parser
+	LogLinePrefix string `json:"log_line_prefix,omitempty"`
+	// LogFormat is nginx log_format used by nginx access log parser
+	LogFormat string `json:"log_format,omitempty"`
+	// Definition describes line format parsed by custom parser
+	Definition *Definition `json:"definition,omitempty"`
+}
+
+func (o Options) Validate() error {
+	switch o.UIDMode {
+	case "", UIDModeRandom, UIDModeContent:
+		if len(o.UIDFields) > 0 {
+			return fmt.Errorf("uid fields can be used only with uid mode %s", UIDModeFields)
+		}
+	case UIDModeFields:
+		if len(o.UIDFields) == 0 {
+			return fmt.Errorf("uid mode %s requires uid fields", UIDModeFields)
+		}
+	default:
+		return fmt.Errorf("not supported uid mode: %s", o.UIDMode)
+	}
+
+	_, err := newLogLinePrefix(o.LogLinePrefix)
+	if err != nil {
+		return fmt.Errorf("invalid log line prefix, %w", err)
+	}
+
+	_, err = newAccessLogFormat(o.LogFormat)
+	if err != nil {
+		return fmt.Errorf("invalid log format, %w", err)
+	}
+
+	if o.Definition != nil {
+		err = o.Definition.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid parser definition, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deterministicUID is true when the same line is always stored with the same uid
+func (o Options) deterministicUID() bool {
+	return o.UIDMode != "" && o.UIDMode != UIDModeRandom
+}
+
+type uidGenerator struct {
+	mode   string
+	fields []string
+}
+
+func newUIDGenerator(opts Options) *uidGenerator {
+	return &uidGenerator{
+		mode:   opts.UIDMode,
+		fields: opts.UIDFields,
+	}
+}
+
+// uid returns random uid, or uuid v5 of line position and content, or of selected entry fields.
+// Entry is marshaled with empty uid for fields mode.
+func (g *uidGenerator) uid(line string, position service.Position, entry interface{}) (string, error) {
+	switch g.mode {
+	case UIDModeContent:
+		data := line
+		if position != nil {
+			data = position.String() + "\x00" + line
+		}
+
+		return uuid.NewSHA1(uidNamespace, []byte(data)).String(), nil
+	case UIDModeFields:
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal entry, %w", err)
+		}
+
+		data := []byte{}
+		for _, f := range g.fields {
+			r := gjson.GetBytes(b, f)
+			if !r.Exists() {
+				return "", fmt.Errorf("missing uid field %s", f)
+			}
+
+			data = append(data, []byte(r.Raw)...)
+			data = append(data, 0)
+		}
+
+		return uuid.NewSHA1(uidNamespace, data).String(), nil
+	default:
+		return uuid.New().String(), nil
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type testPosition string
+
+func (p testPosition) String() string {
+	return string(p)
+}
+
+func TestUIDModes(t *testing.T) {
+	line := `{"timestamp":"2023-05-13 21:09:08.502 GMT","user":"postgres","dbname":"postgres","pid":138,"remote_host":"172.22.0.1","remote_port":58300,"session_id":"645ffc74.8a","line_num":1,"ps":"CREATE TABLE","session_start":"2023-05-13 21:09:08 GMT","message":"AUDIT: SESSION,1,1,DDL,CREATE TABLE,,,\"create table t (id VARCHAR);\",<not logged>"}`
+
+	uid := func(p *pgAuditJSONLogLineParser, position testPosition) string {
+		b, err := p.ParseAt(line, position)
+		require.NoError(t, err)
+		return gjson.GetBytes(b, "uid").String()
+	}
+
+	random := NewPGAuditJSONLogLineParser(Options{})
+	assert.NotEqual(t, uid(random, "file:1"), uid(random, "file:1"))
+
+	content := NewPGAuditJSONLogLineParser(Options{UIDMode: UIDModeContent})
+	assert.Equal(t, uid(content, "file:1"), uid(content, "file:1"))
+	assert.NotEqual(t, uid(content, "file:1"), uid(content, "file:2"))
+	assert.Len(t, uid(content, "file:1"), 36)
+
+	fields := NewPGAuditJSONLogLineParser(Options{UIDMode: UIDModeFields, UIDFields: []string{"session_id", "statement_id", "substatement_id"}})
+	assert.Equal(t, uid(fields, "file:1"), uid(fields, "file:2"))
+	assert.NotEqual(t, uid(content, "file:1"), uid(fields, "file:1"))
+
+	missing := NewPGAuditJSONLogLineParser(Options{UIDMode: UIDModeFields, UIDFields: []string{"not_existing"}})
+	_, err := missing.Parse(line)
+	assert.Error(t, err)
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.NoError(t, Options{}.Validate())
+	assert.NoError(t, Options{UIDMode: UIDModeContent}.Validate())
+	assert.NoError(t, Options{UIDMode: UIDModeFields, UIDFields: []string{"session_id"}}.Validate())
+	assert.Error(t, Options{UIDMode: UIDModeFields}.Validate())
+	assert.Error(t, Options{UIDMode: UIDModeRandom, UIDFields: []string{"session_id"}}.Validate())
+	assert.Error(t, Options{UIDMode: "unknown"}.Validate())
+	assert.NoError(t, Options{LogFormat: "$remote_addr [$time_iso8601] $status"}.Validate())
+	assert.Error(t, Options{LogFormat: "static text"}.Validate())
+}
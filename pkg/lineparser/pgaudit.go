@@ -35,6 +35,29 @@ type pgAuditEntry struct {
 	Parameter      string `json:"parameter,omitempty"`
 }
 
+// pgAuditSchemaFields are fields of pgaudit message, common for all pgaudit parsers
+var pgAuditSchemaFields = []SchemaField{
+	{Name: "audit_type", Type: FieldTypeString, Index: true},
+	{Name: "statement_id", Type: FieldTypeInteger, Index: true},
+	{Name: "substatement_id", Type: FieldTypeInteger, Index: true},
+	{Name: "class", Type: FieldTypeString, Index: true},
+	{Name: "command", Type: FieldTypeString, Index: true},
+	{Name: "object_type", Type: FieldTypeString},
+	{Name: "object_name", Type: FieldTypeString},
+	{Name: "statement", Type: FieldTypeString},
+	{Name: "parameter", Type: FieldTypeString},
+}
+
+// pgAuditSchema returns given log fields followed by pgaudit fields. Entries are stored in
+// SQL collections with sequential ids, with deterministic uids the uid is used instead so
+// re-ingested lines are upserted.
+func pgAuditSchema(opts Options, fields []SchemaField) Schema {
+	return Schema{
+		Fields:       append(append([]SchemaField{}, fields...), pgAuditSchemaFields...),
+		SequentialID: !opts.deterministicUID(),
+	}
+}
+
 // converts pgaudit log line after AUDIT:
 func toPgauditEntry(s string) (*pgAuditEntry, error) {
 	csvReader := csv.NewReader(strings.NewReader(s))
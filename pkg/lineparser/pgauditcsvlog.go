@@ -0,0 +1,284 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "pgauditcsvlog",
+		Description: "pgaudit entries from postgres csvlog log, records spanning multiple lines are assembled by balanced quotes",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewPGAuditCSVLogLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return pgAuditSchema(opts, []SchemaField{
+				{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+				{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+				{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+				{Name: "user", Type: FieldTypeString, Index: true},
+				{Name: "dbname", Type: FieldTypeString, Index: true},
+				{Name: "pid", Type: FieldTypeInteger},
+				{Name: "remote_host", Type: FieldTypeString},
+				{Name: "remote_port", Type: FieldTypeInteger},
+				{Name: "session_id", Type: FieldTypeString, Index: true},
+				{Name: "line_num", Type: FieldTypeInteger},
+				{Name: "ps", Type: FieldTypeString},
+				{Name: "session_start", Type: FieldTypeTimestamp},
+				{Name: "vxid", Type: FieldTypeString},
+				{Name: "txid", Type: FieldTypeInteger},
+				{Name: "error_severity", Type: FieldTypeString},
+				{Name: "state_code", Type: FieldTypeString},
+				{Name: "application_name", Type: FieldTypeString},
+				{Name: "backend_type", Type: FieldTypeString},
+				{Name: "leader_pid", Type: FieldTypeInteger},
+				{Name: "query_id", Type: FieldTypeInteger},
+			}), nil
+		},
+		// quoted fields may span multiple lines, record ends when its quotes are balanced
+		Multiline: service.MultilineOptions{
+			Quote: `"`,
+		},
+	})
+}
+
+// csvlog columns, backend_type is available since postgres 13, leader_pid and query_id since 14
+const (
+	csvLogTime = iota
+	csvUserName
+	csvDatabaseName
+	csvProcessID
+	csvConnectionFrom
+	csvSessionID
+	csvSessionLineNum
+	csvCommandTag
+	csvSessionStartTime
+	csvVirtualTransactionID
+	csvTransactionID
+	csvErrorSeverity
+	csvSQLStateCode
+	csvMessage
+	csvDetail
+	csvHint
+	csvInternalQuery
+	csvInternalQueryPos
+	csvContext
+	csvQuery
+	csvQueryPos
+	csvLocation
+	csvApplicationName
+	csvBackendType
+	csvLeaderPID
+	csvQueryID
+)
+
+type pgAuditCSVLogEntry struct {
+	pgAuditEntry
+	UID             string    `json:"uid"`
+	ServerTimestamp time.Time `json:"server_timestamp"`
+	Timestamp       time.Time `json:"timestamp"`
+	User            string    `json:"user"`
+	DBName          string    `json:"dbname"`
+	PID             int       `json:"pid"`
+	RemoteHost      string    `json:"remote_host"`
+	RemotePort      int       `json:"remote_port,omitempty"`
+	SessionID       string    `json:"session_id"`
+	LineNumber      int       `json:"line_num"`
+	PS              string    `json:"ps,omitempty"`
+	SessionStart    time.Time `json:"session_start"`
+	VXID            string    `json:"vxid,omitempty"`
+	TXID            int64     `json:"txid,omitempty"`
+	ErrorSeverity   string    `json:"error_severity"`
+	StateCode       string    `json:"state_code,omitempty"`
+	ApplicationName string    `json:"application_name,omitempty"`
+	BackendType     string    `json:"backend_type,omitempty"`
+	LeaderPID       int       `json:"leader_pid,omitempty"`
+	QueryID         int64     `json:"query_id,omitempty"`
+}
+
+type pgAuditCSVLogLineParser struct {
+	uidGenerator *uidGenerator
+}
+
+func NewPGAuditCSVLogLineParser(opts Options) *pgAuditCSVLogLineParser {
+	return &pgAuditCSVLogLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *pgAuditCSVLogLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+// ParseAt parses csvlog record. Records with multi-line fields are expected to be assembled
+// before they are parsed, see parser Multiline options.
+func (p *pgAuditCSVLogLineParser) ParseAt(record string, position service.Position) ([]byte, error) {
+	csvReader := csv.NewReader(strings.NewReader(record))
+	csvReader.FieldsPerRecord = -1
+	fields, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csvlog record, %w", err)
+	}
+
+	if len(fields) <= csvApplicationName {
+		return nil, fmt.Errorf("invalid csvlog fields length: %d", len(fields))
+	}
+
+	if !strings.HasPrefix(fields[csvMessage], "AUDIT: ") {
+		return nil, fmt.Errorf("not a pgaudit line, %w", service.ErrSkipLine)
+	}
+
+	pgae, err := toPgauditEntry(strings.TrimPrefix(fields[csvMessage], "AUDIT: "))
+	if err != nil {
+		return nil, fmt.Errorf("not a pgaudit line, %w", err)
+	}
+
+	entry, err := csvLogEntry(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.pgAuditEntry = *pgae
+	entry.ServerTimestamp = time.Now().UTC()
+	entry.UID, err = p.uidGenerator.uid(record, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal pg audit entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+func csvLogEntry(fields []string) (*pgAuditCSVLogEntry, error) {
+	entry := &pgAuditCSVLogEntry{
+		User:            fields[csvUserName],
+		DBName:          fields[csvDatabaseName],
+		SessionID:       fields[csvSessionID],
+		PS:              fields[csvCommandTag],
+		VXID:            fields[csvVirtualTransactionID],
+		ErrorSeverity:   fields[csvErrorSeverity],
+		StateCode:       fields[csvSQLStateCode],
+		ApplicationName: fields[csvApplicationName],
+	}
+
+	var err error
+	entry.Timestamp, err = parseCSVLogTime("2006-01-02 15:04:05.000", fields[csvLogTime])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse log time, %w", err)
+	}
+
+	entry.SessionStart, err = parseCSVLogTime("2006-01-02 15:04:05", fields[csvSessionStartTime])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse session start time, %w", err)
+	}
+
+	// host:port, or [local] for unix socket
+	entry.RemoteHost = fields[csvConnectionFrom]
+	if pos := strings.LastIndex(entry.RemoteHost, ":"); pos > 0 {
+		port, err := strconv.Atoi(entry.RemoteHost[pos+1:])
+		if err == nil {
+			entry.RemoteHost, entry.RemotePort = entry.RemoteHost[:pos], port
+		}
+	}
+
+	ints := []struct {
+		column int
+		value  *int
+	}{
+		{csvProcessID, &entry.PID},
+		{csvSessionLineNum, &entry.LineNumber},
+		{csvLeaderPID, &entry.LeaderPID},
+	}
+	for _, i := range ints {
+		if i.column >= len(fields) || fields[i.column] == "" {
+			continue
+		}
+
+		*i.value, err = strconv.Atoi(fields[i.column])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse csvlog column %d, %w", i.column, err)
+		}
+	}
+
+	int64s := []struct {
+		column int
+		value  *int64
+	}{
+		{csvTransactionID, &entry.TXID},
+		{csvQueryID, &entry.QueryID},
+	}
+	for _, i := range int64s {
+		if i.column >= len(fields) || fields[i.column] == "" {
+			continue
+		}
+
+		*i.value, err = strconv.ParseInt(fields[i.column], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse csvlog column %d, %w", i.column, err)
+		}
+	}
+
+	if csvBackendType < len(fields) {
+		entry.BackendType = fields[csvBackendType]
+	}
+
+	return entry, nil
+}
+
+// parseCSVLogTime parses time written in log_timezone, followed by zone abbreviation or offset.
+// Abbreviations are ambiguous, so only UTC, GMT and the ones of the local zone are resolved.
+func parseCSVLogTime(layout string, value string) (time.Time, error) {
+	i := strings.LastIndexByte(value, ' ')
+	if i < 0 || i == len(value)-1 {
+		return time.Time{}, fmt.Errorf("missing time zone in %s", value)
+	}
+
+	zone := value[i+1:]
+	if zone[0] == '+' || zone[0] == '-' {
+		// zones without abbreviation are written as offset, e.g. +04 or +0530
+		zoneLayout := " -07"
+		if len(zone) > 3 {
+			zoneLayout = " -0700"
+		}
+		return time.Parse(layout+zoneLayout, value)
+	}
+
+	t, err := time.ParseInLocation(layout+" MST", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// go assumes zero offset for abbreviations which are not of the local zone
+	if t.Location() != time.Local && t.Location() != time.UTC && zone != "GMT" {
+		return time.Time{}, fmt.Errorf("unknown time zone abbreviation %s, set log_timezone to UTC or to the time zone of this host", zone)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgauditParseCSVLog(t *testing.T) {
+	records := []string{
+		// postgres 15, single line record
+		`2023-05-13 21:09:08.502 GMT,"postgres","app",138,"172.22.0.1:58300",645ffc74.8a,1,"CREATE TABLE",2023-05-13 21:09:08 GMT,3/44,736,LOG,00000,"AUDIT: SESSION,1,1,DDL,CREATE TABLE,,,""create table t (id VARCHAR);"",<not logged>",,,,,,,,,"psql","client backend",,0`,
+		// multi-line statement, assembled by balanced quotes
+		`2023-05-13 21:09:09.100 GMT,"postgres","app",138,"172.22.0.1:58300",645ffc74.8a,2,"SELECT",2023-05-13 21:09:08 GMT,3/45,0,LOG,00000,"AUDIT: SESSION,2,1,READ,SELECT,,,""select *
+  from t
+  where id = 'a,b'"",<not logged>",,,,,,,,,"psql","client backend",,0`,
+		// continuation line starting with timestamp
+		`2023-05-13 21:09:09.200 GMT,"postgres","app",138,"172.22.0.1:58300",645ffc74.8a,3,"INSERT",2023-05-13 21:09:08 GMT,3/46,0,LOG,00000,"AUDIT: SESSION,3,1,WRITE,INSERT,,,""insert into t values ('
+2023-05-13 21:09:09 literal')"",<not logged>",,,,,,,,,"psql","client backend",,0`,
+		// postgres 12, not a pgaudit line
+		`2023-05-13 21:09:10.000 GMT,,,100,,645ffc70.64,1,,2023-05-13 21:09:00 GMT,,0,LOG,00000,"database system is ready to accept connections",,,,,,,,,""`,
+		// unix socket
+		`2023-05-13 21:09:11.000 GMT,"bob","app",139,"[local]",645ffc74.8b,1,"SELECT",2023-05-13 21:09:11 GMT,4/1,0,LOG,00000,"AUDIT: SESSION,1,1,READ,SELECT,,,select 1,<not logged>",,,,,,,,,"","client backend"`,
+		// incomplete record
+		`2023-05-13 21:09:12.000 GMT,"bob","app",139,"[local]",645ffc74.8b,2,"SELECT",2023-05-13 21:09:11 GMT,4/1,0,LOG,00000,"AUDIT: SESSION,2,1,READ,SELECT,,,""select`,
+	}
+
+	p := NewPGAuditCSVLogLineParser(Options{})
+	entries := []map[string]interface{}{}
+	skipped, invalid := 0, 0
+	for _, r := range records {
+		b, err := p.Parse(r)
+		if errors.Is(err, service.ErrSkipLine) {
+			skipped++
+			continue
+		} else if err != nil {
+			invalid++
+			continue
+		}
+
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &entry))
+		entries = append(entries, entry)
+	}
+
+	// not pgaudit line and incomplete record
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, 1, invalid)
+	require.Len(t, entries, 4)
+
+	// RFC3339, as read by sql repository and schema validation
+	assert.Equal(t, "2023-05-13T21:09:08.502Z", entries[0]["timestamp"])
+	assert.Equal(t, "2023-05-13T21:09:08Z", entries[0]["session_start"])
+	assert.Equal(t, "postgres", entries[0]["user"])
+	assert.Equal(t, "app", entries[0]["dbname"])
+	assert.Equal(t, "172.22.0.1", entries[0]["remote_host"])
+	assert.Equal(t, 58300.0, entries[0]["remote_port"])
+	assert.Equal(t, "645ffc74.8a", entries[0]["session_id"])
+	assert.Equal(t, 1.0, entries[0]["line_num"])
+	assert.Equal(t, 736.0, entries[0]["txid"])
+	assert.Equal(t, "psql", entries[0]["application_name"])
+	assert.Equal(t, "client backend", entries[0]["backend_type"])
+	assert.Equal(t, "DDL", entries[0]["class"])
+	assert.Equal(t, "create table t (id VARCHAR);", entries[0]["statement"])
+	assert.NotEmpty(t, entries[0]["uid"])
+
+	assert.Equal(t, 2.0, entries[1]["statement_id"])
+	assert.Equal(t, "select *\n  from t\n  where id = 'a,b'", entries[1]["statement"])
+
+	assert.Equal(t, "insert into t values ('\n2023-05-13 21:09:09 literal')", entries[2]["statement"])
+
+	assert.Equal(t, "[local]", entries[3]["remote_host"])
+	assert.Nil(t, entries[3]["remote_port"])
+	assert.Equal(t, "645ffc74.8b", entries[3]["session_id"])
+
+	// records end with the line which balances their quotes
+	parser, err := Lookup("pgauditcsvlog")
+	require.NoError(t, err)
+	for _, r := range records[:len(records)-1] {
+		lines := strings.Split(r, "\n")
+		quotes := 0
+		for i, l := range lines {
+			quotes += strings.Count(l, parser.Multiline.Quote)
+			assert.Equal(t, i == len(lines)-1, quotes%2 == 0)
+		}
+	}
+}
+
+func TestParseCSVLogTime(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local = time.FixedZone("CEST", 2*60*60)
+
+	for value, expected := range map[string]string{
+		"2023-05-13 21:09:08 GMT":   "2023-05-13T21:09:08Z",
+		"2023-05-13 21:09:08 UTC":   "2023-05-13T21:09:08Z",
+		"2023-05-13 21:09:08 CEST":  "2023-05-13T19:09:08Z",
+		"2023-05-13 21:09:08 +04":   "2023-05-13T17:09:08Z",
+		"2023-05-13 21:09:08 +0530": "2023-05-13T15:39:08Z",
+		"2023-05-13 21:09:08 -03":   "2023-05-14T00:09:08Z",
+	} {
+		ts, err := parseCSVLogTime("2006-01-02 15:04:05", value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, ts.UTC().Format(time.RFC3339), value)
+	}
+
+	// abbreviation of other zone would get zero offset
+	_, err := parseCSVLogTime("2006-01-02 15:04:05", "2023-05-13 21:09:08 EST")
+	assert.Error(t, err)
+	_, err = parseCSVLogTime("2006-01-02 15:04:05", "2023-05-13 21:09:08")
+	assert.Error(t, err)
+}
@@ -23,10 +23,35 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 	"github.com/tidwall/gjson"
 )
 
+func init() {
+	Register(Parser{
+		Name:        "pgauditjsonlog",
+		Description: "pgaudit entries from postgres jsonlog log",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewPGAuditJSONLogLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			return pgAuditSchema(opts, []SchemaField{
+				{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+				{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+				{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+				{Name: "user", Type: FieldTypeString, Index: true},
+				{Name: "dbname", Type: FieldTypeString, Index: true},
+				{Name: "remote_host", Type: FieldTypeString},
+				{Name: "remote_port", Type: FieldTypeInteger},
+				{Name: "session_id", Type: FieldTypeString, Index: true},
+				{Name: "line_num", Type: FieldTypeInteger},
+				{Name: "ps", Type: FieldTypeString},
+				{Name: "session_start", Type: FieldTypeTimestamp},
+			}), nil
+		},
+	})
+}
+
 type pgauditTimestamp struct {
 	time.Time
 }
@@ -65,18 +90,29 @@ type pgAuditJSONLogEntry struct {
 }
 
 type pgAuditJSONLogLineParser struct {
+	uidGenerator *uidGenerator
 }
 
-func NewPGAuditJSONLogLineParser() *pgAuditJSONLogLineParser {
-	return &pgAuditJSONLogLineParser{}
+func NewPGAuditJSONLogLineParser(opts Options) *pgAuditJSONLogLineParser {
+	return &pgAuditJSONLogLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
 }
 
 func (p *pgAuditJSONLogLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *pgAuditJSONLogLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
 	r := gjson.Get(line, "message")
 	if !r.Exists() {
 		return nil, errors.New("not a pgaudit line, missing 'messagae' field")
 	}
 
+	if !strings.HasPrefix(r.String(), "AUDIT:") {
+		return nil, fmt.Errorf("not a pgaudit line, %w", service.ErrSkipLine)
+	}
+
 	pgae, err := toPgauditEntry(strings.TrimSpace(strings.TrimLeft(r.String(), "AUDIT:")))
 	if err != nil {
 		return nil, fmt.Errorf("not a pgaudit line, %w", err)
@@ -89,8 +125,11 @@ func (p *pgAuditJSONLogLineParser) Parse(line string) ([]byte, error) {
 	}
 
 	pgaje.pgAuditEntry = *pgae
-	pgaje.UID = uuid.New().String()
 	pgaje.ServerTimestamp = time.Now().UTC()
+	pgaje.UID, err = p.uidGenerator.uid(line, position, pgaje)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
 
 	bytes, err := json.Marshal(pgaje)
 	if err != nil {
@@ -78,7 +78,7 @@ func TestPgauditParseJSONLog(t *testing.T) {
 		},
 	}
 
-	pga := NewPGAuditJSONLogLineParser()
+	pga := NewPGAuditJSONLogLineParser(Options{})
 
 	for _, td := range tdd {
 		b, err := pga.Parse(td.line)
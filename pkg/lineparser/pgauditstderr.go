@@ -24,47 +24,80 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 )
 
+func init() {
+	Register(Parser{
+		Name:        "pgaudit",
+		Description: "pgaudit entries from postgres stderr log, prefix fields are set by --log-line-prefix",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewPGAuditLineParser(opts), nil
+		},
+		Schema: func(opts Options) (Schema, error) {
+			prefix, err := newLogLinePrefix(opts.LogLinePrefix)
+			if err != nil {
+				return Schema{}, fmt.Errorf("invalid log line prefix, %w", err)
+			}
+
+			fields := []SchemaField{
+				{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+				{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+				{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+			}
+
+			return pgAuditSchema(opts, append(fields, prefix.schemaFields()...)), nil
+		},
+	})
+}
+
 type pgAuditStderrEntry struct {
 	pgAuditEntry
+	logLinePrefixFields
 	UID             string    `json:"uid"`
 	Timestamp       time.Time `json:"timestamp"`        // timestamp from log line
 	ServerTimestamp time.Time `json:"server_timestamp"` // server timestamp
 }
 
 type pgAuditLineParser struct {
+	uidGenerator *uidGenerator
+	prefix       *logLinePrefix
+	prefixErr    error
 }
 
-func NewPGAuditLineParser() *pgAuditLineParser {
-	return &pgAuditLineParser{}
+// NewPGAuditLineParser creates parser of stderr log lines with opts.LogLinePrefix, by default '%m [%p] '.
+// Invalid prefix is reported by each Parse, options should be validated first.
+func NewPGAuditLineParser(opts Options) *pgAuditLineParser {
+	prefix, err := newLogLinePrefix(opts.LogLinePrefix)
+	return &pgAuditLineParser{
+		uidGenerator: newUIDGenerator(opts),
+		prefix:       prefix,
+		prefixErr:    err,
+	}
 }
 
 func (p *pgAuditLineParser) Parse(line string) ([]byte, error) {
-	// assumed default log_line_prefix '%m [%p] '
-	if len(line) < 26 { // min length of timestamp with timezone
-		return nil, fmt.Errorf("invalid log line prefix, too short")
-	}
-	cur := 26
-	pos := strings.Index(line[cur:], " ") // find end of timezone abbreviation
-	if pos < 0 {
-		return nil, fmt.Errorf("invalid log line prefix")
+	return p.ParseAt(line, nil)
+}
+
+func (p *pgAuditLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	if p.prefixErr != nil {
+		return nil, fmt.Errorf("invalid log line prefix template, %w", p.prefixErr)
 	}
 
-	cur += pos
-	ts, err := time.Parse("2006-01-02 15:04:05.000 MST", line[:cur])
+	prefixFields, ts, message, err := p.prefix.parse(line)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse timestamp '%s': %w", line[:cur], err)
+		return nil, err
 	}
 
-	pos = strings.Index(line[cur:], "AUDIT: ")
+	cur := 0
+	pos := strings.Index(message, "AUDIT: ")
 	if pos < 0 {
-		return nil, fmt.Errorf("not a pgaudit line")
+		return nil, fmt.Errorf("not a pgaudit line, %w", service.ErrSkipLine)
 	}
 
 	cur += pos + len("AUDIT: ")
-	csvReader := csv.NewReader(strings.NewReader(line[cur:]))
+	csvReader := csv.NewReader(strings.NewReader(message[cur:]))
 	csvFields, err := csvReader.Read()
 	if err != nil {
 		return nil, fmt.Errorf("invalid csv line, %w", err)
@@ -85,9 +118,9 @@ func (p *pgAuditLineParser) Parse(line string) ([]byte, error) {
 	}
 
 	pgae := &pgAuditStderrEntry{
-		UID:             uuid.New().String(),
-		ServerTimestamp: time.Now().UTC(),
-		Timestamp:       ts,
+		ServerTimestamp:     time.Now().UTC(),
+		Timestamp:           ts,
+		logLinePrefixFields: *prefixFields,
 		pgAuditEntry: pgAuditEntry{
 			AuditType:      csvFields[0],
 			StatementID:    statementID,
@@ -101,6 +134,11 @@ func (p *pgAuditLineParser) Parse(line string) ([]byte, error) {
 		},
 	}
 
+	pgae.UID, err = p.uidGenerator.uid(line, position, pgae)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
 	bytes, err := json.Marshal(pgae)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal pg audit entry, %w", err)
@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,7 +59,7 @@ func TestPgauditParse(t *testing.T) {
 		},
 	}
 
-	pga := NewPGAuditLineParser()
+	pga := NewPGAuditLineParser(Options{})
 
 	for _, td := range tdd {
 		b, err := pga.Parse(td.line)
@@ -84,4 +85,68 @@ func TestPgauditParse(t *testing.T) {
 		assert.Equal(t, td.expected.SubstatementID, td.expected.SubstatementID)
 		assert.NotEmpty(t, entry.UID)
 	}
+
+	_, err := pga.Parse(`2023-02-03 21:15:01.759 GMT [294] LOG:  database system is ready to accept connections`)
+	assert.ErrorIs(t, err, service.ErrSkipLine)
+}
+
+func TestPgauditParseLogLinePrefix(t *testing.T) {
+	type testData struct {
+		prefix    string
+		line      string
+		expected  map[string]interface{}
+		expectErr bool
+	}
+
+	audit := `LOG:  AUDIT: SESSION,3,1,READ,SELECT,,,select 1,<not logged>`
+	tdd := []testData{
+		{
+			prefix: "%t [%p]: [%l-1] user=%u,db=%d,app=%a,client=%h ",
+			line:   `2023-05-13 21:09:08 UTC [138]: [4-1] user=postgres,db=app,app=psql shell,client=172.22.0.1 ` + audit,
+			expected: map[string]interface{}{
+				"timestamp": "2023-05-13T21:09:08Z", "pid": 138.0, "line_num": 4.0, "user": "postgres",
+				"dbname": "app", "application_name": "psql shell", "remote_host": "172.22.0.1", "statement_id": 3.0,
+			},
+		},
+		{
+			prefix: "%m %r %c %x %v %e %-10u|",
+			line:   `2023-05-13 21:09:08.502 GMT 10.0.0.1(58300) 645ffc74.8a 0 3/12 00000 bob       |` + audit,
+			expected: map[string]interface{}{
+				"timestamp": "2023-05-13T21:09:08.502Z", "remote_host": "10.0.0.1", "remote_port": 58300.0, "session_id": "645ffc74.8a",
+				"vxid": "3/12", "state_code": "00000", "user": "bob",
+			},
+		},
+		{
+			prefix: "%n [%p] %q%u@%d ",
+			line:   `1683999999.123 [42] ` + audit,
+			expected: map[string]interface{}{
+				"timestamp": "2023-05-13T17:46:39.123Z", "pid": 42.0,
+			},
+		},
+		{
+			prefix:    "%m [%p] ",
+			line:      `2023-05-13 21:09:08 UTC [138] ` + audit,
+			expectErr: true,
+		},
+	}
+
+	for _, td := range tdd {
+		pga := NewPGAuditLineParser(Options{LogLinePrefix: td.prefix})
+		b, err := pga.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+
+		assert.NoError(t, err)
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal(b, &entry))
+		for k, v := range td.expected {
+			assert.Equal(t, v, entry[k], k)
+		}
+		assert.Equal(t, "select 1", entry["statement"])
+	}
+
+	assert.Error(t, Options{LogLinePrefix: "%m %z "}.Validate())
+	assert.Error(t, Options{LogLinePrefix: "%m %"}.Validate())
 }
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+// Parser describes line parser registered under its name
+type Parser struct {
+	Name        string
+	Description string
+	// New creates line parser with given options
+	New func(opts Options) (service.LineParser, error)
+	// Schema returns output fields of the parser with given options, indexed fields are
+	// used as default configuration of created collections
+	Schema func(opts Options) (Schema, error)
+	// Multiline assembles records spanning multiple lines before they are parsed, it is used
+	// by file and docker tails when no multiline flag is given
+	Multiline service.MultilineOptions
+}
+
+var registry = map[string]Parser{}
+
+// Register adds parser to the registry, it panics when the name is already taken
+func Register(p Parser) {
+	if _, ok := registry[p.Name]; ok {
+		panic(fmt.Sprintf("parser %s is already registered", p.Name))
+	}
+
+	registry[p.Name] = p
+}
+
+// Lookup returns registered parser
+func Lookup(name string) (Parser, error) {
+	p, ok := registry[name]
+	if !ok {
+		return Parser{}, fmt.Errorf("not supported parser: %s", name)
+	}
+
+	return p, nil
+}
+
+// Parsers returns registered parsers sorted by name
+func Parsers() []Parser {
+	parsers := make([]Parser, 0, len(registry))
+	for _, p := range registry {
+		parsers = append(parsers, p)
+	}
+
+	sort.Slice(parsers, func(i, j int) bool {
+		return parsers[i].Name < parsers[j].Name
+	})
+
+	return parsers
+}
+
+// staticSchema is schema of parsers which output does not depend on options
+func staticSchema(fields ...SchemaField) func(opts Options) (Schema, error) {
+	return func(opts Options) (Schema, error) {
+		return Schema{Fields: fields}, nil
+	}
+}
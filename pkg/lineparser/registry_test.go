@@ -0,0 +1,72 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"testing"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserMultiline(t *testing.T) {
+	for _, p := range Parsers() {
+		if !p.Multiline.Enabled() {
+			continue
+		}
+
+		_, err := service.NewMultilineLineProvider(&testLineProvider{lC: make(chan service.Line)}, p.Multiline)
+		require.NoError(t, err, p.Name)
+	}
+}
+
+type testLineProvider struct {
+	lC chan service.Line
+}
+
+func (lp *testLineProvider) ReadLine() chan service.Line {
+	return lp.lC
+}
+
+func (lp *testLineProvider) Ack(positions []service.Position) {}
+
+func (lp *testLineProvider) SaveState() {}
+
+// assembleRecords assembles lines into records as file tail does with default multiline
+// options of the parser
+func assembleRecords(t *testing.T, parser string, lines []string) []string {
+	p, err := Lookup(parser)
+	require.NoError(t, err)
+
+	lp := &testLineProvider{lC: make(chan service.Line)}
+	mp, err := service.NewMultilineLineProvider(lp, p.Multiline)
+	require.NoError(t, err)
+
+	go func() {
+		for _, l := range lines {
+			lp.lC <- service.Line{Text: l}
+		}
+		close(lp.lC)
+	}()
+
+	records := []string{}
+	for l := range mp.ReadLine() {
+		records = append(records, l.Text)
+	}
+
+	return records
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+const (
+	FieldTypeString    = "string"
+	FieldTypeInteger   = "integer"
+	FieldTypeFloat     = "float"
+	FieldTypeBoolean   = "boolean"
+	FieldTypeTimestamp = "timestamp"
+	FieldTypeArray     = "array"
+	FieldTypeObject    = "object"
+)
+
+// Schema lists top level fields of parsed entries, indexed fields are used to create collections
+type Schema struct {
+	Fields []SchemaField
+	// SequentialID makes SQL collections use auto incremented id as primary key instead of
+	// the first indexed field
+	SequentialID bool
+}
+
+type SchemaField struct {
+	Name string
+	Type string
+	// Size is maximum length of string field, 0 means default
+	Size  int
+	Index bool
+}
+
+// Indexed returns fields indexed in created collections
+func (s Schema) Indexed() []SchemaField {
+	indexed := []SchemaField{}
+	for _, f := range s.Fields {
+		if f.Index {
+			indexed = append(indexed, f)
+		}
+	}
+
+	return indexed
+}
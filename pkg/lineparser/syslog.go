@@ -0,0 +1,347 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+)
+
+func init() {
+	Register(Parser{
+		Name:        "syslog",
+		Description: "RFC 3164 and RFC 5424 syslog lines",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewSyslogLineParser(opts), nil
+		},
+		Schema: staticSchema(
+			SchemaField{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+			SchemaField{Name: "server_timestamp", Type: FieldTypeTimestamp, Index: true},
+			SchemaField{Name: "timestamp", Type: FieldTypeTimestamp, Index: true},
+			SchemaField{Name: "priority", Type: FieldTypeInteger},
+			SchemaField{Name: "facility", Type: FieldTypeString, Size: 32, Index: true},
+			SchemaField{Name: "severity", Type: FieldTypeString, Size: 32, Index: true},
+			SchemaField{Name: "version", Type: FieldTypeInteger},
+			SchemaField{Name: "hostname", Type: FieldTypeString, Size: 256, Index: true},
+			SchemaField{Name: "app", Type: FieldTypeString, Size: 256, Index: true},
+			SchemaField{Name: "pid", Type: FieldTypeString, Size: 128, Index: true},
+			SchemaField{Name: "msgid", Type: FieldTypeString, Size: 64, Index: true},
+			SchemaField{Name: "structured_data", Type: FieldTypeObject},
+			SchemaField{Name: "message", Type: FieldTypeString},
+		),
+	})
+}
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// RFC 3164 4.3.3, messages without PRI part are considered as user.notice
+const syslogDefaultPriority = 13
+
+type syslogEntry struct {
+	UID             string                       `json:"uid"`
+	ServerTimestamp time.Time                    `json:"server_timestamp"`
+	Timestamp       time.Time                    `json:"timestamp"`
+	Priority        int                          `json:"priority"`
+	Facility        string                       `json:"facility"`
+	Severity        string                       `json:"severity"`
+	Version         int                          `json:"version,omitempty"`
+	Hostname        string                       `json:"hostname,omitempty"`
+	App             string                       `json:"app,omitempty"`
+	PID             string                       `json:"pid,omitempty"`
+	MsgID           string                       `json:"msgid,omitempty"`
+	StructuredData  map[string]map[string]string `json:"structured_data,omitempty"`
+	Message         string                       `json:"message"`
+}
+
+type syslogLineParser struct {
+	now          func() time.Time
+	uidGenerator *uidGenerator
+}
+
+func NewSyslogLineParser(opts Options) *syslogLineParser {
+	return &syslogLineParser{
+		now:          time.Now,
+		uidGenerator: newUIDGenerator(opts),
+	}
+}
+
+func (p *syslogLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *syslogLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
+	line = strings.TrimRight(line, "\r\n\x00")
+	entry, err := p.parseEntry(line)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.ServerTimestamp = p.now().UTC()
+	entry.UID, err = p.uidGenerator.uid(line, position, entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal syslog entry, %w", err)
+	}
+
+	return bytes, nil
+}
+
+// parseEntry parses RFC 5424 or RFC 3164 line, without uid and server timestamp
+func (p *syslogLineParser) parseEntry(line string) (*syslogEntry, error) {
+	if line == "" {
+		return nil, errors.New("empty syslog line")
+	}
+
+	priority, rest, err := parseSyslogPriority(line)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &syslogEntry{
+		Priority: priority,
+		Facility: syslogFacilities[priority/8],
+		Severity: syslogSeverities[priority%8],
+	}
+
+	if len(rest) > 2 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		err = p.parseRFC5424(rest, entry)
+	} else {
+		err = p.parseRFC3164(rest, entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func parseSyslogPriority(line string) (int, string, error) {
+	if line[0] != '<' {
+		return syslogDefaultPriority, line, nil
+	}
+
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errors.New("invalid syslog priority")
+	}
+
+	priority, err := strconv.Atoi(line[1:end])
+	if err != nil || priority < 0 || priority > 191 {
+		return 0, "", fmt.Errorf("invalid syslog priority '%s'", line[1:end])
+	}
+
+	return priority, line[end+1:], nil
+}
+
+// <PRI>VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+func (p *syslogLineParser) parseRFC5424(s string, entry *syslogEntry) error {
+	fields := strings.SplitN(s, " ", 7)
+	if len(fields) < 7 {
+		return errors.New("invalid RFC 5424 syslog line, missing header fields")
+	}
+
+	version, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("invalid syslog version, %w", err)
+	}
+	entry.Version = version
+
+	if fields[1] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return fmt.Errorf("could not parse timestamp '%s': %w", fields[1], err)
+		}
+		entry.Timestamp = ts
+	}
+
+	entry.Hostname = syslogNilValue(fields[2])
+	entry.App = syslogNilValue(fields[3])
+	entry.PID = syslogNilValue(fields[4])
+	entry.MsgID = syslogNilValue(fields[5])
+
+	sd, msg, err := parseSyslogStructuredData(fields[6])
+	if err != nil {
+		return err
+	}
+
+	entry.StructuredData = sd
+	entry.Message = strings.TrimPrefix(msg, "\ufeff")
+	return nil
+}
+
+func syslogNilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+
+	return s
+}
+
+// parses STRUCTURED-DATA, returns remaining part as message
+func parseSyslogStructuredData(s string) (map[string]map[string]string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return nil, strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	sd := map[string]map[string]string{}
+	cur := 0
+	for cur < len(s) && s[cur] == '[' {
+		cur++
+		idEnd := strings.IndexAny(s[cur:], " ]")
+		if idEnd < 1 {
+			return nil, "", errors.New("invalid structured data element")
+		}
+
+		id := s[cur : cur+idEnd]
+		params := map[string]string{}
+		cur += idEnd
+		for cur < len(s) && s[cur] == ' ' {
+			cur++
+			eq := strings.IndexByte(s[cur:], '=')
+			if eq < 1 || cur+eq+1 >= len(s) || s[cur+eq+1] != '"' {
+				return nil, "", fmt.Errorf("invalid structured data param in element %s", id)
+			}
+
+			name := s[cur : cur+eq]
+			cur += eq + 2
+
+			var value strings.Builder
+			closed := false
+			for ; cur < len(s); cur++ {
+				if s[cur] == '\\' && cur+1 < len(s) && (s[cur+1] == '"' || s[cur+1] == '\\' || s[cur+1] == ']') {
+					cur++
+					value.WriteByte(s[cur])
+					continue
+				}
+
+				if s[cur] == '"' {
+					closed = true
+					cur++
+					break
+				}
+
+				value.WriteByte(s[cur])
+			}
+
+			if !closed {
+				return nil, "", fmt.Errorf("unterminated structured data param %s in element %s", name, id)
+			}
+
+			params[name] = value.String()
+		}
+
+		if cur >= len(s) || s[cur] != ']' {
+			return nil, "", fmt.Errorf("unterminated structured data element %s", id)
+		}
+
+		cur++
+		sd[id] = params
+	}
+
+	if len(sd) == 0 {
+		return nil, "", errors.New("invalid structured data")
+	}
+
+	return sd, strings.TrimPrefix(s[cur:], " "), nil
+}
+
+// Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG, timestamp can be also in RFC 3339 format as
+// written by rsyslog with high precision timestamps enabled.
+func (p *syslogLineParser) parseRFC3164(s string, entry *syslogEntry) error {
+	var rest string
+	if len(s) >= len(time.Stamp) && s[3] == ' ' {
+		ts, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local)
+		if err != nil {
+			return fmt.Errorf("could not parse timestamp '%s': %w", s[:len(time.Stamp)], err)
+		}
+
+		// BSD timestamp has no year, assume the most recent one
+		now := p.now()
+		ts = ts.AddDate(now.Year(), 0, 0)
+		if ts.After(now.Add(24 * time.Hour)) {
+			ts = ts.AddDate(-1, 0, 0)
+		}
+
+		entry.Timestamp = ts
+		rest = s[len(time.Stamp):]
+	} else {
+		pos := strings.IndexByte(s, ' ')
+		if pos < 0 {
+			return errors.New("invalid syslog line, missing timestamp")
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, s[:pos])
+		if err != nil {
+			return fmt.Errorf("could not parse timestamp '%s': %w", s[:pos], err)
+		}
+
+		entry.Timestamp = ts
+		rest = s[pos:]
+	}
+
+	fields := strings.SplitN(strings.TrimLeft(rest, " "), " ", 2)
+	if fields[0] == "" {
+		return errors.New("invalid syslog line, missing hostname")
+	}
+
+	entry.Hostname = fields[0]
+	if len(fields) == 1 {
+		return nil
+	}
+
+	msg := fields[1]
+	tagEnd := strings.IndexAny(msg, ":[ ")
+	if tagEnd > 0 && tagEnd <= 48 {
+		tag := msg[:tagEnd]
+		tail := msg[tagEnd:]
+		if tail[0] == '[' {
+			pidEnd := strings.IndexByte(tail, ']')
+			if pidEnd > 0 {
+				entry.PID = tail[1:pidEnd]
+				tail = tail[pidEnd+1:]
+			}
+		}
+
+		if strings.HasPrefix(tail, ":") {
+			entry.App = tag
+			msg = strings.TrimPrefix(tail[1:], " ")
+		} else {
+			entry.PID = ""
+		}
+	}
+
+	entry.Message = msg
+	return nil
+}
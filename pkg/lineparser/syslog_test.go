@@ -0,0 +1,175 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineparser
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogParse(t *testing.T) {
+	type testData struct {
+		line      string
+		expected  *syslogEntry
+		expectErr bool
+	}
+
+	tdd := []testData{
+		{
+			line: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8`,
+			expected: &syslogEntry{
+				Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3*1000000, time.UTC),
+				Priority:  34,
+				Facility:  "auth",
+				Severity:  "crit",
+				Version:   1,
+				Hostname:  "mymachine.example.com",
+				App:       "su",
+				MsgID:     "ID47",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			line: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high \"x\""] An application event log entry...`,
+			expected: &syslogEntry{
+				Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3*1000000, time.UTC),
+				Priority:  165,
+				Facility:  "local4",
+				Severity:  "notice",
+				Version:   1,
+				Hostname:  "mymachine.example.com",
+				App:       "evntslog",
+				PID:       "1234",
+				MsgID:     "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473":     {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+					"examplePriority@32473": {"class": `high "x"`},
+				},
+				Message: "An application event log entry...",
+			},
+		},
+		{
+			line: `<13>Oct 11 22:14:15 mymachine sshd[4321]: Accepted publickey for root`,
+			expected: &syslogEntry{
+				Timestamp: time.Date(2022, 10, 11, 22, 14, 15, 0, time.Local),
+				Priority:  13,
+				Facility:  "user",
+				Severity:  "notice",
+				Hostname:  "mymachine",
+				App:       "sshd",
+				PID:       "4321",
+				Message:   "Accepted publickey for root",
+			},
+		},
+		{
+			line: `Jan  6 13:57:20 DESKTOP-BLRRBQO rsyslogd: [origin software="rsyslogd" swVersion="8.2001.0" x-pid="29541" x-info="https://www.rsyslog.com"] start`,
+			expected: &syslogEntry{
+				Timestamp: time.Date(2023, 1, 6, 13, 57, 20, 0, time.Local),
+				Priority:  13,
+				Facility:  "user",
+				Severity:  "notice",
+				Hostname:  "DESKTOP-BLRRBQO",
+				App:       "rsyslogd",
+				Message:   `[origin software="rsyslogd" swVersion="8.2001.0" x-pid="29541" x-info="https://www.rsyslog.com"] start`,
+			},
+		},
+		{
+			line: `2023-01-06T13:57:20.123456+01:00 host -bash[305]: ls -la`,
+			expected: &syslogEntry{
+				Timestamp: time.Date(2023, 1, 6, 12, 57, 20, 123456000, time.UTC),
+				Priority:  13,
+				Facility:  "user",
+				Severity:  "notice",
+				Hostname:  "host",
+				App:       "-bash",
+				PID:       "305",
+				Message:   "ls -la",
+			},
+		},
+		{
+			line:      `<999>Oct 11 22:14:15 mymachine su: x`,
+			expectErr: true,
+		},
+		{
+			line:      `<34>1 2003-10-11T22:14:15.003Z host app - ID47 [unterminated x="1"`,
+			expectErr: true,
+		},
+		{
+			line:      "\x00\x00\x00",
+			expectErr: true,
+		},
+	}
+
+	sp := NewSyslogLineParser(Options{})
+	sp.now = func() time.Time { return time.Date(2023, 1, 7, 0, 0, 0, 0, time.Local) }
+
+	for _, td := range tdd {
+		b, err := sp.Parse(td.line)
+		if td.expectErr {
+			assert.Error(t, err, td.line)
+			assert.Nil(t, b)
+			continue
+		}
+
+		require.NoError(t, err, td.line)
+
+		var entry syslogEntry
+		assert.NoError(t, json.Unmarshal(b, &entry))
+		assert.NotEmpty(t, entry.UID)
+		assert.True(t, td.expected.Timestamp.Equal(entry.Timestamp), "expected %s, got %s", td.expected.Timestamp, entry.Timestamp)
+		assert.Equal(t, td.expected.Priority, entry.Priority)
+		assert.Equal(t, td.expected.Facility, entry.Facility)
+		assert.Equal(t, td.expected.Severity, entry.Severity)
+		assert.Equal(t, td.expected.Version, entry.Version)
+		assert.Equal(t, td.expected.Hostname, entry.Hostname)
+		assert.Equal(t, td.expected.App, entry.App)
+		assert.Equal(t, td.expected.PID, entry.PID)
+		assert.Equal(t, td.expected.MsgID, entry.MsgID)
+		assert.Equal(t, td.expected.StructuredData, entry.StructuredData)
+		assert.Equal(t, td.expected.Message, entry.Message)
+	}
+}
+
+func TestSyslogParseFile(t *testing.T) {
+	f, err := os.Open("../../test/syslog/syslog")
+	require.NoError(t, err)
+	defer f.Close()
+
+	sp := NewSyslogLineParser(Options{})
+	scanner := bufio.NewScanner(f)
+	parsed := 0
+	for scanner.Scan() {
+		b, err := sp.Parse(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		var entry syslogEntry
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.Equal(t, "DESKTOP-BLRRBQO", entry.Hostname)
+		assert.NotEmpty(t, entry.App)
+		parsed++
+	}
+
+	assert.Equal(t, 968, parsed)
+}
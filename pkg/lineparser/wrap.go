@@ -18,11 +18,27 @@ package lineparser
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 )
 
+func init() {
+	Register(Parser{
+		Name:        "wrap",
+		Description: "any line wrapped into json with uid and timestamp",
+		New: func(opts Options) (service.LineParser, error) {
+			return NewWrapLineParser(opts), nil
+		},
+		Schema: staticSchema(
+			SchemaField{Name: "uid", Type: FieldTypeString, Size: 36, Index: true},
+			SchemaField{Name: "log_timestamp", Type: FieldTypeTimestamp, Index: true},
+			SchemaField{Name: "message", Type: FieldTypeString},
+		),
+	})
+}
+
 type wrap struct {
 	UID     string    `json:"uid"`
 	Ts      time.Time `json:"log_timestamp"`
@@ -30,18 +46,30 @@ type wrap struct {
 }
 
 type wrapLineParser struct {
+	uidGenerator *uidGenerator
 }
 
-func NewWrapLineParser() *wrapLineParser {
-	return &wrapLineParser{}
+func NewWrapLineParser(opts Options) *wrapLineParser {
+	return &wrapLineParser{
+		uidGenerator: newUIDGenerator(opts),
+	}
 }
 
-func (*wrapLineParser) Parse(line string) ([]byte, error) {
+func (p *wrapLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *wrapLineParser) ParseAt(line string, position service.Position) ([]byte, error) {
 	w := wrap{
-		UID:     uuid.New().String(),
 		Ts:      time.Now(),
 		Message: line,
 	}
 
+	uid, err := p.uidGenerator.uid(line, position, w)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate uid, %w", err)
+	}
+
+	w.UID = uid
 	return json.Marshal(w)
 }
@@ -0,0 +1,320 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.000 MST",
+	"2006-01-02 15:04:05 MST",
+}
+
+// SessionEntry is pgaudit entry of a session
+type SessionEntry struct {
+	StatementID    int
+	SubstatementID int
+	LineNumber     int
+	Timestamp      time.Time
+	SessionStart   time.Time
+	AuditType      string
+	Class          string
+	Command        string
+	ObjectType     string
+	ObjectName     string
+	Statement      string
+	Raw            []byte
+	// order in which entry was stored
+	index int
+}
+
+func (e *SessionEntry) key() string {
+	return fmt.Sprintf("%d.%d|%s|%s|%s|%s|%s", e.StatementID, e.SubstatementID, e.AuditType, e.Class, e.Command, e.ObjectType, e.ObjectName)
+}
+
+func (e *SessionEntry) less(o *SessionEntry) bool {
+	if e.StatementID != o.StatementID {
+		return e.StatementID < o.StatementID
+	}
+	return e.SubstatementID < o.SubstatementID
+}
+
+// Gap is a range of missing statement ids, or missing substatement ids of Statement when it is not 0
+type Gap struct {
+	Statement int
+	From      int
+	To        int
+}
+
+func (g Gap) String() string {
+	ids := fmt.Sprint(g.From)
+	if g.To != g.From {
+		ids = fmt.Sprintf("%d-%d", g.From, g.To)
+	}
+
+	if g.Statement != 0 {
+		return fmt.Sprintf("statement %d substatements %s", g.Statement, ids)
+	}
+	return fmt.Sprintf("statements %s", ids)
+}
+
+type Session struct {
+	ID string
+	// Entries in log order, by line_num when available, otherwise by timestamp and stored order
+	Entries    []*SessionEntry
+	Gaps       []Gap
+	Duplicates []*SessionEntry
+	OutOfOrder []*SessionEntry
+}
+
+func (s *Session) OK() bool {
+	return len(s.Gaps) == 0 && len(s.Duplicates) == 0 && len(s.OutOfOrder) == 0
+}
+
+type SessionsReport struct {
+	Entries int
+	// Skipped entries are not pgaudit entries or have no session_id
+	Skipped  int
+	Sessions []*Session
+}
+
+func (r *SessionsReport) OK() bool {
+	for _, s := range r.Sessions {
+		if !s.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Sessions groups pgaudit entries by session_id and reports gaps in statement and substatement
+// ids, duplicated entries and entries logged out of statement id order. pgaudit ids are sequential
+// per session, so gaps mean audit records were dropped, suppressed or not logged because of
+// pgaudit.log settings. Statements missing before the first stored one are reported too, unless
+// session_start shows the session started before the first stored entry, so its beginning was
+// not ingested. If sessionID is not empty, only that session is analyzed.
+func Sessions(stored [][]byte, sessionID string) (*SessionsReport, error) {
+	report := &SessionsReport{}
+	sessions := map[string]*Session{}
+	var windowStart time.Time
+	for i, s := range stored {
+		if !gjson.ValidBytes(s) {
+			return nil, fmt.Errorf("invalid stored entry %s", string(s))
+		}
+
+		report.Entries++
+		r := gjson.ParseBytes(s)
+		id := r.Get("session_id").String()
+		if id == "" || !r.Get("statement_id").Exists() {
+			report.Skipped++
+			continue
+		}
+
+		timestamp := parseTimestamp(r.Get("timestamp").String())
+		if !timestamp.IsZero() && (windowStart.IsZero() || timestamp.Before(windowStart)) {
+			windowStart = timestamp
+		}
+
+		if sessionID != "" && id != sessionID {
+			continue
+		}
+
+		e := &SessionEntry{
+			StatementID:    int(r.Get("statement_id").Int()),
+			SubstatementID: int(r.Get("substatement_id").Int()),
+			LineNumber:     int(r.Get("line_num").Int()),
+			Timestamp:      timestamp,
+			SessionStart:   parseTimestamp(r.Get("session_start").String()),
+			AuditType:      r.Get("audit_type").String(),
+			Class:          r.Get("class").String(),
+			Command:        r.Get("command").String(),
+			ObjectType:     r.Get("object_type").String(),
+			ObjectName:     r.Get("object_name").String(),
+			Statement:      r.Get("statement").String(),
+			Raw:            s,
+			index:          i,
+		}
+
+		session, ok := sessions[id]
+		if !ok {
+			session = &Session{ID: id}
+			sessions[id] = session
+			report.Sessions = append(report.Sessions, session)
+		}
+		session.Entries = append(session.Entries, e)
+	}
+
+	for _, s := range report.Sessions {
+		s.analyze(windowStart)
+	}
+
+	sort.Slice(report.Sessions, func(i, j int) bool {
+		return report.Sessions[i].Entries[0].Timestamp.Before(report.Sessions[j].Entries[0].Timestamp)
+	})
+
+	return report, nil
+}
+
+// analyze orders entries and finds problems, windowStart is timestamp of the first stored entry
+func (s *Session) analyze(windowStart time.Time) {
+	byLineNumber := true
+	for _, e := range s.Entries {
+		if e.LineNumber == 0 {
+			byLineNumber = false
+		}
+	}
+
+	sort.SliceStable(s.Entries, func(i, j int) bool {
+		a, b := s.Entries[i], s.Entries[j]
+		if byLineNumber && a.LineNumber != b.LineNumber {
+			return a.LineNumber < b.LineNumber
+		}
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		return a.index < b.index
+	})
+
+	seen := map[string]bool{}
+	var last *SessionEntry
+	for _, e := range s.Entries {
+		k := e.key()
+		if seen[k] {
+			s.Duplicates = append(s.Duplicates, e)
+			continue
+		}
+		seen[k] = true
+
+		if last != nil && e.less(last) {
+			s.OutOfOrder = append(s.OutOfOrder, e)
+			continue
+		}
+		last = e
+	}
+
+	substatements := map[int]map[int]bool{}
+	statements := []int{}
+	for _, e := range s.Entries {
+		if _, ok := substatements[e.StatementID]; !ok {
+			substatements[e.StatementID] = map[int]bool{}
+			statements = append(statements, e.StatementID)
+		}
+		substatements[e.StatementID][e.SubstatementID] = true
+	}
+	sort.Ints(statements)
+
+	// statement ids start from 1, session_start has seconds precision
+	if len(statements) > 0 && statements[0] > 1 && !s.startedBefore(windowStart.Truncate(time.Second)) {
+		s.Gaps = append(s.Gaps, Gap{From: 1, To: statements[0] - 1})
+	}
+
+	for i, statement := range statements {
+		if i > 0 && statement-statements[i-1] > 1 {
+			s.Gaps = append(s.Gaps, Gap{From: statements[i-1] + 1, To: statement - 1})
+		}
+
+		// substatements start from 1
+		max := 0
+		for sub := range substatements[statement] {
+			if sub > max {
+				max = sub
+			}
+		}
+
+		from := 0
+		for sub := 1; sub <= max; sub++ {
+			if !substatements[statement][sub] && from == 0 {
+				from = sub
+			} else if substatements[statement][sub] && from != 0 {
+				s.Gaps = append(s.Gaps, Gap{Statement: statement, From: from, To: sub - 1})
+				from = 0
+			}
+		}
+	}
+}
+
+// startedBefore is true when session_start, logged with entries, is before t
+func (s *Session) startedBefore(t time.Time) bool {
+	for _, e := range s.Entries {
+		if !e.SessionStart.IsZero() {
+			return e.SessionStart.Before(t)
+		}
+	}
+
+	return false
+}
+
+func parseTimestamp(s string) time.Time {
+	for _, layout := range timestampLayouts {
+		ts, err := time.Parse(layout, s)
+		if err == nil {
+			return ts
+		}
+	}
+
+	return time.Time{}
+}
+
+func (r *SessionsReport) Print(w io.Writer) {
+	problems := 0
+	for _, s := range r.Sessions {
+		if s.OK() {
+			continue
+		}
+
+		problems++
+		first, last := s.Entries[0], s.Entries[len(s.Entries)-1]
+		fmt.Fprintf(w, "session %s, entries: %d, from %s to %s\n", s.ID, len(s.Entries), first.Timestamp.Format(time.RFC3339Nano), last.Timestamp.Format(time.RFC3339Nano))
+		for _, g := range s.Gaps {
+			fmt.Fprintf(w, "  gap %s\n", g)
+		}
+
+		for _, e := range s.Duplicates {
+			fmt.Fprintf(w, "  duplicate %d.%d %s\n", e.StatementID, e.SubstatementID, string(e.Raw))
+		}
+
+		for _, e := range s.OutOfOrder {
+			fmt.Fprintf(w, "  out of order %d.%d %s\n", e.StatementID, e.SubstatementID, string(e.Raw))
+		}
+	}
+
+	fmt.Fprintf(w, "entries: %d, skipped: %d, sessions: %d, sessions with problems: %d\n", r.Entries, r.Skipped, len(r.Sessions), problems)
+}
+
+// PrintTimeline prints entries of each session in log order
+func (r *SessionsReport) PrintTimeline(w io.Writer) {
+	for _, s := range r.Sessions {
+		fmt.Fprintf(w, "session %s\n", s.ID)
+		for _, e := range s.Entries {
+			fields := []string{e.Timestamp.Format(time.RFC3339Nano), fmt.Sprintf("%d.%d", e.StatementID, e.SubstatementID)}
+			for _, f := range []string{e.AuditType, e.Class, e.Command, e.ObjectName, e.Statement} {
+				if f != "" {
+					fields = append(fields, f)
+				}
+			}
+			fmt.Fprintf(w, "  %s\n", strings.Join(fields, " "))
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	entry := func(session string, lineNum int, statement int, substatement int, object string) []byte {
+		return []byte(fmt.Sprintf(`{"session_id":%q,"line_num":%d,"timestamp":"2023-05-13 21:09:%02d.502 GMT","audit_type":"SESSION","class":"READ","command":"SELECT","object_name":%q,"statement_id":%d,"substatement_id":%d}`,
+			session, lineNum, lineNum, object, statement, substatement))
+	}
+
+	stored := [][]byte{
+		entry("a", 1, 1, 1, ""),
+		entry("a", 2, 2, 1, "t1"),
+		entry("a", 3, 2, 1, "t2"),
+		entry("a", 4, 2, 3, ""),
+		entry("a", 4, 2, 3, ""),
+		entry("a", 7, 6, 1, ""),
+		entry("a", 6, 5, 1, ""),
+		entry("a", 8, 4, 1, ""),
+		entry("b", 1, 1, 1, ""),
+		entry("b", 2, 2, 1, ""),
+		[]byte(`{"message":"not pgaudit"}`),
+	}
+
+	report, err := Sessions(stored, "")
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 11, report.Entries)
+	assert.Equal(t, 1, report.Skipped)
+	require.Len(t, report.Sessions, 2)
+
+	a := report.Sessions[0]
+	assert.Equal(t, "a", a.ID)
+	assert.Equal(t, []Gap{{Statement: 2, From: 2, To: 2}, {From: 3, To: 3}}, a.Gaps)
+	require.Len(t, a.Duplicates, 1)
+	assert.Equal(t, 3, a.Duplicates[0].SubstatementID)
+	require.Len(t, a.OutOfOrder, 1)
+	assert.Equal(t, 4, a.OutOfOrder[0].StatementID)
+	assert.Equal(t, 5, a.Entries[5].StatementID, "entries ordered by line number")
+	assert.True(t, report.Sessions[1].OK())
+
+	buf := &bytes.Buffer{}
+	report.Print(buf)
+	assert.Contains(t, buf.String(), "gap statements 3\n")
+	assert.Contains(t, buf.String(), "gap statement 2 substatements 2\n")
+
+	only, err := Sessions(stored, "b")
+	require.NoError(t, err)
+	assert.True(t, only.OK())
+	require.Len(t, only.Sessions, 1)
+
+	buf.Reset()
+	only.PrintTimeline(buf)
+	assert.Equal(t, "session b\n  2023-05-13T21:09:01.502Z 1.1 SESSION READ SELECT\n  2023-05-13T21:09:02.502Z 2.1 SESSION READ SELECT\n", buf.String())
+}
+
+func TestSessionsLeadingGap(t *testing.T) {
+	entry := func(session string, second int, statement int, sessionStart string) []byte {
+		return []byte(fmt.Sprintf(`{"session_id":%q,"timestamp":"2023-05-13 21:09:%02d.502 GMT","session_start":%q,"statement_id":%d,"substatement_id":1}`,
+			session, second, sessionStart, statement))
+	}
+
+	stored := [][]byte{
+		entry("first", 10, 1, "2023-05-13 21:09:10 GMT"),
+		// started before the first stored entry, its beginning was not ingested
+		entry("running", 11, 5, "2023-05-13 21:00:00 GMT"),
+		entry("running", 12, 6, "2023-05-13 21:00:00 GMT"),
+		// started within stored entries, statements 1-2 are missing
+		entry("dropped", 13, 3, "2023-05-13 21:09:13 GMT"),
+		// session start is not known
+		entry("unknown", 14, 2, ""),
+	}
+
+	report, err := Sessions(stored, "")
+	require.NoError(t, err)
+	require.Len(t, report.Sessions, 4)
+	assert.Empty(t, report.Sessions[0].Gaps)
+	assert.Empty(t, report.Sessions[1].Gaps)
+	assert.Equal(t, []Gap{{From: 1, To: 2}}, report.Sessions[2].Gaps)
+	assert.Equal(t, []Gap{{From: 1, To: 1}}, report.Sessions[3].Gaps)
+
+	// window includes entries of not analyzed sessions
+	only, err := Sessions(stored, "running")
+	require.NoError(t, err)
+	assert.True(t, only.OK())
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/codenotary/immudb-log-audit/pkg/source"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultIgnoreFields are set at ingestion time, so they differ when the line is parsed again
+var DefaultIgnoreFields = []string{"uid", "server_timestamp", "log_timestamp"}
+
+type Options struct {
+	// ByUID matches entries by uid, which requires deterministic uids. Otherwise entries are
+	// matched by content, and mismatches are reported as missing and extra entries.
+	ByUID bool
+	// IgnoreFields are not compared, fields starting with underscore are always ignored as
+	// they are added by the backend
+	IgnoreFields []string
+	// Multiline assembles multi-line records of source files, it needs to be the same as
+	// used by tail
+	Multiline service.MultilineOptions
+}
+
+// Finding refers to the last line of multi-line record
+type Finding struct {
+	File   string
+	Line   int
+	UID    string
+	Parsed []byte
+	Stored []byte
+	// Error is parse error of invalid line
+	Error string
+}
+
+type Report struct {
+	Lines int
+	// Invalid are lines which could not be parsed, so they could not be stored either
+	Invalid    []Finding
+	Parsed     int
+	Stored     int
+	Missing    []Finding
+	Extra      []Finding
+	Mismatched []Finding
+}
+
+func (r *Report) OK() bool {
+	return len(r.Invalid) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// sourcePosition is position of line read by source.ReadFileLines, with its line number
+type sourcePosition struct {
+	service.Position
+	file string
+	line int
+}
+
+func (p *sourcePosition) Stream() string {
+	return p.file
+}
+
+// fileLineProvider delivers lines of files matching pattern, acknowledged positions are
+// ignored
+type fileLineProvider struct {
+	lC    chan service.Line
+	lines int
+	err   error
+}
+
+func newFileLineProvider(pattern string) *fileLineProvider {
+	fp := &fileLineProvider{
+		lC: make(chan service.Line),
+	}
+
+	go func() {
+		defer close(fp.lC)
+		fp.err = source.ReadFileLines(pattern, func(file string, lineNumber int, line service.Line) error {
+			fp.lines++
+			fp.lC <- service.Line{Text: line.Text, Position: &sourcePosition{Position: line.Position, file: file, line: lineNumber}}
+			return nil
+		})
+	}()
+
+	return fp
+}
+
+func (fp *fileLineProvider) ReadLine() chan service.Line {
+	return fp.lC
+}
+
+func (fp *fileLineProvider) Ack(positions []service.Position) {}
+
+func (fp *fileLineProvider) SaveState() {}
+
+// lineOf returns file and line number of the last line of record at position
+func lineOf(position service.Position) (string, int) {
+	if sp, ok := service.LastPosition(position).(*sourcePosition); ok {
+		return sp.file, sp.line
+	}
+
+	return "", 0
+}
+
+type storedEntry struct {
+	raw       []byte
+	canonical string
+	matched   bool
+}
+
+// Source parses lines of files matching pattern and checks that each parsed entry is among
+// stored entries. Lines are assembled into multi-line records and entries held by parser are
+// flushed at the end, the same way as tail does.
+func Source(pattern string, lp service.LineParser, stored [][]byte, opts Options) (*Report, error) {
+	ignore := map[string]bool{}
+	for _, f := range opts.IgnoreFields {
+		ignore[f] = true
+	}
+
+	report := &Report{Stored: len(stored)}
+	entries := make([]*storedEntry, 0, len(stored))
+	byUID := map[string]*storedEntry{}
+	byContent := map[string][]*storedEntry{}
+	for _, s := range stored {
+		uid, canonical, err := canonicalize(s, ignore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored entry, %w", err)
+		}
+
+		e := &storedEntry{raw: s, canonical: canonical}
+		entries = append(entries, e)
+		if opts.ByUID {
+			if _, ok := byUID[uid]; !ok && uid != "" {
+				byUID[uid] = e
+			}
+		} else {
+			byContent[canonical] = append(byContent[canonical], e)
+		}
+	}
+
+	compare := func(b []byte, position service.Position) error {
+		report.Parsed++
+		file, lineNumber := lineOf(position)
+		uid, canonical, err := canonicalize(b, ignore)
+		if err != nil {
+			return fmt.Errorf("invalid parsed entry %s:%d, %w", file, lineNumber, err)
+		}
+
+		finding := Finding{File: file, Line: lineNumber, UID: uid, Parsed: b}
+		if opts.ByUID {
+			e, ok := byUID[uid]
+			if !ok || e.matched {
+				report.Missing = append(report.Missing, finding)
+				return nil
+			}
+
+			e.matched = true
+			if e.canonical != canonical {
+				finding.Stored = e.raw
+				report.Mismatched = append(report.Mismatched, finding)
+			}
+			return nil
+		}
+
+		candidates := byContent[canonical]
+		if len(candidates) == 0 {
+			report.Missing = append(report.Missing, finding)
+			return nil
+		}
+
+		candidates[0].matched = true
+		byContent[canonical] = candidates[1:]
+		return nil
+	}
+
+	fp := newFileLineProvider(pattern)
+	var lineProvider service.LineProvider = fp
+	if opts.Multiline.Enabled() {
+		var err error
+		lineProvider, err = service.NewMultilineLineProvider(fp, opts.Multiline)
+		if err != nil {
+			for range fp.ReadLine() {
+			}
+			return nil, err
+		}
+	}
+
+	pp, withPosition := lp.(service.PositionLineParser)
+	var compareErr error
+	for l := range lineProvider.ReadLine() {
+		if compareErr != nil {
+			continue
+		}
+
+		var b []byte
+		var err error
+		if withPosition {
+			b, err = pp.ParseAt(l.Text, l.Position)
+		} else {
+			b, err = lp.Parse(l.Text)
+		}
+
+		if errors.Is(err, service.ErrSkipLine) || errors.Is(err, service.ErrHoldLine) {
+			continue
+		} else if err != nil {
+			file, lineNumber := lineOf(l.Position)
+			log.WithError(err).WithField("file", file).WithField("line", lineNumber).Debug("Invalid line format")
+			report.Invalid = append(report.Invalid, Finding{File: file, Line: lineNumber, Error: err.Error()})
+			continue
+		}
+
+		compareErr = compare(b, l.Position)
+	}
+
+	if fp.err != nil {
+		return nil, fp.err
+	}
+
+	if compareErr != nil {
+		return nil, compareErr
+	}
+
+	if flp, ok := lp.(service.FlushLineParser); ok {
+		held, err := flp.Flush(true)
+		if err != nil {
+			return nil, fmt.Errorf("could not flush line parser, %w", err)
+		}
+
+		for _, e := range held {
+			var position service.Position
+			if len(e.Positions) > 0 {
+				position = e.Positions[len(e.Positions)-1]
+			}
+
+			err = compare(e.Entry, position)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	report.Lines = fp.lines
+
+	for _, e := range entries {
+		if !e.matched {
+			uid, _, _ := canonicalize(e.raw, nil)
+			report.Extra = append(report.Extra, Finding{UID: uid, Stored: e.raw})
+		}
+	}
+
+	return report, nil
+}
+
+// canonicalize returns uid and entry json without ignored fields with sorted keys
+func canonicalize(b []byte, ignore map[string]bool) (string, string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var m map[string]interface{}
+	err := decoder.Decode(&m)
+	if err != nil {
+		return "", "", err
+	}
+
+	uid, _ := m["uid"].(string)
+	for k := range m {
+		if ignore[k] || strings.HasPrefix(k, "_") {
+			delete(m, k)
+		}
+	}
+
+	c, err := json.Marshal(m)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uid, string(c), nil
+}
+
+// Print writes findings, one per line, followed by summary
+func (r *Report) Print(w io.Writer) {
+	for _, f := range r.Invalid {
+		fmt.Fprintf(w, "invalid %s:%d %s\n", f.File, f.Line, f.Error)
+	}
+
+	for _, f := range r.Missing {
+		fmt.Fprintf(w, "missing %s:%d %s\n", f.File, f.Line, string(f.Parsed))
+	}
+
+	for _, f := range r.Mismatched {
+		fmt.Fprintf(w, "mismatched %s:%d uid %s, expected %s, stored %s\n", f.File, f.Line, f.UID, string(f.Parsed), string(f.Stored))
+	}
+
+	for _, f := range r.Extra {
+		fmt.Fprintf(w, "extra uid %s %s\n", f.UID, string(f.Stored))
+	}
+
+	fmt.Fprintf(w, "lines: %d, invalid: %d, parsed: %d, stored: %d, missing: %d, mismatched: %d, extra: %d\n",
+		r.Lines, len(r.Invalid), r.Parsed, r.Stored, len(r.Missing), len(r.Mismatched), len(r.Extra))
+}
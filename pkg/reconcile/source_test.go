@@ -0,0 +1,162 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb-log-audit/pkg/lineparser"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/codenotary/immudb-log-audit/pkg/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("first\nsecond\nthird\n"), 0644))
+
+	// entries stored by tail, parsed with the same positions
+	ingest := func(lp service.PositionLineParser) [][]byte {
+		stored := [][]byte{}
+		err := source.ReadFileLines(logFile, func(file string, lineNumber int, line service.Line) error {
+			b, err := lp.ParseAt(line.Text, line.Position)
+			require.NoError(t, err)
+			stored = append(stored, b)
+			return nil
+		})
+		require.NoError(t, err)
+		return stored
+	}
+
+	t.Run("by content", func(t *testing.T) {
+		lp := lineparser.NewWrapLineParser(lineparser.Options{})
+		stored := ingest(lp)
+		stored = append(stored[:1], stored[2], []byte(`{"uid":"x","log_timestamp":"2023-06-01T00:00:00Z","message":"other","_id":"1"}`))
+
+		report, err := Source(logFile, lp, stored, Options{IgnoreFields: DefaultIgnoreFields})
+		require.NoError(t, err)
+		assert.False(t, report.OK())
+		assert.Equal(t, 3, report.Lines)
+		assert.Equal(t, 3, report.Parsed)
+		require.Len(t, report.Missing, 1)
+		assert.Equal(t, 2, report.Missing[0].Line)
+		require.Len(t, report.Extra, 1)
+		assert.Equal(t, "x", report.Extra[0].UID)
+		assert.Empty(t, report.Mismatched)
+	})
+
+	t.Run("by uid", func(t *testing.T) {
+		lp := lineparser.NewWrapLineParser(lineparser.Options{UIDMode: lineparser.UIDModeContent})
+		stored := ingest(lp)
+		stored[1] = []byte(strings.Replace(string(stored[1]), "second", "tampered", 1))
+		stored = stored[:2]
+
+		report, err := Source(logFile, lp, stored, Options{ByUID: true, IgnoreFields: DefaultIgnoreFields})
+		require.NoError(t, err)
+		require.Len(t, report.Mismatched, 1)
+		assert.Equal(t, 2, report.Mismatched[0].Line)
+		require.Len(t, report.Missing, 1)
+		assert.Equal(t, 3, report.Missing[0].Line)
+		assert.Empty(t, report.Extra)
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		lp := lineparser.NewWrapLineParser(lineparser.Options{UIDMode: lineparser.UIDModeContent})
+		report, err := Source(logFile, lp, ingest(lp), Options{ByUID: true, IgnoreFields: DefaultIgnoreFields})
+		require.NoError(t, err)
+		assert.True(t, report.OK())
+	})
+}
+
+type testRepository struct {
+	stored [][]byte
+}
+
+func (r *testRepository) WriteBytes(b [][]byte) (uint64, error) {
+	r.stored = append(r.stored, b...)
+	return 1, nil
+}
+
+// ingestSource stores lines of files the same way as tail does
+func ingestSource(t *testing.T, pattern string, lp service.LineParser, multiline service.MultilineOptions) [][]byte {
+	var lineProvider service.LineProvider = newFileLineProvider(pattern)
+	if multiline.Enabled() {
+		var err error
+		lineProvider, err = service.NewMultilineLineProvider(lineProvider, multiline)
+		require.NoError(t, err)
+	}
+
+	repo := &testRepository{}
+	require.NoError(t, service.NewAuditService(lineProvider, lp, repo).Run())
+	return repo.stored
+}
+
+func TestSourceMultiline(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("first\n  continued\nsecond\n"), 0644))
+
+	multiline := service.MultilineOptions{Continue: `^\s`}
+	lp := lineparser.NewWrapLineParser(lineparser.Options{UIDMode: lineparser.UIDModeContent})
+	stored := ingestSource(t, logFile, lp, multiline)
+	require.Len(t, stored, 2)
+
+	report, err := Source(logFile, lp, stored, Options{ByUID: true, IgnoreFields: DefaultIgnoreFields, Multiline: multiline})
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 3, report.Lines)
+	assert.Equal(t, 2, report.Parsed)
+
+	// lines of records are not stored on their own
+	report, err = Source(logFile, lp, stored, Options{ByUID: true, IgnoreFields: DefaultIgnoreFields})
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Len(t, report.Missing, 2)
+}
+
+func TestSourceHeldAndInvalidLines(t *testing.T) {
+	event := func(auditID string, stage string) string {
+		return `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"` + auditID + `","stage":"` + stage + `","requestURI":"/api","verb":"get"}`
+	}
+
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(logFile, []byte(strings.Join([]string{
+		event("a", "RequestReceived"),
+		event("b", "RequestReceived"),
+		event("a", "ResponseComplete"),
+		"not an event",
+	}, "\n")+"\n"), 0644))
+
+	opts := lineparser.Options{UIDMode: lineparser.UIDModeContent}
+	stored := ingestSource(t, logFile, lineparser.NewK8sAuditMergedLineParser(opts), service.MultilineOptions{})
+	require.Len(t, stored, 2)
+
+	report, err := Source(logFile, lineparser.NewK8sAuditMergedLineParser(opts), stored, Options{ByUID: true, IgnoreFields: DefaultIgnoreFields})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Parsed)
+	assert.Empty(t, report.Missing)
+	assert.Empty(t, report.Extra)
+	assert.Empty(t, report.Mismatched)
+
+	// invalid line was not stored
+	assert.False(t, report.OK())
+	require.Len(t, report.Invalid, 1)
+	assert.Equal(t, 4, report.Invalid[0].Line)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JsonFileRepository stores json entries in local NDJSON file, one entry per line. Access is
+// serialized with lock file next to it, so entries can be appended and rotated by different
+// processes, e.g. tail dead-lettering lines and replay.
+type JsonFileRepository struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewJsonFileRepository(path string) (*JsonFileRepository, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create directory, %w", err)
+	}
+
+	return &JsonFileRepository{path: path}, nil
+}
+
+// lock locks the file for this and other processes, returned function unlocks it
+func (jf *JsonFileRepository) lock() (func(), error) {
+	jf.mutex.Lock()
+	f, err := os.OpenFile(jf.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		jf.mutex.Unlock()
+		return nil, fmt.Errorf("could not open lock file, %w", err)
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		jf.mutex.Unlock()
+		return nil, fmt.Errorf("could not lock file, %w", err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+		jf.mutex.Unlock()
+	}, nil
+}
+
+// WriteBytes appends entries to the file and syncs it, there are no transactions so returned id is 0
+func (jf *JsonFileRepository) WriteBytes(jBytes [][]byte) (uint64, error) {
+	for _, b := range jBytes {
+		if bytes.ContainsAny(b, "\n") {
+			return 0, errors.New("entry contains new line")
+		}
+	}
+
+	unlock, err := jf.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return 0, appendEntries(jf.path, jBytes)
+}
+
+func appendEntries(path string, jBytes [][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open file, %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, b := range jBytes {
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("could not write file, %w", err)
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync file, %w", err)
+	}
+
+	return nil
+}
+
+// Read returns all entries, missing file has no entries
+func (jf *JsonFileRepository) Read() ([][]byte, error) {
+	unlock, err := jf.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return readEntries(jf.path)
+}
+
+func readEntries(path string) ([][]byte, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read file, %w", err)
+	}
+
+	entries := [][]byte{}
+	for _, l := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(l)) == 0 {
+			continue
+		}
+		entries = append(entries, l)
+	}
+
+	return entries, nil
+}
+
+// Rotate moves all entries to file with given suffix and returns repository of it, so they can
+// be processed while new entries are appended to the emptied file. When the rotated file exists
+// already, because its processing was not finished, entries are appended to it.
+func (jf *JsonFileRepository) Rotate(suffix string) (*JsonFileRepository, error) {
+	unlock, err := jf.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rotated := &JsonFileRepository{path: jf.path + suffix}
+	_, err = os.Stat(rotated.path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.Rename(jf.path, rotated.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("could not rotate file, %w", err)
+		}
+		return rotated, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not stat rotated file, %w", err)
+	}
+
+	entries, err := readEntries(jf.path)
+	if err != nil || len(entries) == 0 {
+		return rotated, err
+	}
+
+	err = appendEntries(rotated.path, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(jf.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not remove rotated file, %w", err)
+	}
+
+	return rotated, nil
+}
+
+// Remove deletes the file with all entries
+func (jf *JsonFileRepository) Remove() error {
+	unlock, err := jf.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(jf.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove file, %w", err)
+	}
+
+	return nil
+}
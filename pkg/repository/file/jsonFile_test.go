@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonFileRepository(t *testing.T) {
+	jf, err := NewJsonFileRepository(filepath.Join(t.TempDir(), "dead", "letters.ndjson"))
+	require.NoError(t, err)
+
+	entries, err := jf.Read()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = jf.WriteBytes([][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`)})
+	require.NoError(t, err)
+	_, err = jf.WriteBytes([][]byte{[]byte(`{"a":3}`)})
+	require.NoError(t, err)
+
+	_, err = jf.WriteBytes([][]byte{[]byte("{\n}")})
+	assert.Error(t, err)
+
+	entries, err = jf.Read()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`), []byte(`{"a":3}`)}, entries)
+
+}
+
+func TestJsonFileRepositoryRotate(t *testing.T) {
+	jf, err := NewJsonFileRepository(filepath.Join(t.TempDir(), "letters.ndjson"))
+	require.NoError(t, err)
+
+	_, err = jf.WriteBytes([][]byte{[]byte(`{"a":1}`)})
+	require.NoError(t, err)
+
+	rotated, err := jf.Rotate(".rotated")
+	require.NoError(t, err)
+
+	// entries appended after rotation stay in the file
+	_, err = jf.WriteBytes([][]byte{[]byte(`{"a":2}`)})
+	require.NoError(t, err)
+
+	entries, err := rotated.Read()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"a":1}`)}, entries)
+	entries, err = jf.Read()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"a":2}`)}, entries)
+
+	// not removed rotated file is rotated to again
+	rotated, err = jf.Rotate(".rotated")
+	require.NoError(t, err)
+	entries, err = rotated.Read()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`)}, entries)
+	entries, err = jf.Read()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, rotated.Remove())
+	entries, err = rotated.Read()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// missing file is rotated to empty one
+	rotated, err = jf.Rotate(".rotated")
+	require.NoError(t, err)
+	entries, err = rotated.Read()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
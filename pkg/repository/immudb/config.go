@@ -19,6 +19,7 @@ package immudb
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	immudb "github.com/codenotary/immudb/pkg/client"
 )
@@ -81,3 +82,25 @@ func (c *configs) WriteTypeParser(collection string, t string, p string) error {
 
 	return nil
 }
+
+// ReadParserOptions returns nil for collections created without parser options
+func (c *configs) ReadParserOptions(collection string) ([]byte, error) {
+	entry, err := c.cli.Get(context.TODO(), []byte(fmt.Sprintf("%s.config.parser.options", collection)))
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return entry.Value, nil
+}
+
+func (c *configs) WriteParserOptions(collection string, b []byte) error {
+	_, err := c.cli.Set(context.TODO(), []byte(fmt.Sprintf("%s.config.parser.options", collection)), b)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
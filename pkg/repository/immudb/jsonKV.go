@@ -17,6 +17,7 @@ limitations under the License.
 package immudb
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -168,6 +169,66 @@ func (jr *JsonKVRepository) WriteBytes(jBytesArr [][]byte) (uint64, error) {
 
 // for now just based on SK
 func (jr *JsonKVRepository) Read(key string, prefix string) ([][]byte, error) {
+	entries, err := jr.read(key, prefix, func(index *schema.Entry) (*schema.Entry, error) {
+		return jr.client.Get(context.Background(), index.Value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var objects [][]byte
+	for _, e := range entries {
+		objects = append(objects, e.Value)
+	}
+
+	return objects, nil
+}
+
+// VerifiedEntry was verified with immudb proofs against local trusted state
+type VerifiedEntry struct {
+	Entry    []byte
+	TxID     uint64
+	Revision uint64
+}
+
+// VerifiedRead reads the same entries as Read, each index entry returned by scan and each
+// entry it links to with verified get. Any failed verification stops reading and returns error.
+// Scan itself is not verifiable, so entries omitted by the server are not detected.
+func (jr *JsonKVRepository) VerifiedRead(key string, prefix string) ([]VerifiedEntry, error) {
+	entries, err := jr.read(key, prefix, func(index *schema.Entry) (*schema.Entry, error) {
+		verifiedIndex, err := jr.client.VerifiedGet(context.Background(), index.Key)
+		if err != nil {
+			return nil, fmt.Errorf("verification of index %s failed, %w", string(index.Key), err)
+		}
+
+		if verifiedIndex.Tx != index.Tx || !bytes.Equal(verifiedIndex.Value, index.Value) {
+			return nil, fmt.Errorf("verification of index %s failed, scanned entry at tx %d does not match verified one at tx %d", string(index.Key), index.Tx, verifiedIndex.Tx)
+		}
+
+		e, err := jr.client.VerifiedGet(context.Background(), index.Value)
+		if err != nil {
+			return nil, fmt.Errorf("verification of %s failed, %w", string(index.Value), err)
+		}
+		return e, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []VerifiedEntry
+	for _, e := range entries {
+		objects = append(objects, VerifiedEntry{
+			Entry:    e.Value,
+			TxID:     e.Tx,
+			Revision: e.Revision,
+		})
+	}
+
+	return objects, nil
+}
+
+// read scans index entries of key matching prefix, and gets entries they link to
+func (jr *JsonKVRepository) read(key string, prefix string, get func(index *schema.Entry) (*schema.Entry, error)) ([]*schema.Entry, error) {
 	if key == "" {
 		key = jr.indexedKeys[0]
 	}
@@ -183,7 +244,7 @@ func (jr *JsonKVRepository) Read(key string, prefix string) ([][]byte, error) {
 	}
 
 	seekKey := []byte("")
-	var objects [][]byte
+	var objects []*schema.Entry
 	for {
 		entries, err := jr.client.Scan(context.TODO(), &schema.ScanRequest{
 			Prefix:  []byte(fmt.Sprintf("%s.%s.{%s", jr.collection, key, prefix)),
@@ -201,7 +262,7 @@ func (jr *JsonKVRepository) Read(key string, prefix string) ([][]byte, error) {
 
 		for _, e := range entries.Entries {
 			// retrieve an object
-			objectEntry, err := jr.client.Get(context.Background(), e.Value)
+			objectEntry, err := get(e)
 			if err != nil {
 				return nil, fmt.Errorf("could not scan for object, %w", err)
 			}
@@ -209,7 +270,7 @@ func (jr *JsonKVRepository) Read(key string, prefix string) ([][]byte, error) {
 			seekKey = e.Key
 			// filter out possible old entries by secondary index
 			if e.Tx == objectEntry.Tx {
-				objects = append(objects, objectEntry.Value)
+				objects = append(objects, objectEntry)
 			}
 		}
 	}
@@ -254,3 +315,34 @@ func (imo *JsonKVRepository) History(primaryKeyValue string) ([]History, error)
 
 	return objects, nil
 }
+
+// VerifiedHistory returns history of the entry, each revision is checked with verified get
+// at the same revision and transaction. List of revisions comes from history, which is not
+// verifiable, so revisions omitted by the server are not detected.
+func (imo *JsonKVRepository) VerifiedHistory(primaryKeyValue string) ([]VerifiedEntry, error) {
+	history, err := imo.History(primaryKeyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte(fmt.Sprintf("%s.payload.%s.{%s}", imo.collection, imo.indexedKeys[0], primaryKeyValue))
+	verified := make([]VerifiedEntry, 0, len(history))
+	for _, h := range history {
+		e, err := imo.client.VerifiedGetAtRevision(context.TODO(), key, int64(h.Revision))
+		if err != nil {
+			return nil, fmt.Errorf("verification of revision %d failed, %w", h.Revision, err)
+		}
+
+		if e.Tx != h.TxID || !bytes.Equal(e.Value, h.Entry) {
+			return nil, fmt.Errorf("verification of revision %d failed, history entry tx %d does not match verified tx %d", h.Revision, h.TxID, e.Tx)
+		}
+
+		verified = append(verified, VerifiedEntry{
+			Entry:    e.Value,
+			TxID:     e.Tx,
+			Revision: h.Revision,
+		})
+	}
+
+	return verified, nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package immudb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+var varcharLength = regexp.MustCompile(`^VARCHAR\[(\d+)\]$`)
+
+// Validate returns problems which would prevent storing the entry, or leave it out of
+// secondary indexes
+func (jr *JsonKVRepository) Validate(jBytes []byte) []string {
+	if !gjson.ValidBytes(jBytes) {
+		return []string{"invalid json"}
+	}
+
+	if len(jr.indexedKeys) == 0 {
+		return []string{"primary key is mandataory"}
+	}
+
+	problems := []string{}
+	gjsonObject := gjson.ParseBytes(jBytes)
+	for _, pkPart := range strings.Split(jr.indexedKeys[0], "+") {
+		if !gjsonObject.Get(pkPart).Exists() {
+			problems = append(problems, fmt.Sprintf("missing primary key field %s", pkPart))
+		}
+	}
+
+	for _, k := range jr.indexedKeys[1:] {
+		if !gjsonObject.Get(k).Exists() {
+			problems = append(problems, fmt.Sprintf("missing indexed field %s", k))
+		}
+	}
+
+	return problems
+}
+
+// Validate returns problems which would prevent storing the entry, or store column values
+// different from entry fields
+func (jr *JsonSQLRepository) Validate(jBytes []byte) []string {
+	if !gjson.ValidBytes(jBytes) {
+		return []string{"invalid json"}
+	}
+
+	problems := []string{}
+	gjsonObject := gjson.ParseBytes(jBytes)
+	for _, c := range jr.columns {
+		if c.Name == "__value__" || c.CType == "INTEGER AUTO_INCREMENT" {
+			continue
+		}
+
+		gjr := gjsonObject.Get(c.Name)
+		if !gjr.Exists() {
+			if c.Primary {
+				problems = append(problems, fmt.Sprintf("missing primary key field %s", c.Name))
+			} else {
+				problems = append(problems, fmt.Sprintf("missing column field %s", c.Name))
+			}
+			continue
+		}
+
+		if p := validateColumn(c, gjr); p != "" {
+			problems = append(problems, p)
+		}
+	}
+
+	return problems
+}
+
+func validateColumn(c sqlcolumn, gjr gjson.Result) string {
+	switch {
+	case c.CType == "INTEGER":
+		if gjr.Type == gjson.Number && gjr.Num == float64(gjr.Int()) {
+			return ""
+		}
+		if _, err := strconv.ParseInt(gjr.Str, 10, 64); gjr.Type == gjson.String && err == nil {
+			return ""
+		}
+		return fmt.Sprintf("field %s is not an integer, %s", c.Name, gjr.Raw)
+	case c.CType == "FLOAT":
+		if gjr.Type != gjson.Number {
+			return fmt.Sprintf("field %s is not a number, %s", c.Name, gjr.Raw)
+		}
+	case c.CType == "BOOLEAN":
+		if !gjr.IsBool() {
+			return fmt.Sprintf("field %s is not a boolean, %s", c.Name, gjr.Raw)
+		}
+	case c.CType == "TIMESTAMP":
+		if gjr.Time().IsZero() {
+			return fmt.Sprintf("field %s is not RFC 3339 timestamp, %s", c.Name, gjr.Raw)
+		}
+	case strings.HasPrefix(c.CType, "VARCHAR"):
+		m := varcharLength.FindStringSubmatch(c.CType)
+		if m == nil {
+			return ""
+		}
+		max, _ := strconv.Atoi(m[1])
+		if len(gjr.String()) > max {
+			return fmt.Sprintf("field %s is longer than %d", c.Name, max)
+		}
+	default:
+		return fmt.Sprintf("unsupported field type %s", c.CType)
+	}
+
+	return ""
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package immudb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	kv := &JsonKVRepository{indexedKeys: []string{"session_id+statement_id", "user", "class"}}
+	assert.Empty(t, kv.Validate([]byte(`{"session_id":"a","statement_id":1,"user":"u","class":"READ"}`)))
+	assert.Equal(t, []string{"missing primary key field statement_id", "missing indexed field class"},
+		kv.Validate([]byte(`{"session_id":"a","user":"u"}`)))
+	assert.Equal(t, []string{"invalid json"}, kv.Validate([]byte(`{"a":`)))
+
+	sql := &JsonSQLRepository{columns: []sqlcolumn{
+		{Name: "id", CType: "INTEGER AUTO_INCREMENT", Primary: true},
+		{Name: "uid", CType: "VARCHAR[36]", Primary: true},
+		{Name: "statement_id", CType: "INTEGER"},
+		{Name: "log_timestamp", CType: "TIMESTAMP"},
+		{Name: "ok", CType: "BOOLEAN"},
+		{Name: "duration", CType: "FLOAT"},
+		{Name: "statement", CType: "VARCHAR"},
+	}}
+	assert.Empty(t, sql.Validate([]byte(`{"uid":"f233afdd-304b-44e8-90ee-a7757b46c49f","statement_id":"1","log_timestamp":"2023-05-13T21:09:08.502Z","ok":true,"duration":1.5,"statement":"select 1"}`)))
+	assert.Equal(t, []string{
+		"missing primary key field uid",
+		"field statement_id is not an integer, 1.5",
+		"field log_timestamp is not RFC 3339 timestamp, \"2023-05-13 21:09:08.502 GMT\"",
+		"field ok is not a boolean, \"yes\"",
+		"missing column field duration",
+	}, sql.Validate([]byte(`{"statement_id":1.5,"log_timestamp":"2023-05-13 21:09:08.502 GMT","ok":"yes","statement":"select 1"}`)))
+	assert.Equal(t, []string{"field uid is longer than 36"}, sql.Validate([]byte(`{"uid":"f233afdd-304b-44e8-90ee-a7757b46c49f-too-long","statement_id":1,"log_timestamp":"2023-05-13T21:09:08Z","ok":false,"duration":1,"statement":""}`)))
+}
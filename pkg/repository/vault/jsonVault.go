@@ -19,59 +19,83 @@ package vault
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 	log "github.com/sirupsen/logrus"
 )
 
+const batchSize = 100
+
 type JsonVaultRepository struct {
-	client     vaultclient.ClientWithResponsesInterface
-	ledger     string
-	collection string
-	batchMode  bool
+	client              vaultclient.ClientWithResponsesInterface
+	ledger              string
+	collection          string
+	batchMode           bool
+	retryPolicy         RetryPolicy
+	serverSigningPubKey *ecdsa.PublicKey
 }
 
 func NewJsonVaultRepository(client vaultclient.ClientWithResponsesInterface, ledger string, collection string, batchMode bool) (*JsonVaultRepository, error) {
 	return &JsonVaultRepository{
-		client:     client,
-		ledger:     ledger,
-		collection: collection,
-		batchMode:  batchMode,
+		client:      client,
+		ledger:      ledger,
+		collection:  collection,
+		batchMode:   batchMode,
+		retryPolicy: DefaultRetryPolicy(),
 	}, nil
 }
 
+// SetRetryPolicy changes how failed writes are retried
+func (jv *JsonVaultRepository) SetRetryPolicy(retryPolicy RetryPolicy) {
+	jv.retryPolicy = retryPolicy
+}
+
+// SetServerSigningPubKey makes proof verification and consistency checks accept only ledger
+// states signed with given key
+func (jv *JsonVaultRepository) SetServerSigningPubKey(key *ecdsa.PublicKey) {
+	jv.serverSigningPubKey = key
+}
+
+// WriteBytes stores entries one by one, or in chunks of batchSize in batch mode. When a write
+// fails after retries, returned error is service.PartialWriteError with number of entries
+// written before.
 func (jv *JsonVaultRepository) WriteBytes(jBytes [][]byte) (uint64, error) {
 	ctx := context.Background()
 	var txID uint64
 	if jv.batchMode {
 		//TODO: add ticker
-		docBuf := []byte(`{"documents": [`)
-		docBufCounter := 0
-		for i := 0; i < len(jBytes); i++ {
-			if docBufCounter > 0 {
-				docBuf = append(docBuf, ',')
-			}
-
-			docBuf = append(docBuf, jBytes[i]...)
-			docBufCounter++
-			if docBufCounter < 100 && i != len(jBytes)-1 {
-				continue
+		for start := 0; start < len(jBytes); start += batchSize {
+			end := start + batchSize
+			if end > len(jBytes) {
+				end = len(jBytes)
 			}
 
+			docBuf := []byte(`{"documents": [`)
+			docBuf = append(docBuf, bytes.Join(jBytes[start:end], []byte{','})...)
 			docBuf = append(docBuf, []byte("]}")...)
-			res, err := jv.client.DocumentCreateManyWithBodyWithResponse(ctx, jv.ledger, jv.collection, "application/json", bytes.NewBuffer(docBuf))
-			docBuf = []byte(`{"documents": [`)
-			docBufCounter = 0
+
+			// only the failed chunk is retried, chunks written before are not resent
+			var res *vaultclient.DocumentCreateManyResponse
+			err := jv.retry(ctx, func() (*http.Response, []byte, error) {
+				var err error
+				res, err = jv.client.DocumentCreateManyWithBodyWithResponse(ctx, jv.ledger, jv.collection, "application/json", bytes.NewReader(docBuf))
+				if err != nil {
+					return nil, nil, err
+				}
+				return res.HTTPResponse, res.Body, nil
+			})
 			if err != nil {
-				return 0, fmt.Errorf("error writing document to vault, %w", err)
+				return 0, &service.PartialWriteError{Written: start, Err: err}
 			}
 
 			if res.JSON200 == nil {
-				return 0, fmt.Errorf("error writing document to vault, %d, %s", res.StatusCode(), string(res.Body))
+				return 0, &service.PartialWriteError{Written: start, Err: fmt.Errorf("error writing document to vault, %d, %s", res.StatusCode(), string(res.Body))}
 			}
 
 			log.WithField("documentID", res.JSON200.DocumentIds[0]).WithField("txID", func() string {
@@ -91,13 +115,21 @@ func (jv *JsonVaultRepository) WriteBytes(jBytes [][]byte) (uint64, error) {
 	} else {
 		for i := 0; i < len(jBytes); i++ {
 			log.WithField("line", string(jBytes[i])).Debug("Writing line")
-			res, err := jv.client.DocumentCreateWithBodyWithResponse(ctx, jv.ledger, jv.collection, "application/json", bytes.NewReader(jBytes[i]))
+			var res *vaultclient.DocumentCreateResponse
+			err := jv.retry(ctx, func() (*http.Response, []byte, error) {
+				var err error
+				res, err = jv.client.DocumentCreateWithBodyWithResponse(ctx, jv.ledger, jv.collection, "application/json", bytes.NewReader(jBytes[i]))
+				if err != nil {
+					return nil, nil, err
+				}
+				return res.HTTPResponse, res.Body, nil
+			})
 			if err != nil {
-				return 0, fmt.Errorf("error writing document to vault, %w", err)
+				return 0, &service.PartialWriteError{Written: i, Err: err}
 			}
 
 			if res.JSON200 == nil {
-				return 0, fmt.Errorf("error writing document to vault, %d, %s", res.StatusCode(), string(res.Body))
+				return 0, &service.PartialWriteError{Written: i, Err: fmt.Errorf("error writing document to vault, %d, %s", res.StatusCode(), string(res.Body))}
 			}
 
 			log.WithField("documentID", res.JSON200.DocumentId).WithField("txID", func() string {
@@ -150,6 +182,35 @@ func (jv *JsonVaultRepository) Write(jObject interface{}) (uint64, error) {
 }
 
 func (jv *JsonVaultRepository) Read(queryString string) ([][]byte, error) {
+	var query *vaultclient.Query
+	if queryString != "" {
+		query = &vaultclient.Query{}
+		err := json.Unmarshal([]byte(queryString), query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query, %w", err)
+		}
+	}
+
+	revisions, err := jv.search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents [][]byte
+	for _, d := range revisions {
+		document, err := json.Marshal(d.Document)
+		if err != nil {
+			log.WithError(err).WithField("document", d.Document).Error("Could not marshal document")
+			continue
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+func (jv *JsonVaultRepository) search(query *vaultclient.Query) ([]vaultclient.DocumentAtRevision, error) {
 	ctx := context.Background()
 
 	keepOpen := true
@@ -157,18 +218,10 @@ func (jv *JsonVaultRepository) Read(queryString string) ([][]byte, error) {
 		Page:     1,
 		PerPage:  100,
 		KeepOpen: &keepOpen,
+		Query:    query,
 	}
 
-	if queryString != "" {
-		query := vaultclient.Query{}
-		err := json.Unmarshal([]byte(queryString), &query)
-		if err != nil {
-			return nil, fmt.Errorf("invalid query, %w", err)
-		}
-		req.Query = &query
-	}
-
-	var documents [][]byte
+	var revisions []vaultclient.DocumentAtRevision
 
 	for {
 		res, err := jv.client.SearchDocumentWithResponse(ctx, jv.ledger, jv.collection, req)
@@ -180,15 +233,7 @@ func (jv *JsonVaultRepository) Read(queryString string) ([][]byte, error) {
 			return nil, fmt.Errorf("error querying vault, %d, %s", res.StatusCode(), string(res.Body))
 		}
 
-		for _, d := range res.JSON200.Revisions {
-			document, err := json.Marshal(d.Document)
-			if err != nil {
-				log.WithError(err).WithField("document", d.Document).Error("Could not marshal document")
-				continue
-			}
-
-			documents = append(documents, document)
-		}
+		revisions = append(revisions, res.JSON200.Revisions...)
 
 		if res.JSON200.SearchId == "" || len(res.JSON200.Revisions) == 0 {
 			break
@@ -198,7 +243,7 @@ func (jv *JsonVaultRepository) Read(queryString string) ([][]byte, error) {
 		req.SearchId = &res.JSON200.SearchId
 	}
 
-	return documents, nil
+	return revisions, nil
 }
 
 func (jv *JsonVaultRepository) Audit(documentID string) ([][]byte, error) {
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonVaultRepositoryRetry(t *testing.T) {
+	type testData struct {
+		name      string
+		batchMode bool
+		docs      int
+		statuses  []int
+		expectErr bool
+		requests  int
+		written   int
+		// entries reported as written by failed write
+		partial int
+	}
+
+	tdd := []testData{
+		{
+			name:     "server errors and rate limit are retried",
+			docs:     1,
+			statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			requests: 3,
+			written:  1,
+		},
+		{
+			name:      "validation error fails fast",
+			docs:      2,
+			statuses:  []int{http.StatusBadRequest},
+			expectErr: true,
+			requests:  1,
+		},
+		{
+			name:      "attempts are limited",
+			docs:      1,
+			statuses:  []int{500, 500, 500, 500},
+			expectErr: true,
+			requests:  3,
+		},
+		{
+			name:      "only failed chunk is retried in batch mode",
+			batchMode: true,
+			docs:      250,
+			statuses:  []int{http.StatusOK, http.StatusBadGateway, http.StatusOK, http.StatusOK},
+			requests:  4,
+			written:   250,
+		},
+		{
+			name:      "chunks written before failure are reported in batch mode",
+			batchMode: true,
+			docs:      250,
+			statuses:  []int{http.StatusOK, http.StatusBadRequest},
+			expectErr: true,
+			requests:  2,
+			written:   100,
+			partial:   100,
+		},
+		{
+			name:      "documents written before failure are reported",
+			docs:      3,
+			statuses:  []int{http.StatusOK, http.StatusOK, http.StatusBadRequest},
+			expectErr: true,
+			requests:  3,
+			written:   2,
+			partial:   2,
+		},
+	}
+
+	for _, td := range tdd {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			requests := 0
+			written := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := http.StatusOK
+				if requests < len(td.statuses) {
+					status = td.statuses[requests]
+				}
+				requests++
+
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(status)
+				if status != http.StatusOK {
+					fmt.Fprint(w, `{"error":"failed"}`)
+					return
+				}
+
+				if !strings.HasSuffix(r.URL.Path, "/documents") {
+					written++
+					fmt.Fprint(w, `{"documentId":"1","transactionId":"1"}`)
+					return
+				}
+
+				var req struct {
+					Documents []json.RawMessage `json:"documents"`
+				}
+				require.NoError(t, json.Unmarshal(body, &req))
+				written += len(req.Documents)
+				ids := make([]string, len(req.Documents))
+				res, _ := json.Marshal(vaultclient.DocumentInsertManyResponse{DocumentIds: ids})
+				w.Write(res)
+			}))
+			defer server.Close()
+
+			client, err := vaultclient.NewClientWithResponses(server.URL)
+			require.NoError(t, err)
+
+			jv, err := NewJsonVaultRepository(client, "default", "default", td.batchMode)
+			require.NoError(t, err)
+			jv.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+			docs := [][]byte{}
+			for i := 0; i < td.docs; i++ {
+				docs = append(docs, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+			}
+
+			_, err = jv.WriteBytes(docs)
+			if td.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, td.partial, service.Written(err))
+			assert.Equal(t, td.requests, requests)
+			assert.Equal(t, td.written, written)
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, 3*time.Second, retryAfter("3"))
+	assert.Equal(t, time.Duration(0), retryAfter("invalid"))
+	d := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 50*time.Second && d <= time.Minute)
+}
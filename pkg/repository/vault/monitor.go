@@ -0,0 +1,185 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ErrNotConsistent is returned when ledger could not prove it is an append-only extension of trusted state
+var ErrNotConsistent = errors.New("ledger is not consistent with trusted state")
+
+// ConsistencyResult is the outcome of consistency check
+type ConsistencyResult struct {
+	Trusted *schema.ImmutableState
+	Current *schema.ImmutableState
+	// Proven is false when the ledger moved forward, but no witness document could be written
+	// to prove it, Trusted state is then not advanced
+	Proven bool
+}
+
+// CheckConsistency compares current ledger state with trusted state stored in stateDir. When
+// server signing key is set, current state needs to be signed with it.
+// Vault provides only document proofs, so when the ledger moved forward and writeWitness is set,
+// a witness document is written to the repository collection, and both trusted and current
+// states are proven against its transaction. As both are then part of witness transaction
+// history, current state is an append-only extension of the trusted one. New trusted state is
+// saved. Without witness, it is only checked that the ledger did not go back behind trusted
+// state, and current state is trusted when there is no trusted state yet.
+func (jv *JsonVaultRepository) CheckConsistency(stateDir string, writeWitness bool) (*ConsistencyResult, error) {
+	ctx := context.Background()
+
+	stateFile := jv.stateFile(stateDir)
+	trustedState, err := readState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	currentState, err := jv.currentState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if jv.serverSigningPubKey != nil {
+		ok, err := currentState.CheckSignature(jv.serverSigningPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w, current state signature could not be checked, %s", ErrNotConsistent, err.Error())
+		} else if !ok {
+			return nil, fmt.Errorf("%w, current state signature is not valid", ErrNotConsistent)
+		}
+	}
+
+	if trustedState != nil && currentState.TxId < trustedState.TxId {
+		return nil, fmt.Errorf("%w, current tx %d is older than trusted tx %d", ErrNotConsistent, currentState.TxId, trustedState.TxId)
+	}
+
+	if trustedState != nil && currentState.TxId == trustedState.TxId {
+		if !bytes.Equal(currentState.TxHash, trustedState.TxHash) {
+			return nil, fmt.Errorf("%w, hash of tx %d differs from trusted one", ErrNotConsistent, currentState.TxId)
+		}
+
+		log.WithField("txID", currentState.TxId).Debug("Ledger state unchanged")
+		return &ConsistencyResult{Trusted: trustedState, Current: currentState, Proven: true}, nil
+	}
+
+	if !writeWitness {
+		if trustedState == nil {
+			log.WithField("txID", currentState.TxId).Info("No trusted state, trusting current ledger state")
+			err = writeState(stateFile, currentState)
+			if err != nil {
+				return nil, err
+			}
+			return &ConsistencyResult{Trusted: currentState, Current: currentState, Proven: true}, nil
+		}
+
+		log.WithField("currentTxID", currentState.TxId).WithField("trustedTxID", trustedState.TxId).Debug("Ledger moved forward, not proven without witness")
+		return &ConsistencyResult{Trusted: trustedState, Current: currentState}, nil
+	}
+
+	documentID, txID, witness, err := jv.writeWitness(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// only proofs which do not hold mean inconsistency, errors getting them can be retried
+	newState, err := jv.verifyProof(ctx, documentID, txID, witness, trustedState)
+	if isProofNotValid(err) {
+		return nil, fmt.Errorf("%w, trusted state proof failed, %s", ErrNotConsistent, err.Error())
+	} else if err != nil {
+		return nil, fmt.Errorf("could not prove trusted state, %w", err)
+	}
+
+	witnessState, err := jv.verifyProof(ctx, documentID, txID, witness, currentState)
+	if isProofNotValid(err) {
+		return nil, fmt.Errorf("%w, current state proof failed, %s", ErrNotConsistent, err.Error())
+	} else if err != nil {
+		return nil, fmt.Errorf("could not prove current state, %w", err)
+	}
+
+	if newState.TxId != witnessState.TxId || !bytes.Equal(newState.TxHash, witnessState.TxHash) {
+		return nil, fmt.Errorf("%w, witness tx %d proven with different hashes", ErrNotConsistent, txID)
+	}
+
+	err = writeState(stateFile, newState)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("currentTxID", currentState.TxId).WithField("trustedTxID", newState.TxId).Debug("Ledger state consistent")
+
+	return &ConsistencyResult{Trusted: newState, Current: currentState, Proven: true}, nil
+}
+
+func (jv *JsonVaultRepository) currentState(ctx context.Context) (*schema.ImmutableState, error) {
+	res, err := jv.client.GetCurrentStateWithResponse(ctx, jv.ledger)
+	if err != nil {
+		return nil, fmt.Errorf("error getting current state, %w", err)
+	}
+
+	if res.JSON200 == nil {
+		return nil, fmt.Errorf("error getting current state, %d, %s", res.StatusCode(), string(res.Body))
+	}
+
+	stateJSON, err := json.Marshal(res.JSON200)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal current state, %w", err)
+	}
+
+	state := &schema.ImmutableState{}
+	err = protojson.Unmarshal(stateJSON, state)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal current state, %w", err)
+	}
+
+	return state, nil
+}
+
+func (jv *JsonVaultRepository) writeWitness(ctx context.Context) (string, uint64, vaultclient.Document, error) {
+	witness := vaultclient.Document{
+		"monitor":   "vault-log-audit",
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	res, err := jv.client.DocumentCreateWithResponse(ctx, jv.ledger, jv.collection, witness)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("error writing witness document, %w", err)
+	}
+
+	if res.JSON200 == nil || res.JSON200.TransactionId == nil {
+		return "", 0, nil, fmt.Errorf("error writing witness document, %d, %s", res.StatusCode(), string(res.Body))
+	}
+
+	txID, err := strconv.ParseUint(*res.JSON200.TransactionId, 10, 64)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("invalid transaction id %s, %w", *res.JSON200.TransactionId, err)
+	}
+
+	witness[documentIDField] = res.JSON200.DocumentId
+
+	return res.JSON200.DocumentId, txID, witness, nil
+}
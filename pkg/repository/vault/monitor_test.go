@@ -0,0 +1,152 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"testing"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb/pkg/signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	tv := proofServer(t, 2)
+	client, err := vaultclient.NewClientWithResponses(tv.server.URL)
+	require.NoError(t, err)
+
+	jv, err := NewJsonVaultRepository(client, "default", "default", false)
+	require.NoError(t, err)
+
+	stateDir := t.TempDir()
+	result, err := jv.CheckConsistency(stateDir, true)
+	require.NoError(t, err)
+	assert.True(t, result.Proven)
+	assert.Len(t, tv.docs, 3, "witness document written for unknown state")
+	state := result.Trusted
+
+	// nothing changed, state is compared only
+	unchanged, err := jv.CheckConsistency(stateDir, true)
+	require.NoError(t, err)
+	assert.Equal(t, state.TxId, unchanged.Trusted.TxId)
+	assert.Len(t, tv.docs, 3)
+
+	// ledger moved forward
+	_, err = jv.VerifyDocument(tv.ids[0], stateDir)
+	require.NoError(t, err)
+	_, err = client.DocumentCreateWithResponse(context.Background(), "default", "default", vaultclient.Document{"message": "new"})
+	require.NoError(t, err)
+	advanced, err := jv.CheckConsistency(stateDir, true)
+	require.NoError(t, err)
+	assert.Greater(t, advanced.Trusted.TxId, state.TxId)
+
+	// current state does not extend trusted one
+	_, err = client.DocumentCreateWithResponse(context.Background(), "default", "default", vaultclient.Document{"message": "forked"})
+	require.NoError(t, err)
+	tv.forkedState = true
+	_, err = jv.CheckConsistency(stateDir, true)
+	assert.ErrorIs(t, err, ErrNotConsistent)
+
+	tv.forkedState = false
+	same, err := jv.CheckConsistency(stateDir, true)
+	require.NoError(t, err)
+	assert.Greater(t, same.Trusted.TxId, advanced.Trusted.TxId)
+
+	// proof which cannot be fetched does not mean inconsistency
+	_, err = client.DocumentCreateWithResponse(context.Background(), "default", "default", vaultclient.Document{"message": "unavailable"})
+	require.NoError(t, err)
+	tv.proofStatus = http.StatusServiceUnavailable
+	_, err = jv.CheckConsistency(stateDir, true)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotConsistent)
+}
+
+func TestCheckConsistencyWithoutWitness(t *testing.T) {
+	tv := proofServer(t, 2)
+	client, err := vaultclient.NewClientWithResponses(tv.server.URL)
+	require.NoError(t, err)
+
+	jv, err := NewJsonVaultRepository(client, "default", "default", false)
+	require.NoError(t, err)
+
+	// current state is trusted on first check
+	stateDir := t.TempDir()
+	result, err := jv.CheckConsistency(stateDir, false)
+	require.NoError(t, err)
+	assert.True(t, result.Proven)
+	assert.Len(t, tv.docs, 2, "no witness document written")
+	state := result.Trusted
+
+	// ledger moved forward, trusted state is not advanced without proof
+	_, err = client.DocumentCreateWithResponse(context.Background(), "default", "default", vaultclient.Document{"message": "new"})
+	require.NoError(t, err)
+	result, err = jv.CheckConsistency(stateDir, false)
+	require.NoError(t, err)
+	assert.False(t, result.Proven)
+	assert.Equal(t, state.TxId, result.Trusted.TxId)
+	assert.Greater(t, result.Current.TxId, state.TxId)
+	assert.Len(t, tv.docs, 3)
+
+	// changed hash of trusted tx is detected
+	forkedDir := t.TempDir()
+	tv.forkedState = true
+	_, err = jv.CheckConsistency(forkedDir, false)
+	require.NoError(t, err)
+	tv.forkedState = false
+	_, err = jv.CheckConsistency(forkedDir, false)
+	assert.ErrorIs(t, err, ErrNotConsistent)
+}
+
+func TestCheckConsistencySignature(t *testing.T) {
+	tv := proofServer(t, 2)
+	client, err := vaultclient.NewClientWithResponses(tv.server.URL)
+	require.NoError(t, err)
+
+	jv, err := NewJsonVaultRepository(client, "default", "default", false)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jv.SetServerSigningPubKey(&key.PublicKey)
+
+	// server does not sign states
+	_, err = jv.CheckConsistency(t.TempDir(), false)
+	assert.ErrorIs(t, err, ErrNotConsistent)
+
+	// states signed with other key
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tv.signer = signer.NewSignerFromPKey(rand.Reader, otherKey)
+	_, err = jv.CheckConsistency(t.TempDir(), false)
+	assert.ErrorIs(t, err, ErrNotConsistent)
+	_, err = jv.VerifyDocument(tv.ids[0], t.TempDir())
+	assert.Error(t, err)
+
+	tv.signer = signer.NewSignerFromPKey(rand.Reader, key)
+	stateDir := t.TempDir()
+	result, err := jv.CheckConsistency(stateDir, true)
+	require.NoError(t, err)
+	assert.True(t, result.Proven)
+	_, err = jv.VerifyDocument(tv.ids[0], stateDir)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb/pkg/api/protomodel"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/verification"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const documentIDField = "_id"
+
+// VerifiedDocument is a document which proof was verified locally against trusted state
+type VerifiedDocument struct {
+	Document      []byte
+	TransactionID uint64
+	Revision      string
+	State         *schema.ImmutableState
+}
+
+// VerifyDocument reads the document the same way as Read, fetches its proof and verifies
+// inclusion and dual proofs locally. Trusted state is read from and saved to stateDir, so each
+// verification is also checked to be consistent with previous ones.
+func (jv *JsonVaultRepository) VerifyDocument(documentID string, stateDir string) (*VerifiedDocument, error) {
+	ctx := context.Background()
+
+	expressions := []vaultclient.QueryExpression{{
+		FieldComparisons: &[]vaultclient.FieldComparison{{
+			Field:    documentIDField,
+			Operator: vaultclient.EQ,
+			Value:    documentID,
+		}},
+	}}
+	revisions, err := jv.search(&vaultclient.Query{Expressions: &expressions})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) != 1 {
+		return nil, fmt.Errorf("expected exactly one document with id %s, found %d", documentID, len(revisions))
+	}
+
+	revision := revisions[0]
+	txID, err := strconv.ParseUint(revision.TransactionId, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction id %s, %w", revision.TransactionId, err)
+	}
+
+	stateFile := jv.stateFile(stateDir)
+	knownState, err := readState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	newState, err := jv.verifyProof(ctx, documentID, txID, revision.Document, knownState)
+	if err != nil {
+		return nil, fmt.Errorf("document %s verification failed, %w", documentID, err)
+	}
+
+	err = writeState(stateFile, newState)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("document", documentID).WithField("txID", txID).WithField("stateTxID", newState.TxId).Debug("Document verified")
+
+	document, err := json.Marshal(revision.Document)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal document, %w", err)
+	}
+
+	return &VerifiedDocument{
+		Document:      document,
+		TransactionID: txID,
+		Revision:      revision.Revision,
+		State:         newState,
+	}, nil
+}
+
+func (jv *JsonVaultRepository) stateFile(stateDir string) string {
+	return filepath.Join(stateDir, fmt.Sprintf(".vault-state-%s.json", jv.ledger))
+}
+
+// proofNotValidError wraps errors of proofs which were fetched, but do not prove the document
+// or the state, as opposed to errors getting the proof
+type proofNotValidError struct {
+	err error
+}
+
+func (e *proofNotValidError) Error() string {
+	return e.err.Error()
+}
+
+func (e *proofNotValidError) Unwrap() error {
+	return e.err
+}
+
+func isProofNotValid(err error) bool {
+	var pErr *proofNotValidError
+	return errors.As(err, &pErr)
+}
+
+// verifyProof fetches proof of the document at given transaction, proven since known state,
+// and verifies it locally. When server signing key is set, proven state needs to be signed
+// with it. Returns new trusted state.
+func (jv *JsonVaultRepository) verifyProof(ctx context.Context, documentID string, txID uint64, document vaultclient.Document, knownState *schema.ImmutableState) (*schema.ImmutableState, error) {
+	req := vaultclient.GetDocumentProofJSONRequestBody{
+		TransactionId: int(txID),
+	}
+	if knownState != nil {
+		sinceTxID := int(knownState.TxId)
+		req.ProofSinceTransactionId = &sinceTxID
+	}
+
+	res, err := jv.client.GetDocumentProofWithResponse(ctx, jv.ledger, jv.collection, documentID, req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting document proof, %w", err)
+	}
+
+	if res.JSON200 == nil {
+		return nil, fmt.Errorf("error getting document proof, %d, %s", res.StatusCode(), string(res.Body))
+	}
+
+	proof, err := proofFromResponse(res.JSON200)
+	if err != nil {
+		return nil, err
+	}
+
+	if knownState != nil && knownState.Db != "" && knownState.Db != proof.Database {
+		return nil, &proofNotValidError{err: fmt.Errorf("trusted state is for database %s, proof is for %s", knownState.Db, proof.Database)}
+	}
+
+	doc, err := structpb.NewStruct(document)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert document, %w", err)
+	}
+
+	newState, err := verification.VerifyDocument(ctx, proof, doc, knownState, jv.serverSigningPubKey)
+	if err != nil {
+		return nil, &proofNotValidError{err: err}
+	}
+
+	return newState, nil
+}
+
+// proofFromResponse converts rest response into proto message, generated types follow
+// the proto json mapping, so they are converted through json
+func proofFromResponse(res *vaultclient.DocumentProofResponse) (*protomodel.ProofDocumentResponse, error) {
+	if res.VerifiableTx.Tx == nil || res.VerifiableTx.Tx.Header == nil || res.VerifiableTx.DualProof == nil ||
+		res.VerifiableTx.DualProof.SourceTxHeader == nil || res.VerifiableTx.DualProof.TargetTxHeader == nil {
+		return nil, errors.New("incomplete document proof")
+	}
+
+	if res.CollectionId < 0 || res.CollectionId > int64(^uint32(0)) {
+		return nil, fmt.Errorf("invalid collection id %d", res.CollectionId)
+	}
+
+	vtxJSON, err := json.Marshal(res.VerifiableTx)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal verifiable tx, %w", err)
+	}
+
+	vtx := &schema.VerifiableTxV2{}
+	err = protojson.Unmarshal(vtxJSON, vtx)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal verifiable tx, %w", err)
+	}
+
+	return &protomodel.ProofDocumentResponse{
+		Database:            res.Database,
+		CollectionId:        uint32(res.CollectionId),
+		DocumentIdFieldName: res.IdFieldName,
+		EncodedDocument:     res.EncodedDocument,
+		VerifiableTx:        vtx,
+	}, nil
+}
+
+func readState(stateFile string) (*schema.ImmutableState, error) {
+	b, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.WithField("file", stateFile).Info("No trusted state, verifying from the first transaction")
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read trusted state, %w", err)
+	}
+
+	state := &schema.ImmutableState{}
+	err = protojson.Unmarshal(b, state)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal trusted state, %w", err)
+	}
+
+	return state, nil
+}
+
+func writeState(stateFile string, state *schema.ImmutableState) error {
+	b, err := protojson.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("could not marshal trusted state, %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(stateFile), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create state directory, %w", err)
+	}
+
+	tmpFile := stateFile + ".tmp"
+	err = os.WriteFile(tmpFile, b, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write trusted state, %w", err)
+	}
+
+	err = os.Rename(tmpFile, stateFile)
+	if err != nil {
+		return fmt.Errorf("could not write trusted state, %w", err)
+	}
+
+	return nil
+}
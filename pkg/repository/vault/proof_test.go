@@ -0,0 +1,219 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/codenotary/immudb/embedded/document"
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type testVault struct {
+	server *httptest.Server
+	ids    []string
+	docs   map[string]map[string]interface{}
+	// forkedState makes current state hash differ from the real one
+	forkedState bool
+	// signer signs ledger states when set
+	signer signer.Signer
+	// proofStatus is returned instead of document proof when set
+	proofStatus int
+}
+
+// sign returns signature of the state, or nil when server does not sign states
+func (tv *testVault) sign(t *testing.T, state *schema.ImmutableState) *schema.Signature {
+	if tv.signer == nil {
+		return nil
+	}
+
+	sig, pub, err := tv.signer.Sign(state.ToBytes())
+	require.NoError(t, err)
+	return &schema.Signature{Signature: sig, PublicKey: pub}
+}
+
+// proofServer serves documents, their proofs and ledger state the same way vault does, backed by embedded document engine
+func proofServer(t *testing.T, documents int) *testVault {
+	ctx := context.Background()
+	tv := &testVault{}
+	st, err := store.Open(t.TempDir(), store.DefaultOptions())
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	engine, err := document.NewEngine(st, document.DefaultOptions().WithPrefix([]byte{3}))
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateCollection(ctx, "default", "", nil, nil))
+
+	tv.docs = map[string]map[string]interface{}{}
+	txIDs := map[string]uint64{}
+	insert := func(document map[string]interface{}) (string, uint64) {
+		doc, err := structpb.NewStruct(document)
+		require.NoError(t, err)
+		txID, docID, err := engine.InsertDocument(ctx, "default", doc)
+		require.NoError(t, err)
+
+		id := docID.EncodeToHexString()
+		txIDs[id] = txID
+		tv.docs[id] = map[string]interface{}{"_id": id}
+		for k, v := range document {
+			tv.docs[id][k] = v
+		}
+		return id, txID
+	}
+
+	for i := 0; i < documents; i++ {
+		id, _ := insert(map[string]interface{}{"message": fmt.Sprintf("line %d", i)})
+		tv.ids = append(tv.ids, id)
+	}
+
+	tv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/state") {
+			txID, alh := st.CommittedAlh()
+			if tv.forkedState {
+				alh[0]++
+			}
+			state := &schema.ImmutableState{Db: "defaultdb", TxId: txID, TxHash: alh[:]}
+			state.Signature = tv.sign(t, state)
+			b, err := protojson.Marshal(state)
+			require.NoError(t, err)
+			w.Write(b)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/document") {
+			var doc map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&doc))
+			id, txID := insert(doc)
+			txIDString := fmt.Sprint(txID)
+			json.NewEncoder(w).Encode(vaultclient.DocumentInsertResponse{DocumentId: id, TransactionId: &txIDString})
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/documents/search") {
+			var req vaultclient.DocumentSearchRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req.SearchId != nil {
+				json.NewEncoder(w).Encode(vaultclient.DocumentSearchResponse{})
+				return
+			}
+			id := (*(*req.Query.Expressions)[0].FieldComparisons)[0].Value.(string)
+			json.NewEncoder(w).Encode(vaultclient.DocumentSearchResponse{
+				SearchId: "1",
+				Revisions: []vaultclient.DocumentAtRevision{{
+					Document:      tv.docs[id],
+					TransactionId: fmt.Sprint(txIDs[id]),
+				}},
+			})
+			return
+		}
+
+		if tv.proofStatus != 0 {
+			w.WriteHeader(tv.proofStatus)
+			return
+		}
+
+		var req vaultclient.DocumentProofRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		path := strings.Split(r.URL.Path, "/")
+		id := path[len(path)-2]
+		docID, err := document.NewDocumentIDFromHexEncodedString(id)
+		require.NoError(t, err)
+
+		collectionID, idFieldName, encoded, err := engine.GetEncodedDocument(ctx, "default", docID, uint64(req.TransactionId))
+		require.NoError(t, err)
+
+		txHolder := store.NewTx(st.MaxTxEntries(), st.MaxKeyLen())
+		require.NoError(t, st.ReadTx(encoded.TxID, false, txHolder))
+
+		since := uint64(1)
+		if req.ProofSinceTransactionId != nil {
+			since = uint64(*req.ProofSinceTransactionId)
+		}
+		sinceHdr, err := st.ReadTxHeader(since, false, false)
+		require.NoError(t, err)
+
+		sourceHdr, targetHdr := sinceHdr, txHolder.Header()
+		if targetHdr.ID < sourceHdr.ID {
+			sourceHdr, targetHdr = targetHdr, sourceHdr
+		}
+		dualProof, err := st.DualProofV2(sourceHdr, targetHdr)
+		require.NoError(t, err)
+
+		targetAlh := targetHdr.Alh()
+		vtxJSON, err := protojson.Marshal(&schema.VerifiableTxV2{
+			Tx:        schema.TxToProto(txHolder),
+			DualProof: schema.DualProofV2ToProto(dualProof),
+			Signature: tv.sign(t, &schema.ImmutableState{Db: "defaultdb", TxId: targetHdr.ID, TxHash: targetAlh[:]}),
+		})
+		require.NoError(t, err)
+
+		res := vaultclient.DocumentProofResponse{
+			CollectionId:    int64(collectionID),
+			Database:        "defaultdb",
+			EncodedDocument: encoded.EncodedDocument,
+			IdFieldName:     idFieldName,
+		}
+		require.NoError(t, json.Unmarshal(vtxJSON, &res.VerifiableTx))
+
+		b, err := json.Marshal(res)
+		require.NoError(t, err)
+		w.Write(b)
+	}))
+	t.Cleanup(tv.server.Close)
+
+	return tv
+}
+
+func TestVerifyDocument(t *testing.T) {
+	tv := proofServer(t, 3)
+	ids := tv.ids
+	client, err := vaultclient.NewClientWithResponses(tv.server.URL)
+	require.NoError(t, err)
+
+	jv, err := NewJsonVaultRepository(client, "default", "default", false)
+	require.NoError(t, err)
+
+	stateDir := t.TempDir()
+	verified, err := jv.VerifyDocument(ids[2], stateDir)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"message":"line 2","_id":"`+ids[2]+`"}`, string(verified.Document))
+	stateTxID := verified.State.TxId
+
+	// older document is verified against already trusted newer state
+	verified, err = jv.VerifyDocument(ids[0], stateDir)
+	require.NoError(t, err)
+	assert.Equal(t, stateTxID, verified.State.TxId)
+
+	// document returned by read differs from the one in proof
+	tv.docs[ids[1]]["message"] = "tampered"
+	_, err = jv.VerifyDocument(ids[1], stateDir)
+	assert.ErrorIs(t, err, store.ErrInvalidProof)
+}
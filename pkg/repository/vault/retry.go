@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		MinBackoff:  time.Second,
+		MaxBackoff:  30 * time.Second,
+	}
+}
+
+// StatusError is returned when vault responds with not successful status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error writing document to vault, %d, %s", e.StatusCode, e.Body)
+}
+
+// Retryable is true for rate limiting and server errors, other client errors like failed
+// validation would fail the same way again.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout || e.StatusCode >= 500
+}
+
+// retry calls write until vault responds with 200, fails with not retryable status or
+// attempts are exhausted. Transport errors are always retried.
+func (jv *JsonVaultRepository) retry(ctx context.Context, write func() (*http.Response, []byte, error)) error {
+	backoff := jv.retryPolicy.MinBackoff
+	for attempt := 1; ; attempt++ {
+		res, body, err := write()
+		var delay time.Duration
+		if err != nil {
+			err = fmt.Errorf("error writing document to vault, %w", err)
+		} else if res.StatusCode == http.StatusOK {
+			if attempt > 1 {
+				log.WithField("attempt", attempt).Info("Vault write succeeded after retry")
+			}
+			return nil
+		} else {
+			statusErr := &StatusError{StatusCode: res.StatusCode, Body: string(body)}
+			if !statusErr.Retryable() {
+				log.WithError(statusErr).WithField("attempt", attempt).Error("Vault write rejected, not retrying")
+				return statusErr
+			}
+			delay = retryAfter(res.Header.Get("Retry-After"))
+			err = statusErr
+		}
+
+		if attempt >= jv.retryPolicy.MaxAttempts {
+			log.WithError(err).WithField("attempt", attempt).Error("Vault write failed, giving up")
+			return fmt.Errorf("giving up after %d attempts, %w", attempt, err)
+		}
+
+		if delay == 0 {
+			delay = backoff
+			backoff *= 2
+			if backoff > jv.retryPolicy.MaxBackoff {
+				backoff = jv.retryPolicy.MaxBackoff
+			}
+		}
+
+		log.WithError(err).WithField("attempt", attempt).WithField("retry_in", delay).Warn("Vault write failed, retrying")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("retry cancelled, %w", err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryAfter parses Retry-After header given as seconds or http date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"fmt"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/tidwall/gjson"
+)
+
+type collectionValidator struct {
+	fields []vaultclient.Field
+}
+
+// NewCollectionValidator reads fields of repository collection, so that entries can be
+// validated against them before they are written
+func (jv *JsonVaultRepository) NewCollectionValidator() (*collectionValidator, error) {
+	res, err := jv.client.CollectionGetWithResponse(context.Background(), jv.ledger, jv.collection)
+	if err != nil {
+		return nil, fmt.Errorf("error getting collection, %w", err)
+	}
+
+	if res.JSON200 == nil {
+		return nil, fmt.Errorf("error getting collection, %d, %s", res.StatusCode(), string(res.Body))
+	}
+
+	return &collectionValidator{fields: res.JSON200.Fields}, nil
+}
+
+// Validate returns missing collection fields and fields which types do not match
+func (cv *collectionValidator) Validate(jBytes []byte) []string {
+	if !gjson.ValidBytes(jBytes) {
+		return []string{"invalid json"}
+	}
+
+	problems := []string{}
+	gjsonObject := gjson.ParseBytes(jBytes)
+	for _, f := range cv.fields {
+		// document id is assigned by vault
+		if f.Name == documentIDField {
+			continue
+		}
+
+		gjr := gjsonObject.Get(f.Name)
+		if !gjr.Exists() {
+			problems = append(problems, fmt.Sprintf("missing field %s", f.Name))
+			continue
+		}
+
+		if f.Type == nil {
+			continue
+		}
+
+		valid := true
+		switch *f.Type {
+		case vaultclient.STRING:
+			valid = gjr.Type == gjson.String
+		case vaultclient.INTEGER:
+			valid = gjr.Type == gjson.Number && gjr.Num == float64(gjr.Int())
+		case vaultclient.DOUBLE:
+			valid = gjr.Type == gjson.Number
+		case vaultclient.BOOLEAN:
+			valid = gjr.IsBool()
+		}
+
+		if !valid {
+			problems = append(problems, fmt.Sprintf("field %s is not %s, %s", f.Name, *f.Type, gjr.Raw))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultclient "github.com/codenotary/immudb-log-audit/pkg/client/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionValidator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/ledger/default/collection/pgaudit" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not found"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"name":"pgaudit","idFieldName":"_id","indexes":[],"fields":[
+			{"name":"_id","type":"STRING"},
+			{"name":"uid","type":"STRING"},
+			{"name":"statement_id","type":"INTEGER"},
+			{"name":"duration","type":"DOUBLE"},
+			{"name":"ok","type":"BOOLEAN"}]}`)
+	}))
+	defer server.Close()
+
+	client, err := vaultclient.NewClientWithResponses(server.URL)
+	require.NoError(t, err)
+
+	jv, err := NewJsonVaultRepository(client, "default", "pgaudit", true)
+	require.NoError(t, err)
+
+	cv, err := jv.NewCollectionValidator()
+	require.NoError(t, err)
+
+	assert.Empty(t, cv.Validate([]byte(`{"uid":"a","statement_id":1,"duration":1,"ok":true}`)))
+	assert.Equal(t, []string{
+		"missing field uid",
+		"field statement_id is not INTEGER, \"1\"",
+		"field duration is not DOUBLE, \"1.5\"",
+		"field ok is not BOOLEAN, 1",
+	}, cv.Validate([]byte(`{"statement_id":"1","duration":"1.5","ok":1}`)))
+
+	jv, err = NewJsonVaultRepository(client, "default", "missing", true)
+	require.NoError(t, err)
+
+	_, err = jv.NewCollectionValidator()
+	assert.Error(t, err)
+}
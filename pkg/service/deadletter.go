@@ -0,0 +1,185 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadLetterEntry wraps raw line which could not be parsed
+type DeadLetterEntry struct {
+	UID       string    `json:"uid"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source,omitempty"`
+	Position  string    `json:"position,omitempty"`
+	Parser    string    `json:"parser"`
+	Error     string    `json:"error"`
+	Line      string    `json:"line"`
+}
+
+// deadLetterPosition restores position of dead-lettered line, so parsers deriving uid from
+// position produce the same uid as if the line was parsed when it was read
+type deadLetterPosition string
+
+func (p deadLetterPosition) String() string {
+	return string(p)
+}
+
+// WithDeadLetter stores lines which could not be parsed in deadLetter repository instead of
+// discarding them. Lines are acknowledged only after they are stored there. Source and parser
+// are recorded with each entry.
+func (as *AuditService) WithDeadLetter(deadLetter JsonRepository, source string, parser string) *AuditService {
+	as.deadLetter = deadLetter
+	as.source = source
+	as.parserName = parser
+	return as
+}
+
+func (as *AuditService) deadLetterEntry(l Line, parseErr error) ([]byte, error) {
+	e := DeadLetterEntry{
+		UID:       uuid.NewString(),
+		Timestamp: time.Now().UTC(),
+		Source:    as.source,
+		Parser:    as.parserName,
+		Error:     parseErr.Error(),
+		Line:      l.Text,
+	}
+
+	if l.Position != nil {
+		e.Position = l.Position.String()
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal dead letter entry, %w", err)
+	}
+
+	return b, nil
+}
+
+func (as *AuditService) writeDeadLetters(entries [][]byte) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	id, err := as.deadLetter.WriteBytes(entries)
+	if err != nil {
+		return fmt.Errorf("could not store dead letter entry, %w", err)
+	}
+
+	log.WithField("TXID", id).WithField("count", len(entries)).Debug("Stored dead letter entries")
+	return nil
+}
+
+// ReplayResult describes dead-lettered entries handled by Replay
+type ReplayResult struct {
+	// Handled is number of leading entries which were replayed or failed again, it is lower
+	// than number of entries only when storing failed
+	Handled int
+	// Replayed are entries which were stored, merged into stored entry, or skipped by parser
+	Replayed []DeadLetterEntry
+	// Failed are entries which still cannot be parsed, with updated error
+	Failed []DeadLetterEntry
+}
+
+// Replay parses dead-lettered lines again and stores parsed entries. Lines held by parser are
+// stored with entries flushed from it. When storing fails after some entries were written,
+// result describes entries preceding the first not stored one.
+func (as *AuditService) Replay(entries []DeadLetterEntry) (*ReplayResult, error) {
+	buf := [][]byte{}
+	// index of buffered entry each entry is stored with, -1 for skipped and failed ones
+	stored := make([]int, len(entries))
+	held := []int{}
+	failed := map[int]DeadLetterEntry{}
+	for i, e := range entries {
+		stored[i] = -1
+		l := Line{Text: e.Line}
+		if e.Position != "" {
+			l.Position = deadLetterPosition(e.Position)
+		}
+
+		b, err := as.parse(l)
+		if errors.Is(err, ErrHoldLine) {
+			log.WithField("line", e.Line).Trace("Line held by parser")
+			held = append(held, i)
+			continue
+		} else if errors.Is(err, ErrSkipLine) {
+			log.WithField("line", e.Line).Trace("Line skipped by parser")
+			continue
+		} else if err != nil {
+			e.Error = err.Error()
+			failed[i] = e
+			continue
+		}
+
+		stored[i] = len(buf)
+		buf = append(buf, b)
+	}
+
+	flushed, err := as.flushParser(true)
+	if err != nil {
+		return &ReplayResult{}, err
+	}
+
+	for _, e := range flushed {
+		buf = append(buf, e.Entry)
+	}
+
+	// entries held lines are merged into are not known, so held lines are replayed only when
+	// all entries are stored
+	for _, i := range held {
+		stored[i] = len(buf) - 1
+	}
+
+	result := &ReplayResult{Handled: len(entries)}
+	if len(buf) > 0 {
+		var id uint64
+		id, err = as.jsonRepository.WriteBytes(buf)
+		if err != nil {
+			written := Written(err)
+			if written >= len(buf) {
+				written = 0
+			}
+
+			for i, n := range stored {
+				if n >= written {
+					result.Handled = i
+					break
+				}
+			}
+			err = fmt.Errorf("could not store audit entry, %w", err)
+		} else {
+			log.WithField("TXID", id).WithField("count", len(buf)).Debug("Stored replayed lines")
+		}
+	}
+
+	for i, e := range entries[:result.Handled] {
+		if f, ok := failed[i]; ok {
+			result.Failed = append(result.Failed, f)
+		} else {
+			result.Replayed = append(result.Replayed, e)
+		}
+	}
+
+	return result, err
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditServiceDeadLetter(t *testing.T) {
+	lines := []string{"line 0", "invalid 1", "skip", "line 3"}
+
+	type testData struct {
+		name          string
+		deadLetterErr error
+		expectErr     bool
+		acked         int
+	}
+
+	tdd := []testData{
+		{
+			name:  "invalid lines are dead-lettered and acknowledged",
+			acked: 4,
+		},
+		{
+			name:          "lines are not acknowledged when dead letter fails",
+			deadLetterErr: errors.New("disk full"),
+			expectErr:     true,
+		},
+	}
+
+	for _, td := range tdd {
+		lp := &testLineProvider{lC: make(chan Line)}
+		repo := &testRepository{}
+		deadLetter := &testRepository{err: td.deadLetterErr}
+		go func() {
+			for i, l := range lines {
+				lp.lC <- Line{Text: l, Position: testPosition(i)}
+			}
+			close(lp.lC)
+		}()
+
+		err := NewAuditService(lp, testLineParser{}, repo).WithDeadLetter(deadLetter, "test.log", "test").Run()
+		if td.expectErr {
+			assert.Error(t, err, td.name)
+			for range lp.lC {
+			}
+			assert.Empty(t, lp.acked, td.name)
+			continue
+		}
+
+		require.NoError(t, err, td.name)
+		assert.Len(t, repo.stored, 2, td.name)
+		assert.Len(t, lp.acked, td.acked, td.name)
+		require.Len(t, deadLetter.stored, 1, td.name)
+
+		var e DeadLetterEntry
+		require.NoError(t, json.Unmarshal(deadLetter.stored[0], &e))
+		assert.NotEmpty(t, e.UID)
+		assert.Equal(t, "invalid 1", e.Line)
+		assert.Equal(t, "1", e.Position)
+		assert.Equal(t, "test.log", e.Source)
+		assert.Equal(t, "test", e.Parser)
+		assert.Equal(t, "invalid", e.Error)
+		assert.False(t, e.Timestamp.IsZero())
+	}
+}
+
+func TestAuditServiceStoreDeadLetter(t *testing.T) {
+	repo := &testRepository{}
+	deadLetter := &testRepository{}
+	as := NewAuditService(nil, testLineParser{}, repo).WithDeadLetter(deadLetter, "syslog", "test")
+
+	_, err := as.Store([]string{"line", "invalid"})
+	require.NoError(t, err)
+	assert.Len(t, repo.stored, 1)
+	assert.Len(t, deadLetter.stored, 1)
+}
+
+type fixedLineParser struct{}
+
+func (fixedLineParser) Parse(line string) ([]byte, error) {
+	return nil, errors.New("position required")
+}
+
+func (fixedLineParser) ParseAt(line string, position Position) ([]byte, error) {
+	if strings.HasPrefix(line, "invalid") {
+		return nil, errors.New("still invalid")
+	}
+
+	if position == nil {
+		return nil, errors.New("position required")
+	}
+
+	return []byte(position.String() + " " + line), nil
+}
+
+func TestAuditServiceReplay(t *testing.T) {
+	repo := &testRepository{}
+	entries := []DeadLetterEntry{
+		{Line: "fixed", Position: "file.log:10", Error: "invalid"},
+		{Line: "invalid again", Position: "file.log:20", Error: "invalid"},
+		{Line: "skip"},
+	}
+
+	result, err := NewAuditService(nil, fixedLineParser{}, repo).Replay(entries)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Handled)
+	assert.Equal(t, entries[:1], result.Replayed)
+	assert.Equal(t, [][]byte{[]byte("file.log:10 fixed")}, repo.stored)
+	require.Len(t, result.Failed, 2)
+	assert.Equal(t, "still invalid", result.Failed[0].Error)
+	assert.Equal(t, "file.log:20", result.Failed[0].Position)
+	assert.Equal(t, "position required", result.Failed[1].Error)
+
+	result, err = NewAuditService(nil, fixedLineParser{}, &testRepository{err: errors.New("unavailable")}).Replay(entries)
+	assert.Error(t, err)
+	assert.Equal(t, 0, result.Handled)
+	assert.Empty(t, result.Replayed)
+	assert.Empty(t, result.Failed)
+
+	// entries preceding the first not stored one are handled
+	entries = []DeadLetterEntry{
+		{Line: "fixed", Position: "file.log:10"},
+		{Line: "invalid again", Position: "file.log:20"},
+		{Line: "fixed", Position: "file.log:30"},
+		{Line: "fixed", Position: "file.log:40"},
+	}
+	repo = &testRepository{err: errors.New("unavailable"), partial: 1}
+	result, err = NewAuditService(nil, fixedLineParser{}, repo).Replay(entries)
+	assert.Error(t, err)
+	assert.Equal(t, 2, result.Handled)
+	assert.Equal(t, entries[:1], result.Replayed)
+	assert.Len(t, result.Failed, 1)
+	assert.Equal(t, [][]byte{[]byte("file.log:10 fixed")}, repo.stored)
+}
+
+func TestAuditServiceReplayHeldLines(t *testing.T) {
+	entries := []DeadLetterEntry{{Line: "hold 1"}, {Line: "line"}, {Line: "hold 2"}}
+
+	repo := &testRepository{}
+	result, err := NewAuditService(nil, &testFlushLineParser{}, repo).Replay(entries)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Handled)
+	assert.Equal(t, entries, result.Replayed)
+	assert.Equal(t, [][]byte{[]byte("line"), []byte("hold 1,hold 2")}, repo.stored)
+
+	// held lines are not replayed until entry they are merged into is stored
+	repo = &testRepository{err: errors.New("unavailable"), partial: 1}
+	result, err = NewAuditService(nil, &testFlushLineParser{}, repo).Replay(entries)
+	assert.Error(t, err)
+	assert.Equal(t, 0, result.Handled)
+	assert.Empty(t, result.Replayed)
+}
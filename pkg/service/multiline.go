@@ -0,0 +1,323 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMultilineMaxLines = 500
+	defaultMultilineTimeout  = time.Second
+)
+
+// MultilineOptions configure how lines are assembled into records. With Start pattern, a record
+// begins with a matching line and following lines which do not match are appended to it. With
+// Continue pattern, matching lines are appended to the previous line. With Key pattern,
+// consecutive lines with the same key are appended to the record. With Quote, lines are
+// appended while the record has unbalanced quotes. Without patterns, lines are appended until
+// the record is flushed by End, MaxLines or Timeout.
+type MultilineOptions struct {
+	Start    string
+	Continue string
+	// Key is concatenation of submatches of the pattern, lines which do not match it are
+	// records on their own
+	Key string
+	// Quote opens and closes quoted fields which may contain new lines, e.g. in CSV. Record
+	// is flushed with the line which balances its quotes, escaped quotes are doubled.
+	Quote string
+	// End flushes the record with a matching line
+	End string
+	// MaxLines flushes the record when it reaches given number of lines
+	MaxLines int
+	// Timeout flushes the record when no line was appended to it for given duration
+	Timeout time.Duration
+}
+
+// Enabled reports whether any of the assembly options is set
+func (o MultilineOptions) Enabled() bool {
+	return o.Start != "" || o.Continue != "" || o.Key != "" || o.Quote != "" || o.End != "" || o.MaxLines > 0 || o.Timeout > 0
+}
+
+func (o MultilineOptions) Validate() error {
+	patterns := 0
+	for _, p := range []string{o.Start, o.Continue, o.Key, o.Quote} {
+		if p != "" {
+			patterns++
+		}
+	}
+
+	if patterns > 1 {
+		return errors.New("only one of start, continue, key patterns and quote can be set")
+	}
+
+	if o.MaxLines < 0 {
+		return fmt.Errorf("invalid max lines %d", o.MaxLines)
+	}
+
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s", o.Timeout)
+	}
+
+	return nil
+}
+
+// multilinePosition acknowledges all lines of assembled record
+type multilinePosition struct {
+	positions []Position
+}
+
+// String returns position of the last line, so it is unique the same way as line positions
+func (p *multilinePosition) String() string {
+	return p.positions[len(p.positions)-1].String()
+}
+
+// LastPosition returns position of the last line of assembled record, or the position itself
+func LastPosition(p Position) Position {
+	if mlp, ok := p.(*multilinePosition); ok {
+		return mlp.positions[len(mlp.positions)-1]
+	}
+
+	return p
+}
+
+type multilineRecord struct {
+	key       string
+	keyed     bool
+	quotes    int
+	lines     []string
+	positions []Position
+	updated   time.Time
+}
+
+type multilineLineProvider struct {
+	lineProvider LineProvider
+	start        *regexp.Regexp
+	cont         *regexp.Regexp
+	key          *regexp.Regexp
+	end          *regexp.Regexp
+	quote        string
+	maxLines     int
+	timeout      time.Duration
+	// pending records by stream
+	records map[string]*multilineRecord
+	lC      chan Line
+}
+
+// NewMultilineLineProvider assembles lines of lineProvider into multi-line records before they
+// are parsed. Lines of different streams are assembled separately. Positions of all lines of
+// a record are acknowledged together, so pending records are read again after restart.
+func NewMultilineLineProvider(lineProvider LineProvider, opts MultilineOptions) (*multilineLineProvider, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid multiline options, %w", err)
+	}
+
+	mp := &multilineLineProvider{
+		lineProvider: lineProvider,
+		quote:        opts.Quote,
+		maxLines:     opts.MaxLines,
+		timeout:      opts.Timeout,
+		records:      map[string]*multilineRecord{},
+		lC:           make(chan Line),
+	}
+
+	if opts.Start != "" {
+		mp.start, err = regexp.Compile(opts.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline start pattern, %w", err)
+		}
+	}
+
+	if opts.Continue != "" {
+		mp.cont, err = regexp.Compile(opts.Continue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline continue pattern, %w", err)
+		}
+	}
+
+	if opts.Key != "" {
+		mp.key, err = regexp.Compile(opts.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline key pattern, %w", err)
+		}
+	}
+
+	if opts.End != "" {
+		mp.end, err = regexp.Compile(opts.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline end pattern, %w", err)
+		}
+	}
+
+	if mp.maxLines == 0 {
+		mp.maxLines = defaultMultilineMaxLines
+	}
+
+	if mp.timeout == 0 {
+		mp.timeout = defaultMultilineTimeout
+	}
+
+	go mp.assemble()
+	return mp, nil
+}
+
+func (mp *multilineLineProvider) ReadLine() chan Line {
+	return mp.lC
+}
+
+func (mp *multilineLineProvider) Ack(positions []Position) {
+	acked := make([]Position, 0, len(positions))
+	for _, p := range positions {
+		if mlp, ok := p.(*multilinePosition); ok {
+			acked = append(acked, mlp.positions...)
+		} else {
+			acked = append(acked, p)
+		}
+	}
+
+	mp.lineProvider.Ack(acked)
+}
+
+func (mp *multilineLineProvider) SaveState() {
+	mp.lineProvider.SaveState()
+}
+
+func (mp *multilineLineProvider) assemble() {
+	ticker := time.NewTicker(mp.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case l, ok := <-mp.lineProvider.ReadLine():
+			if !ok {
+				streams := make([]string, 0, len(mp.records))
+				for stream := range mp.records {
+					streams = append(streams, stream)
+				}
+				sort.Strings(streams)
+
+				for _, stream := range streams {
+					mp.flush(stream)
+				}
+
+				close(mp.lC)
+				return
+			}
+
+			mp.add(l)
+		case now := <-ticker.C:
+			for stream, r := range mp.records {
+				if now.Sub(r.updated) >= mp.timeout {
+					mp.flush(stream)
+				}
+			}
+		}
+	}
+}
+
+func (mp *multilineLineProvider) add(l Line) {
+	stream := ""
+	if sp, ok := l.Position.(StreamPosition); ok {
+		stream = sp.Stream()
+	}
+
+	key, keyed := mp.lineKey(l.Text)
+	r, ok := mp.records[stream]
+	if ok && !mp.continues(r, l.Text, key, keyed) {
+		mp.flush(stream)
+		ok = false
+	}
+
+	if !ok {
+		r = &multilineRecord{key: key, keyed: keyed}
+		mp.records[stream] = r
+	}
+
+	r.lines = append(r.lines, l.Text)
+	if l.Position != nil {
+		r.positions = append(r.positions, l.Position)
+	}
+	r.updated = time.Now()
+
+	balanced := false
+	if mp.quote != "" {
+		r.quotes += strings.Count(l.Text, mp.quote)
+		balanced = r.quotes%2 == 0
+	}
+
+	if len(r.lines) >= mp.maxLines || (mp.end != nil && mp.end.MatchString(l.Text)) || balanced {
+		mp.flush(stream)
+	}
+}
+
+// lineKey returns key of the line and whether it matches key pattern
+func (mp *multilineLineProvider) lineKey(line string) (string, bool) {
+	if mp.key == nil {
+		return "", false
+	}
+
+	m := mp.key.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+
+	if len(m) == 1 {
+		return m[0], true
+	}
+
+	return strings.Join(m[1:], "\x00"), true
+}
+
+// continues reports whether line belongs to pending record
+func (mp *multilineLineProvider) continues(r *multilineRecord, line string, key string, keyed bool) bool {
+	if mp.key != nil {
+		return keyed && r.keyed && key == r.key
+	}
+
+	if mp.start != nil {
+		return !mp.start.MatchString(line)
+	}
+
+	if mp.cont != nil {
+		return mp.cont.MatchString(line)
+	}
+
+	return true
+}
+
+func (mp *multilineLineProvider) flush(stream string) {
+	r := mp.records[stream]
+	delete(mp.records, stream)
+
+	l := Line{Text: strings.Join(r.lines, "\n")}
+	if len(r.positions) == 1 {
+		l.Position = r.positions[0]
+	} else if len(r.positions) > 1 {
+		l.Position = &multilinePosition{positions: r.positions}
+	}
+
+	log.WithField("stream", stream).WithField("lines", len(r.lines)).Trace("Assembled record")
+	mp.lC <- l
+}
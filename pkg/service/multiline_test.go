@@ -0,0 +1,196 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStreamPosition struct {
+	stream string
+	line   int
+}
+
+func (p testStreamPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.stream, p.line)
+}
+
+func (p testStreamPosition) Stream() string {
+	return p.stream
+}
+
+func TestMultilineLineProvider(t *testing.T) {
+	type testData struct {
+		name    string
+		opts    MultilineOptions
+		lines   []Line
+		records []string
+	}
+
+	tdd := []testData{
+		{
+			name: "start pattern",
+			opts: MultilineOptions{Start: `^\d{4}-`},
+			lines: []Line{
+				{Text: "2023-05-13 LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,\"select 1", Position: testPosition(0)},
+				{Text: "\tfrom t\",<not logged>", Position: testPosition(1)},
+				{Text: "2023-05-13 LOG:  AUDIT: SESSION,2,1,READ,SELECT,,,select 2,<not logged>", Position: testPosition(2)},
+			},
+			records: []string{
+				"2023-05-13 LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,\"select 1\n\tfrom t\",<not logged>",
+				"2023-05-13 LOG:  AUDIT: SESSION,2,1,READ,SELECT,,,select 2,<not logged>",
+			},
+		},
+		{
+			name: "continue pattern",
+			opts: MultilineOptions{Continue: `^\s+at `},
+			lines: []Line{
+				{Text: "java.lang.IllegalStateException: failed"},
+				{Text: "    at com.example.Main.run(Main.java:10)"},
+				{Text: "    at com.example.Main.main(Main.java:5)"},
+				{Text: "next"},
+			},
+			records: []string{
+				"java.lang.IllegalStateException: failed\n    at com.example.Main.run(Main.java:10)\n    at com.example.Main.main(Main.java:5)",
+				"next",
+			},
+		},
+		{
+			name: "quote",
+			opts: MultilineOptions{Quote: `"`},
+			lines: []Line{
+				{Text: `2023-05-13,"select 1`, Position: testPosition(0)},
+				{Text: `2023-05-13 21:09:08 in ""literal"" from t",<not logged>`, Position: testPosition(1)},
+				{Text: `2023-05-13,"select 2",<not logged>`, Position: testPosition(2)},
+			},
+			records: []string{
+				"2023-05-13,\"select 1\n2023-05-13 21:09:08 in \"\"literal\"\" from t\",<not logged>",
+				`2023-05-13,"select 2",<not logged>`,
+			},
+		},
+		{
+			name: "max lines",
+			opts: MultilineOptions{MaxLines: 2},
+			lines: []Line{
+				{Text: "a"}, {Text: "b"}, {Text: "c"},
+			},
+			records: []string{"a\nb", "c"},
+		},
+		{
+			name: "key and end patterns",
+			opts: MultilineOptions{Key: `^(\S+) event=(\d+)`, End: `^\S+ event=\d+ end`},
+			lines: []Line{
+				{Text: "a event=1 first", Position: testPosition(0)},
+				{Text: "a event=1 second", Position: testPosition(1)},
+				{Text: "a event=1 end", Position: testPosition(2)},
+				{Text: "a event=2 single", Position: testPosition(3)},
+				{Text: "b event=2 other node", Position: testPosition(4)},
+				{Text: "invalid", Position: testPosition(5)},
+				{Text: "invalid", Position: testPosition(6)},
+			},
+			records: []string{
+				"a event=1 first\na event=1 second\na event=1 end",
+				"a event=2 single",
+				"b event=2 other node",
+				"invalid",
+				"invalid",
+			},
+		},
+		{
+			name: "streams are assembled separately",
+			opts: MultilineOptions{Start: `^start`},
+			lines: []Line{
+				{Text: "start a", Position: testStreamPosition{"a", 0}},
+				{Text: "start b", Position: testStreamPosition{"b", 0}},
+				{Text: "a continued", Position: testStreamPosition{"a", 1}},
+				{Text: "b continued", Position: testStreamPosition{"b", 1}},
+				{Text: "start a", Position: testStreamPosition{"a", 2}},
+			},
+			records: []string{"start a\na continued", "start a", "start b\nb continued"},
+		},
+	}
+
+	for _, td := range tdd {
+		lp := &testLineProvider{lC: make(chan Line)}
+		mp, err := NewMultilineLineProvider(lp, td.opts)
+		require.NoError(t, err, td.name)
+
+		go func(lines []Line) {
+			for _, l := range lines {
+				lp.lC <- l
+			}
+			close(lp.lC)
+		}(td.lines)
+
+		records := []string{}
+		positions := []Position{}
+		for l := range mp.ReadLine() {
+			records = append(records, l.Text)
+			if l.Position != nil {
+				positions = append(positions, l.Position)
+			}
+		}
+		assert.Equal(t, td.records, records, td.name)
+
+		mp.Ack(positions)
+		expected := []Position{}
+		for _, l := range td.lines {
+			if l.Position != nil {
+				expected = append(expected, l.Position)
+			}
+		}
+		assert.ElementsMatch(t, expected, lp.acked, td.name)
+	}
+}
+
+func TestMultilineLineProviderTimeout(t *testing.T) {
+	lp := &testLineProvider{lC: make(chan Line)}
+	mp, err := NewMultilineLineProvider(lp, MultilineOptions{Start: "^start", Timeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	lp.lC <- Line{Text: "start"}
+	lp.lC <- Line{Text: "continued"}
+
+	select {
+	case l := <-mp.ReadLine():
+		assert.Equal(t, "start\ncontinued", l.Text)
+	case <-time.After(time.Second):
+		assert.Fail(t, "record was not flushed after timeout")
+	}
+
+	close(lp.lC)
+	_, ok := <-mp.ReadLine()
+	assert.False(t, ok)
+}
+
+func TestMultilineOptionsValidate(t *testing.T) {
+	assert.False(t, MultilineOptions{}.Enabled())
+	assert.True(t, MultilineOptions{Timeout: time.Second}.Enabled())
+	assert.True(t, MultilineOptions{End: "^end"}.Enabled())
+	assert.Error(t, MultilineOptions{Start: "a", Continue: "b"}.Validate())
+	assert.Error(t, MultilineOptions{Start: "a", Key: "b"}.Validate())
+	assert.Error(t, MultilineOptions{Start: "a", Quote: `"`}.Validate())
+	assert.Error(t, MultilineOptions{MaxLines: -1}.Validate())
+
+	_, err := NewMultilineLineProvider(&testLineProvider{lC: make(chan Line)}, MultilineOptions{Start: "("})
+	assert.Error(t, err)
+}
@@ -17,14 +17,41 @@ limitations under the License.
 package service
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-type lineProvider interface {
-	ReadLine() chan string
+// Position identifies where the line was read from, its string representation is unique
+// within the source.
+type Position interface {
+	String() string
+}
+
+// StreamPosition is implemented by positions of sources reading multiple streams, e.g. files
+// matching a pattern. Lines of a stream are delivered in order, lines of different streams
+// may interleave.
+type StreamPosition interface {
+	Position
+	Stream() string
+}
+
+// Line is a single line read by line provider. Position is nil for sources which cannot
+// resume reading, e.g. network receivers.
+type Line struct {
+	Text     string
+	Position Position
+}
+
+// LineProvider delivers lines and gets acknowledged positions of lines which were stored, or
+// skipped as invalid. Only acknowledged positions are persisted by SaveState, so lines which
+// were read but not stored are read again after restart.
+type LineProvider interface {
+	ReadLine() chan Line
+	Ack(positions []Position)
 	SaveState()
 }
 
@@ -32,10 +59,67 @@ type LineParser interface {
 	Parse(line string) ([]byte, error)
 }
 
+// PositionLineParser is implemented by parsers which use line position, e.g. to derive
+// deterministic uids.
+type PositionLineParser interface {
+	ParseAt(line string, position Position) ([]byte, error)
+}
+
+// FlushLineParser is implemented by parsers which hold lines to merge them with following
+// lines into single entry. Held lines are reported with ErrHoldLine. Flush returns entries of
+// held lines which were not completed in time, or of all held lines when all is set. Merged
+// returns positions of held lines merged into the entry returned by the last parse.
+type FlushLineParser interface {
+	Flush(all bool) ([]HeldEntry, error)
+	Merged() []Position
+}
+
+// HeldEntry is an entry merged from lines held by parser, with positions of those lines
+type HeldEntry struct {
+	Entry     []byte
+	Positions []Position
+}
+
+// ErrSkipLine is returned by line parsers for valid lines which should not be stored,
+// e.g. duplicates of already stored lines.
+var ErrSkipLine = errors.New("line skipped by parser")
+
+// ErrHoldLine is returned by FlushLineParser parsers for lines which are held to be merged
+// with following lines. Positions of held lines are acknowledged only after the entry they
+// are merged into is stored.
+var ErrHoldLine = errors.New("line held by parser")
+
 type JsonRepository interface {
 	WriteBytes(b [][]byte) (uint64, error)
 }
 
+// PartialWriteError is returned by repositories which store entries in multiple requests,
+// when only first Written entries were stored before Err. Those entries should not be sent
+// again.
+type PartialWriteError struct {
+	Written int
+	Err     error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("%d entries written, %s", e.Written, e.Err.Error())
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// Written returns number of entries stored before err, it is 0 unless err wraps
+// PartialWriteError.
+func Written(err error) int {
+	var pwErr *PartialWriteError
+	if errors.As(err, &pwErr) {
+		return pwErr.Written
+	}
+
+	return 0
+}
+
 type AuditHistoryEntry struct {
 	Entry    []byte
 	Revision uint64
@@ -43,12 +127,16 @@ type AuditHistoryEntry struct {
 }
 
 type AuditService struct {
-	lineProvider   lineProvider
+	lineProvider   LineProvider
 	jsonRepository JsonRepository
 	lineParser     LineParser
+	storeMutex     sync.Mutex
+	deadLetter     JsonRepository
+	source         string
+	parserName     string
 }
 
-func NewAuditService(lineProvider lineProvider, lineParser LineParser, jsonRepository JsonRepository) *AuditService {
+func NewAuditService(lineProvider LineProvider, lineParser LineParser, jsonRepository JsonRepository) *AuditService {
 	return &AuditService{
 		lineProvider:   lineProvider,
 		lineParser:     lineParser,
@@ -58,55 +146,272 @@ func NewAuditService(lineProvider lineProvider, lineParser LineParser, jsonRepos
 
 func (as *AuditService) Run() error {
 	bufferSize := 200
-	saveStateTicker := time.NewTicker(5 * time.Second)
+	flushTicker := time.NewTicker(5 * time.Second)
+	defer flushTicker.Stop()
+
 	buf := [][]byte{}
+	dead := [][]byte{}
+	positions := []Position{}
+	// preceding[i] is number of positions of lines read before the line of buf[i]
+	preceding := []int{}
+	// merged[i] are positions of held lines merged into buf[i]
+	merged := [][]Position{}
+	// held are positions of lines held by parser, or merged into entries not stored yet
+	held := map[string]struct{}{}
+	// kept is number of positions left unacknowledged by the last flush
+	kept := 0
 
-	for stop := false; !stop; {
-		select {
-		case l, ok := <-as.lineProvider.ReadLine():
-			if !ok {
-				stop = true
-				if l == "" {
-					break
-				}
+	release := func(merged [][]Position) {
+		for _, mp := range merged {
+			for _, p := range mp {
+				delete(held, p.String())
 			}
-			b, err := as.lineParser.Parse(l)
+		}
+	}
+
+	// positions are acknowledged only when lines read so far are stored. Dead letters are
+	// stored first, so lines preceding entries of partially stored buffer can be acknowledged.
+	// Held positions, and positions following them in the same stream, are kept for later.
+	flush := func() error {
+		if len(dead) > 0 {
+			err := as.writeDeadLetters(dead)
+			if err != nil {
+				return err
+			}
+			dead = [][]byte{}
+		}
+
+		if len(buf) > 0 {
+			id, err := as.jsonRepository.WriteBytes(buf)
 			if err != nil {
-				log.WithError(err).WithField("line", l).Debug("Invalid line format, skipping")
-				if !stop {
-					continue
+				if n := Written(err); n > 0 && n < len(buf) {
+					release(merged[:n])
+					ack, _ := splitHeld(positions[:preceding[n]], held)
+					as.lineProvider.Ack(ack)
+					as.lineProvider.SaveState()
 				}
+				return fmt.Errorf("could not store audit entry, %w", err)
 			}
 
-			buf = append(buf, b)
-			if len(buf) == bufferSize || (len(buf) > 0 && stop) {
-				id, err := as.jsonRepository.WriteBytes(buf)
+			log.WithField("TXID", id).WithField("line", string(buf[len(buf)-1])).Trace("Stored line")
+			release(merged)
+			buf = [][]byte{}
+			preceding = []int{}
+			merged = [][]Position{}
+		}
+
+		if len(positions) > 0 {
+			ack, rest := splitHeld(positions, held)
+			if len(ack) > 0 {
+				as.lineProvider.Ack(ack)
+			}
+			positions = rest
+			kept = len(rest)
+		}
+
+		return nil
+	}
+
+	hold := func(all bool) error {
+		entries, err := as.flushParser(all)
+		for _, e := range entries {
+			buf = append(buf, e.Entry)
+			preceding = append(preceding, len(positions))
+			merged = append(merged, e.Positions)
+		}
+		return err
+	}
+
+	for {
+		select {
+		case l, ok := <-as.lineProvider.ReadLine():
+			if !ok {
+				err := hold(true)
 				if err != nil {
-					return fmt.Errorf("could not store audit entry, %w", err)
+					return err
 				}
 
-				log.WithField("TXID", id).WithField("line", string(buf[len(buf)-1])).Trace("Stored line")
-				buf = [][]byte{}
+				err = flush()
+				if err != nil {
+					return err
+				}
 
-				if stop {
-					as.lineProvider.SaveState()
+				as.lineProvider.SaveState()
+				return nil
+			}
+
+			read := len(positions)
+			if l.Position != nil {
+				positions = append(positions, l.Position)
+			}
+
+			b, err := as.parse(l)
+			if errors.Is(err, ErrHoldLine) {
+				log.WithField("line", l.Text).Trace("Line held by parser")
+				if l.Position != nil {
+					held[l.Position.String()] = struct{}{}
+				}
+			} else if errors.Is(err, ErrSkipLine) {
+				log.WithField("line", l.Text).Trace("Line skipped by parser")
+			} else if err != nil && as.deadLetter != nil {
+				log.WithError(err).WithField("line", l.Text).Debug("Invalid line format, dead-lettering")
+				d, err := as.deadLetterEntry(l, err)
+				if err != nil {
+					return err
 				}
+				dead = append(dead, d)
+			} else if err != nil {
+				log.WithError(err).WithField("line", l.Text).Debug("Invalid line format, skipping")
+			} else {
+				buf = append(buf, b)
+				preceding = append(preceding, read)
+				merged = append(merged, as.mergedPositions())
 			}
-		case <-saveStateTicker.C:
-			if len(buf) > 0 {
-				id, err := as.jsonRepository.WriteBytes(buf)
+
+			if len(buf) >= bufferSize || len(dead) >= bufferSize || len(positions)-kept >= bufferSize {
+				err := flush()
 				if err != nil {
-					return fmt.Errorf("could not store audit entry, %w", err)
+					return err
 				}
+			}
+		case <-flushTicker.C:
+			err := hold(false)
+			if err != nil {
+				return err
+			}
 
-				log.WithField("TXID", id).WithField("line", string(buf[len(buf)-1])).Trace("Stored line")
-				buf = [][]byte{}
-				as.lineProvider.SaveState()
+			if len(buf) == 0 && len(dead) == 0 && len(positions) == kept {
+				continue
 			}
 
-			saveStateTicker = time.NewTicker(5 * time.Second)
+			err = flush()
+			if err != nil {
+				return err
+			}
+
+			as.lineProvider.SaveState()
 		}
 	}
+}
+
+// flushParser returns entries held by the line parser, see FlushLineParser
+func (as *AuditService) flushParser(all bool) ([]HeldEntry, error) {
+	fp, ok := as.lineParser.(FlushLineParser)
+	if !ok {
+		return nil, nil
+	}
+
+	held, err := fp.Flush(all)
+	if err != nil {
+		return nil, fmt.Errorf("could not flush line parser, %w", err)
+	}
+
+	return held, nil
+}
+
+// mergedPositions returns positions of held lines merged into the last parsed entry
+func (as *AuditService) mergedPositions() []Position {
+	if fp, ok := as.lineParser.(FlushLineParser); ok {
+		return fp.Merged()
+	}
 
 	return nil
 }
+
+// splitHeld splits positions into the ones which can be acknowledged and the ones which are
+// held, or follow a held position of the same stream, so streams are acknowledged in order
+func splitHeld(positions []Position, held map[string]struct{}) ([]Position, []Position) {
+	if len(held) == 0 {
+		return positions, nil
+	}
+
+	ack := []Position{}
+	rest := []Position{}
+	blocked := map[string]struct{}{}
+	for _, p := range positions {
+		stream := ""
+		if sp, ok := LastPosition(p).(StreamPosition); ok {
+			stream = sp.Stream()
+		}
+
+		if _, ok := blocked[stream]; !ok {
+			if _, ok := held[p.String()]; !ok {
+				ack = append(ack, p)
+				continue
+			}
+			blocked[stream] = struct{}{}
+		}
+
+		rest = append(rest, p)
+	}
+
+	return ack, rest
+}
+
+func (as *AuditService) parse(l Line) ([]byte, error) {
+	if pp, ok := as.lineParser.(PositionLineParser); ok {
+		return pp.ParseAt(l.Text, l.Position)
+	}
+
+	return as.lineParser.Parse(l.Text)
+}
+
+// Store parses and stores lines synchronously. It is meant for push based sources, which
+// confirm delivery to the sender only after lines are stored. Invalid lines are skipped, or
+// stored in dead letter repository when it is set. Lines held by parser are stored before
+// Store returns, so they are merged only with lines of the same call.
+func (as *AuditService) Store(lines []string) (uint64, error) {
+	as.storeMutex.Lock()
+	defer as.storeMutex.Unlock()
+
+	buf := [][]byte{}
+	dead := [][]byte{}
+	for _, l := range lines {
+		b, err := as.parse(Line{Text: l})
+		if errors.Is(err, ErrHoldLine) {
+			log.WithField("line", l).Trace("Line held by parser")
+			continue
+		} else if errors.Is(err, ErrSkipLine) {
+			log.WithField("line", l).Trace("Line skipped by parser")
+			continue
+		} else if err != nil && as.deadLetter != nil {
+			log.WithError(err).WithField("line", l).Debug("Invalid line format, dead-lettering")
+			d, err := as.deadLetterEntry(Line{Text: l}, err)
+			if err != nil {
+				return 0, err
+			}
+			dead = append(dead, d)
+			continue
+		} else if err != nil {
+			log.WithError(err).WithField("line", l).Debug("Invalid line format, skipping")
+			continue
+		}
+
+		buf = append(buf, b)
+	}
+
+	held, err := as.flushParser(true)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range held {
+		buf = append(buf, e.Entry)
+	}
+
+	err = as.writeDeadLetters(dead)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	id, err := as.jsonRepository.WriteBytes(buf)
+	if err != nil {
+		return 0, fmt.Errorf("could not store audit entry, %w", err)
+	}
+
+	log.WithField("TXID", id).WithField("count", len(buf)).Trace("Stored lines")
+	return id, nil
+}
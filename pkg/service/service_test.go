@@ -0,0 +1,261 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPosition int
+
+func (p testPosition) String() string {
+	return fmt.Sprint(int(p))
+}
+
+type testLineProvider struct {
+	lC    chan Line
+	acked []Position
+	saved int
+}
+
+func (p *testLineProvider) ReadLine() chan Line {
+	return p.lC
+}
+
+func (p *testLineProvider) Ack(positions []Position) {
+	p.acked = append(p.acked, positions...)
+}
+
+func (p *testLineProvider) SaveState() {
+	p.saved++
+}
+
+type testLineParser struct{}
+
+func (testLineParser) Parse(line string) ([]byte, error) {
+	if strings.HasPrefix(line, "skip") {
+		return nil, ErrSkipLine
+	}
+
+	if strings.HasPrefix(line, "invalid") {
+		return nil, errors.New("invalid")
+	}
+
+	return []byte(line), nil
+}
+
+type testRepository struct {
+	stored [][]byte
+	err    error
+	// entries stored before err
+	partial int
+}
+
+func (r *testRepository) WriteBytes(b [][]byte) (uint64, error) {
+	if r.err != nil && r.partial > 0 {
+		r.stored = append(r.stored, b[:r.partial]...)
+		return 0, &PartialWriteError{Written: r.partial, Err: r.err}
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.stored = append(r.stored, b...)
+	return 1, nil
+}
+
+func TestAuditServiceAcksStoredLines(t *testing.T) {
+	lines := []string{}
+	for i := 0; i < 250; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	lines = append(lines, "skip", "invalid")
+
+	type testData struct {
+		name      string
+		repoErr   error
+		partial   int
+		expectErr bool
+		stored    int
+		acked     int
+	}
+
+	tdd := []testData{
+		{
+			name:   "all lines are acknowledged after last batch is stored",
+			stored: 250,
+			acked:  252,
+		},
+		{
+			name:      "lines are not acknowledged when store fails",
+			repoErr:   errors.New("unavailable"),
+			expectErr: true,
+		},
+		{
+			name:      "lines of partially stored batch are acknowledged",
+			repoErr:   errors.New("unavailable"),
+			partial:   50,
+			expectErr: true,
+			stored:    50,
+			acked:     50,
+		},
+	}
+
+	for _, td := range tdd {
+		lp := &testLineProvider{lC: make(chan Line)}
+		repo := &testRepository{err: td.repoErr, partial: td.partial}
+		go func() {
+			for i, l := range lines {
+				lp.lC <- Line{Text: l, Position: testPosition(i)}
+			}
+			close(lp.lC)
+		}()
+
+		err := NewAuditService(lp, testLineParser{}, repo).Run()
+		if td.expectErr {
+			assert.Error(t, err, td.name)
+			assert.Equal(t, td.partial, Written(err), td.name)
+			for range lp.lC {
+			}
+		} else {
+			assert.NoError(t, err, td.name)
+			assert.Equal(t, 1, lp.saved, td.name)
+		}
+
+		assert.Len(t, repo.stored, td.stored, td.name)
+		assert.Len(t, lp.acked, td.acked, td.name)
+		for i, p := range lp.acked {
+			assert.Equal(t, testPosition(i), p, td.name)
+		}
+	}
+}
+
+// testFlushLineParser holds lines starting with "hold" until line "release", or flush
+type testFlushLineParser struct {
+	held      []string
+	positions []Position
+	merged    []Position
+}
+
+func (p *testFlushLineParser) Parse(line string) ([]byte, error) {
+	return p.ParseAt(line, nil)
+}
+
+func (p *testFlushLineParser) ParseAt(line string, position Position) ([]byte, error) {
+	p.merged = nil
+	if strings.HasPrefix(line, "hold") {
+		p.held = append(p.held, line)
+		if position != nil {
+			p.positions = append(p.positions, position)
+		}
+		return nil, ErrHoldLine
+	}
+
+	if line == "release" {
+		line = strings.Join(append(p.held, line), ",")
+		p.merged = p.positions
+		p.held, p.positions = nil, nil
+	}
+
+	return []byte(line), nil
+}
+
+func (p *testFlushLineParser) Merged() []Position {
+	return p.merged
+}
+
+func (p *testFlushLineParser) Flush(all bool) ([]HeldEntry, error) {
+	if !all || len(p.held) == 0 {
+		return nil, nil
+	}
+
+	held := []HeldEntry{{Entry: []byte(strings.Join(p.held, ",")), Positions: p.positions}}
+	p.held, p.positions = nil, nil
+	return held, nil
+}
+
+func TestAuditServiceStoresHeldLines(t *testing.T) {
+	lp := &testLineProvider{lC: make(chan Line)}
+	repo := &testRepository{}
+	go func() {
+		for i, l := range []string{"line", "hold 1", "hold 2"} {
+			lp.lC <- Line{Text: l, Position: testPosition(i)}
+		}
+		close(lp.lC)
+	}()
+
+	err := NewAuditService(lp, &testFlushLineParser{}, repo).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("line"), []byte("hold 1,hold 2")}, repo.stored)
+	assert.Equal(t, []Position{testPosition(0), testPosition(1), testPosition(2)}, lp.acked)
+
+	// held lines are not only kept in memory when Store returns
+	repo = &testRepository{}
+	s := NewAuditService(nil, &testFlushLineParser{}, repo)
+	_, err = s.Store([]string{"hold 1", "line"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("line"), []byte("hold 1")}, repo.stored)
+}
+
+func TestAuditServiceKeepsHeldPositions(t *testing.T) {
+	lines := []string{"line", "hold", "line"}
+	for i := 0; i < 250; i++ {
+		lines = append(lines, "line")
+	}
+
+	lp := &testLineProvider{lC: make(chan Line)}
+	repo := &testRepository{err: errors.New("unavailable"), partial: 100}
+	go func() {
+		for i, l := range lines {
+			lp.lC <- Line{Text: l, Position: testPosition(i)}
+		}
+		lp.lC <- Line{Text: "release", Position: testPosition(len(lines))}
+		close(lp.lC)
+	}()
+
+	// held line and lines following it are acknowledged only after merged entry is stored
+	err := NewAuditService(lp, &testFlushLineParser{}, repo).Run()
+	assert.Error(t, err)
+	for range lp.lC {
+	}
+	assert.Equal(t, []Position{testPosition(0)}, lp.acked)
+
+	lp = &testLineProvider{lC: make(chan Line)}
+	repo = &testRepository{}
+	go func() {
+		for i, l := range lines {
+			lp.lC <- Line{Text: l, Position: testPosition(i)}
+		}
+		lp.lC <- Line{Text: "release", Position: testPosition(len(lines))}
+		close(lp.lC)
+	}()
+
+	err = NewAuditService(lp, &testFlushLineParser{}, repo).Run()
+	assert.NoError(t, err)
+	assert.Len(t, repo.stored, len(lines))
+	assert.Equal(t, []byte("hold,release"), repo.stored[len(lines)-1])
+	assert.Len(t, lp.acked, len(lines)+1)
+	for i, p := range lp.acked {
+		assert.Equal(t, testPosition(i), p)
+	}
+}
@@ -18,22 +18,90 @@ package source
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
 
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	log "github.com/sirupsen/logrus"
 )
 
+// dockerCheckpoint is timestamp of last stored line and number of stored lines having
+// exactly that timestamp, which are skipped when resuming
+type dockerCheckpoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Count     int       `json:"count"`
+}
+
+type dockerPosition struct {
+	container string
+	timestamp time.Time
+	count     int
+}
+
+func (p *dockerPosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.container, p.timestamp.UnixNano(), p.count)
+}
+
 type dockerTail struct {
-	reader  io.ReadCloser
-	scanner *bufio.Scanner
-	ctx     context.Context
-	lC      chan string
+	container      string
+	reader         io.ReadCloser
+	scanner        *bufio.Scanner
+	ctx            context.Context
+	lC             chan service.Line
+	skip           dockerCheckpoint
+	registryDB     bool
+	registryDBFile string
+	registryMutex  sync.Mutex
+	registry       map[string]dockerCheckpoint
 }
 
-func NewDockerTail(ctx context.Context, container string, follow bool, since string, showStdout bool, showStderr bool) (*dockerTail, error) {
+// NewDockerTail reads container logs with timestamps, which are used as line positions. When
+// registry is enabled and since is not given, reading resumes after the last stored line.
+func NewDockerTail(ctx context.Context, container string, follow bool, since string, showStdout bool, showStderr bool, registryDB bool, registryFolder string) (*dockerTail, error) {
+	registry := map[string]dockerCheckpoint{}
+	registryDBFile := "registry-docker.txt"
+
+	if registryDB {
+		if registryFolder != "" {
+			fi, err := os.Stat(registryFolder)
+			if err != nil {
+				return nil, fmt.Errorf("could not stat registry directory: %w", err)
+			}
+
+			if !fi.IsDir() {
+				return nil, fmt.Errorf("registry folder is not a directory")
+			}
+
+			registryDBFile = path.Join(registryFolder, registryDBFile)
+		}
+
+		drBytes, err := os.ReadFile(registryDBFile)
+		if err != nil {
+			log.WithError(err).WithField("path", registryDBFile).Info("registry file cannot be read")
+		} else {
+			err = json.Unmarshal(drBytes, &registry)
+			if err != nil {
+				log.WithError(err).WithField("path", registryDBFile).Info("registry file cannot be unmarshaled, ignoring")
+			}
+		}
+	}
+
+	var skip dockerCheckpoint
+	if cp, ok := registry[container]; ok && since == "" {
+		log.WithField("container", container).WithField("since", cp.Timestamp).Info("Resuming docker logs")
+		since = cp.Timestamp.Format(time.RFC3339Nano)
+		skip = cp
+	}
+
 	cli, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
 		return nil, fmt.Errorf("could not create docker client, %w", err)
@@ -41,17 +109,22 @@ func NewDockerTail(ctx context.Context, container string, follow bool, since str
 
 	cli.NegotiateAPIVersion(ctx)
 
-	reader, err := cli.ContainerLogs(ctx, container, types.ContainerLogsOptions{Follow: follow, Since: since, ShowStdout: showStdout, ShowStderr: showStderr})
+	reader, err := cli.ContainerLogs(ctx, container, types.ContainerLogsOptions{Follow: follow, Since: since, ShowStdout: showStdout, ShowStderr: showStderr, Timestamps: true})
 	if err != nil {
 		return nil, fmt.Errorf("could not create docker logs reader: %w", err)
 	}
 	scanner := bufio.NewScanner(reader)
 
 	dt := &dockerTail{
-		reader:  reader,
-		scanner: scanner,
-		ctx:     ctx,
-		lC:      make(chan string),
+		container:      container,
+		reader:         reader,
+		scanner:        scanner,
+		ctx:            ctx,
+		lC:             make(chan service.Line),
+		skip:           skip,
+		registryDB:     registryDB,
+		registryDBFile: registryDBFile,
+		registry:       registry,
 	}
 
 	go dt.read()
@@ -59,21 +132,38 @@ func NewDockerTail(ctx context.Context, container string, follow bool, since str
 }
 
 func (dt *dockerTail) read() {
+	var last time.Time
+	count := 0
 	for stop := false; !stop && dt.scanner.Scan(); {
 		b := dt.scanner.Bytes()
 		if len(b) == 0 {
 			continue
 		}
 
-		var s string
 		if len(b) > 8 && (b[0] == 1 || b[0] == 2) {
-			s = string(b[8:])
+			b = b[8:]
+		}
+
+		ts, text, err := splitDockerTimestamp(b)
+		if err != nil {
+			log.WithError(err).WithField("container", dt.container).Warn("Could not parse docker log timestamp, skipping")
+			continue
+		}
+
+		if ts.Equal(last) {
+			count++
 		} else {
-			s = string(b)
+			last = ts
+			count = 1
+		}
+
+		// lines stored before restart
+		if ts.Before(dt.skip.Timestamp) || (ts.Equal(dt.skip.Timestamp) && count <= dt.skip.Count) {
+			continue
 		}
 
 		select {
-		case dt.lC <- s:
+		case dt.lC <- service.Line{Text: text, Position: &dockerPosition{container: dt.container, timestamp: ts, count: count}}:
 		case <-dt.ctx.Done():
 			stop = true
 		}
@@ -82,10 +172,61 @@ func (dt *dockerTail) read() {
 	close(dt.lC)
 }
 
-func (*dockerTail) SaveState() {
-	// noop
+func splitDockerTimestamp(b []byte) (time.Time, string, error) {
+	i := bytes.IndexByte(b, ' ')
+	if i < 0 {
+		i = len(b)
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, string(b[:i]))
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	if i == len(b) {
+		return ts, "", nil
+	}
+
+	return ts, string(b[i+1:]), nil
+}
+
+func (dt *dockerTail) Ack(positions []service.Position) {
+	dt.registryMutex.Lock()
+	defer dt.registryMutex.Unlock()
+
+	for _, p := range positions {
+		dp, ok := p.(*dockerPosition)
+		if !ok {
+			continue
+		}
+
+		dt.registry[dp.container] = dockerCheckpoint{Timestamp: dp.timestamp, Count: dp.count}
+	}
+}
+
+func (dt *dockerTail) SaveState() {
+	if !dt.registryDB {
+		return
+	}
+
+	dt.registryMutex.Lock()
+	defer dt.registryMutex.Unlock()
+
+	drBytes, err := json.Marshal(dt.registry)
+	if err != nil {
+		log.WithError(err).Error("Could not marshal docker registry")
+		return
+	}
+
+	err = os.WriteFile(dt.registryDBFile, drBytes, 0666)
+	if err != nil {
+		log.WithError(err).WithField("path", dt.registryDBFile).Error("Could not write docker registry")
+		return
+	}
+
+	log.WithField("path", dt.registryDBFile).Info("Saved docker tail state")
 }
 
-func (dt *dockerTail) ReadLine() chan string {
+func (dt *dockerTail) ReadLine() chan service.Line {
 	return dt.lC
 }
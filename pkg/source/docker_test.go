@@ -0,0 +1,34 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitDockerTimestamp(t *testing.T) {
+	ts, text, err := splitDockerTimestamp([]byte("2023-03-10T22:38:26.458638123Z some log line"))
+	require.NoError(t, err)
+	assert.Equal(t, 458638123, ts.Nanosecond())
+	assert.Equal(t, "some log line", text)
+
+	_, _, err = splitDockerTimestamp([]byte("some log line"))
+	assert.Error(t, err)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package source
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -25,9 +26,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/codenotary/immudb-log-audit/pkg/service"
 	"github.com/nxadm/tail"
 	log "github.com/sirupsen/logrus"
 )
@@ -38,6 +42,22 @@ type fileMonitor struct {
 	Offset       int64  `json:"offset"`
 }
 
+// filePosition is applied to file monitor when the line is acknowledged
+type filePosition struct {
+	file   string
+	fm     *fileMonitor
+	offset int64
+	text   string
+}
+
+func (p *filePosition) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.offset)
+}
+
+func (p *filePosition) Stream() string {
+	return p.file
+}
+
 type fileWatch struct {
 	fi *os.FileInfo
 	t  *tail.Tail
@@ -51,7 +71,7 @@ type fileTail struct {
 	registryDBFile string
 	registryMutex  sync.RWMutex
 	registry       map[string]fileWatch
-	lC             chan string
+	lC             chan service.Line
 	wg             sync.WaitGroup
 	ctx            context.Context
 }
@@ -96,7 +116,7 @@ func NewFileTail(ctx context.Context, pattern string, follow bool, registryDB bo
 		registryDBFile: registryDBFile,
 		registryMutex:  sync.RWMutex{},
 		registry:       registry,
-		lC:             make(chan string),
+		lC:             make(chan service.Line),
 		ctx:            ctx,
 	}
 
@@ -104,10 +124,38 @@ func NewFileTail(ctx context.Context, pattern string, follow bool, registryDB bo
 	return &ft, nil
 }
 
-func (ft *fileTail) ReadLine() chan string {
+func (ft *fileTail) ReadLine() chan service.Line {
 	return ft.lC
 }
 
+// Ack advances file offsets, so registry contains only offsets of stored lines
+func (ft *fileTail) Ack(positions []service.Position) {
+	ft.registryMutex.Lock()
+	defer ft.registryMutex.Unlock()
+
+	for _, p := range positions {
+		fp, ok := p.(*filePosition)
+		if !ok {
+			continue
+		}
+
+		fm := fp.fm
+		if fm.Offset > fp.offset {
+			log.WithField("file", fp.file).WithField("fm_offset", fm.Offset).WithField("offset", fp.offset).Debug("Detected truncation")
+			fm.Prefix = []byte{}
+			fm.PrefixLength = 0
+			fm.Offset = 0
+		}
+
+		fm.Offset += int64(len(fp.text)) + 1
+		if fm.PrefixLength < 1000 {
+			fm.Prefix = append(fm.Prefix, []byte(fp.text)...)
+			fm.Prefix = append(fm.Prefix, []byte("\n")...)
+			fm.PrefixLength += len(fp.text) + 1
+		}
+	}
+}
+
 func (ft *fileTail) SaveState() {
 	if ft.registryDB {
 		ft.registryMutex.Lock()
@@ -157,22 +205,17 @@ func (ft *fileTail) watchFiles() {
 									return
 								}
 
-								ft.lC <- l.Text
-								ft.registryMutex.RLock()
-								if fw.Fm.Offset > l.SeekInfo.Offset {
-									log.WithField("file", fw.t.Filename).WithField("fm_offset", fw.Fm.Offset).WithField("offset", l.SeekInfo.Offset).Debug("Detected truncation")
-									fw.Fm.Prefix = []byte{}
-									fw.Fm.PrefixLength = 0
-									fw.Fm.Offset = 0
+								line := service.Line{
+									Text:     l.Text,
+									Position: &filePosition{file: fw.t.Filename, fm: fw.Fm, offset: l.SeekInfo.Offset, text: l.Text},
 								}
 
-								fw.Fm.Offset += int64(len(l.Text)) + 1
-								if fw.Fm.PrefixLength < 1000 {
-									fw.Fm.Prefix = append(fw.Fm.Prefix, []byte(l.Text)...)
-									fw.Fm.Prefix = append(fw.Fm.Prefix, []byte("\n")...)
-									fw.Fm.PrefixLength += len(l.Text) + 1
+								select {
+								case ft.lC <- line:
+								case <-ft.ctx.Done():
+									log.WithField("file", fw.t.Filename).Info("Closing")
+									return
 								}
-								ft.registryMutex.RUnlock()
 							}
 						}
 					}()
@@ -278,3 +321,68 @@ nextFile:
 	ft.registry = newFileRegistry
 	return newFiles, nil
 }
+
+// ReadFileLines reads all lines of files matching pattern, oldest file first, so rotated files
+// are read in order. Lines get the same positions as when tailed.
+func ReadFileLines(pattern string, fn func(file string, lineNumber int, line service.Line) error) error {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("could not glob for pattern, %w", err)
+	}
+
+	if len(matches) == 0 {
+		return fmt.Errorf("no files matching %s", pattern)
+	}
+
+	modTimes := map[string]time.Time{}
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			return fmt.Errorf("could not stat file, %w", err)
+		}
+		modTimes[m] = fi.ModTime()
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return modTimes[matches[i]].Before(modTimes[matches[j]]) })
+
+	for _, m := range matches {
+		err := readFileLines(m, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readFileLines(file string, fn func(file string, lineNumber int, line service.Line) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open file, %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for lineNumber := 1; ; lineNumber++ {
+		l, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("could not read file %s, %w", file, err)
+		}
+
+		if l == "" && err == io.EOF {
+			return nil
+		}
+
+		offset += int64(len(l))
+		text := strings.TrimRight(l, "\n")
+		ferr := fn(file, lineNumber, service.Line{Text: text, Position: &filePosition{file: file, offset: offset, text: text}})
+		if ferr != nil {
+			return ferr
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
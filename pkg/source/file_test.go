@@ -0,0 +1,92 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTailSavesAckedOffsets(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "test.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("first\nsecond\nthird\n"), 0644))
+
+	readRegistry := func() map[string]fileWatch {
+		b, err := os.ReadFile(filepath.Join(dir, "registry-file.txt"))
+		require.NoError(t, err)
+		registry := map[string]fileWatch{}
+		require.NoError(t, json.Unmarshal(b, &registry))
+		return registry
+	}
+
+	ft, err := NewFileTail(context.Background(), logFile, false, true, dir)
+	require.NoError(t, err)
+
+	positions := []service.Position{}
+	for l := range ft.ReadLine() {
+		positions = append(positions, l.Position)
+	}
+	require.Len(t, positions, 3)
+
+	// nothing is stored yet
+	ft.SaveState()
+	assert.Equal(t, int64(0), readRegistry()[logFile].Fm.Offset)
+
+	ft.Ack(positions[:2])
+	ft.SaveState()
+	assert.Equal(t, int64(len("first\nsecond\n")), readRegistry()[logFile].Fm.Offset)
+
+	// restart reads not acknowledged lines again
+	ft, err = NewFileTail(context.Background(), logFile, false, true, dir)
+	require.NoError(t, err)
+
+	lines := []string{}
+	for l := range ft.ReadLine() {
+		lines = append(lines, l.Text)
+	}
+	assert.Equal(t, []string{"third"}, lines)
+}
+
+func TestReadFileLinesPositions(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("first\n\nthird\nlast without new line"), 0644))
+
+	ft, err := NewFileTail(context.Background(), logFile, false, false, "")
+	require.NoError(t, err)
+
+	tailed := []string{}
+	for l := range ft.ReadLine() {
+		tailed = append(tailed, l.Position.String())
+	}
+
+	read := []string{}
+	err = ReadFileLines(logFile, func(file string, lineNumber int, line service.Line) error {
+		read = append(read, line.Position.String())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, tailed, read)
+	assert.Len(t, read, 4)
+}
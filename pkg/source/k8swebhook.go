@@ -0,0 +1,167 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const k8sWebhookMaxBodySize = 64 * 1024 * 1024
+
+type lineStore interface {
+	Store(lines []string) (uint64, error)
+}
+
+type k8sEventList struct {
+	Kind       string            `json:"kind"`
+	APIVersion string            `json:"apiVersion"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+type k8sWebhook struct {
+	listener net.Listener
+	server   *http.Server
+	store    lineStore
+}
+
+// NewK8sWebhook creates kubernetes audit webhook backend. Each received EventList is split into
+// events, which are stored synchronously, so the api server gets success response only when
+// events are persisted and retries otherwise.
+func NewK8sWebhook(address string, tlsConfig *tls.Config, store lineStore) (*k8sWebhook, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s, %w", address, err)
+	}
+
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	} else {
+		log.Warn("Kubernetes audit webhook is served without TLS")
+	}
+
+	kw := &k8sWebhook{
+		listener: l,
+		store:    store,
+	}
+
+	kw.server = &http.Server{
+		Handler:           kw,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return kw, nil
+}
+
+func (kw *k8sWebhook) Addr() net.Addr {
+	return kw.listener.Addr()
+}
+
+// Run serves webhook requests until context is done.
+func (kw *k8sWebhook) Run(ctx context.Context) error {
+	errC := make(chan error, 1)
+	go func() {
+		log.WithField("address", kw.Addr().String()).Info("Kubernetes audit webhook started")
+		errC <- kw.server.Serve(kw.listener)
+	}()
+
+	select {
+	case err := <-errC:
+		return fmt.Errorf("kubernetes audit webhook stopped, %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := kw.server.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("could not shutdown kubernetes audit webhook, %w", err)
+	}
+
+	return nil
+}
+
+func (kw *k8sWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, k8sWebhookMaxBodySize))
+	if err != nil {
+		log.WithError(err).Warn("Could not read kubernetes audit webhook request")
+		http.Error(w, "could not read request", http.StatusBadRequest)
+		return
+	}
+
+	lines, err := splitK8sEventList(body)
+	if err != nil {
+		log.WithError(err).Warn("Invalid kubernetes audit webhook request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(lines) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, err := kw.store.Store(lines)
+	if err != nil {
+		log.WithError(err).WithField("events", len(lines)).Error("Could not store kubernetes audit events")
+		http.Error(w, "could not store events", http.StatusServiceUnavailable)
+		return
+	}
+
+	log.WithField("events", len(lines)).WithField("TXID", id).Debug("Stored kubernetes audit events")
+	w.WriteHeader(http.StatusOK)
+}
+
+// splitK8sEventList returns each event as single line json
+func splitK8sEventList(body []byte) ([]string, error) {
+	var el k8sEventList
+	err := json.Unmarshal(body, &el)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event list, %w", err)
+	}
+
+	if el.Kind != "EventList" || el.APIVersion != "audit.k8s.io/v1" {
+		return nil, fmt.Errorf("not supported event list, kind '%s', apiVersion '%s'", el.Kind, el.APIVersion)
+	}
+
+	lines := make([]string, 0, len(el.Items))
+	for _, item := range el.Items {
+		var b bytes.Buffer
+		err := json.Compact(&b, item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event, %w", err)
+		}
+
+		lines = append(lines, b.String())
+	}
+
+	return lines, nil
+}
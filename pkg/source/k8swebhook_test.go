@@ -0,0 +1,103 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package source
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLineStore struct {
+	lines []string
+	err   error
+}
+
+func (s *testLineStore) Store(lines []string) (uint64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	s.lines = append(s.lines, lines...)
+	return 1, nil
+}
+
+func TestK8sWebhook(t *testing.T) {
+	eventList := `{"kind":"EventList","apiVersion":"audit.k8s.io/v1","metadata":{},"items":[
+		{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"1","stage":"RequestReceived","verb":"get"},
+		{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"1","stage":"ResponseComplete","verb":"get"}]}`
+
+	type testData struct {
+		name     string
+		method   string
+		body     string
+		storeErr error
+		status   int
+		stored   []string
+	}
+
+	tdd := []testData{
+		{
+			name:   "event list is split into events",
+			method: http.MethodPost,
+			body:   eventList,
+			status: http.StatusOK,
+			stored: []string{
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"1","stage":"RequestReceived","verb":"get"}`,
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"1","stage":"ResponseComplete","verb":"get"}`,
+			},
+		},
+		{
+			name:     "failed store is not acknowledged",
+			method:   http.MethodPost,
+			body:     eventList,
+			storeErr: errors.New("vault unavailable"),
+			status:   http.StatusServiceUnavailable,
+		},
+		{
+			name:   "invalid kind",
+			method: http.MethodPost,
+			body:   `{"kind":"Event","apiVersion":"audit.k8s.io/v1"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid method",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, td := range tdd {
+		td := td
+		t.Run(td.name, func(t *testing.T) {
+			store := &testLineStore{err: td.storeErr}
+			kw, err := NewK8sWebhook("127.0.0.1:0", nil, store)
+			require.NoError(t, err)
+			defer kw.listener.Close()
+
+			rec := httptest.NewRecorder()
+			kw.ServeHTTP(rec, httptest.NewRequest(td.method, "/", strings.NewReader(td.body)))
+			assert.Equal(t, td.status, rec.Code)
+			assert.Equal(t, td.stored, store.lines)
+		})
+	}
+}
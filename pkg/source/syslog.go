@@ -0,0 +1,314 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package source
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SyslogFramingAuto           = "auto"
+	SyslogFramingOctetCounting  = "octet-counting"
+	SyslogFramingNonTransparent = "non-transparent"
+
+	syslogMaxMessageSize = 64 * 1024
+)
+
+type syslogTail struct {
+	protocol   string
+	framing    string
+	packetConn net.PacketConn
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	connsMutex sync.Mutex
+	closed     bool // set under connsMutex, so no connection is tracked after close
+	lC         chan service.Line
+	wg         sync.WaitGroup
+	ctx        context.Context
+}
+
+// NewSyslogTail starts syslog receiver listening on given address. Supported protocols are udp and tcp,
+// when tlsConfig is provided, tcp connections are served over TLS. For tcp, messages can be framed
+// with octet counting (RFC 6587 3.4.1) or be new line delimited (RFC 6587 3.4.2).
+func NewSyslogTail(ctx context.Context, protocol string, address string, framing string, tlsConfig *tls.Config) (*syslogTail, error) {
+	if framing == "" {
+		framing = SyslogFramingAuto
+	}
+
+	if framing != SyslogFramingAuto && framing != SyslogFramingOctetCounting && framing != SyslogFramingNonTransparent {
+		return nil, fmt.Errorf("not supported syslog framing: %s", framing)
+	}
+
+	st := &syslogTail{
+		protocol: protocol,
+		framing:  framing,
+		conns:    map[net.Conn]struct{}{},
+		lC:       make(chan service.Line),
+		ctx:      ctx,
+	}
+
+	switch protocol {
+	case "udp":
+		if tlsConfig != nil {
+			return nil, errors.New("TLS is supported only with tcp protocol")
+		}
+
+		pc, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen on %s, %w", address, err)
+		}
+
+		st.packetConn = pc
+		st.wg.Add(1)
+		go st.readPackets()
+	case "tcp":
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen on %s, %w", address, err)
+		}
+
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+
+		st.listener = l
+		st.wg.Add(1)
+		go st.accept()
+	default:
+		return nil, fmt.Errorf("not supported syslog protocol: %s", protocol)
+	}
+
+	log.WithField("protocol", protocol).WithField("address", st.Addr().String()).WithField("tls", tlsConfig != nil).Info("Syslog receiver started")
+
+	go func() {
+		<-ctx.Done()
+		st.close()
+	}()
+
+	go func() {
+		st.wg.Wait()
+		close(st.lC)
+	}()
+
+	return st, nil
+}
+
+func (st *syslogTail) Addr() net.Addr {
+	if st.packetConn != nil {
+		return st.packetConn.LocalAddr()
+	}
+
+	return st.listener.Addr()
+}
+
+func (st *syslogTail) ReadLine() chan service.Line {
+	return st.lC
+}
+
+func (*syslogTail) Ack(positions []service.Position) {
+	// noop, received messages cannot be read again
+}
+
+func (*syslogTail) SaveState() {
+	// noop
+}
+
+func (st *syslogTail) close() {
+	if st.packetConn != nil {
+		st.packetConn.Close()
+	}
+
+	if st.listener != nil {
+		st.listener.Close()
+	}
+
+	st.connsMutex.Lock()
+	defer st.connsMutex.Unlock()
+	st.closed = true
+	for c := range st.conns {
+		c.Close()
+	}
+}
+
+func (st *syslogTail) push(msg string) bool {
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	if msg == "" {
+		return true
+	}
+
+	select {
+	case st.lC <- service.Line{Text: msg}:
+		return true
+	case <-st.ctx.Done():
+		return false
+	}
+}
+
+func (st *syslogTail) readPackets() {
+	defer st.wg.Done()
+
+	buf := make([]byte, syslogMaxMessageSize)
+	for {
+		n, addr, err := st.packetConn.ReadFrom(buf)
+		if err != nil {
+			if st.ctx.Err() == nil {
+				log.WithError(err).Error("could not read syslog datagram, closing")
+			}
+			return
+		}
+
+		log.WithField("remote", addr.String()).Trace("Received syslog datagram")
+		// single datagram is a single message, which can contain new lines
+		if !st.push(string(buf[:n])) {
+			return
+		}
+	}
+}
+
+func (st *syslogTail) accept() {
+	defer st.wg.Done()
+
+	for {
+		c, err := st.listener.Accept()
+		if err != nil {
+			if st.ctx.Err() == nil {
+				log.WithError(err).Error("could not accept syslog connection, closing")
+			}
+			return
+		}
+
+		st.connsMutex.Lock()
+		if st.closed {
+			st.connsMutex.Unlock()
+			c.Close()
+			return
+		}
+
+		st.conns[c] = struct{}{}
+		st.wg.Add(1)
+		st.connsMutex.Unlock()
+
+		go st.readConn(c)
+	}
+}
+
+func (st *syslogTail) readConn(c net.Conn) {
+	defer st.wg.Done()
+	defer func() {
+		st.connsMutex.Lock()
+		delete(st.conns, c)
+		st.connsMutex.Unlock()
+		c.Close()
+	}()
+
+	remote := c.RemoteAddr().String()
+	log.WithField("remote", remote).Debug("New syslog connection")
+
+	err := readSyslogStream(bufio.NewReaderSize(c, syslogMaxMessageSize), st.framing, st.push)
+	if err != nil && st.ctx.Err() == nil {
+		log.WithError(err).WithField("remote", remote).Warn("Syslog connection closed with error")
+		return
+	}
+
+	log.WithField("remote", remote).Debug("Syslog connection closed")
+}
+
+// readSyslogStream splits tcp stream into syslog messages. With auto framing, each message is
+// checked if it starts with a digit, which is the case only for octet counted frames, as
+// non-transparent frames start with '<' of PRI part.
+func readSyslogStream(r *bufio.Reader, framing string, push func(string) bool) error {
+	for {
+		octetCounted := framing == SyslogFramingOctetCounting
+		if framing == SyslogFramingAuto {
+			b, err := r.Peek(1)
+			if err != nil {
+				return ignoreEOF(err)
+			}
+
+			octetCounted = b[0] >= '0' && b[0] <= '9'
+		}
+
+		var msg string
+		if octetCounted {
+			lenStr, err := r.ReadString(' ')
+			if err != nil {
+				return ignoreEOF(err)
+			}
+
+			msgLen, err := strconv.Atoi(strings.TrimSpace(lenStr))
+			if err != nil || msgLen < 0 || msgLen > syslogMaxMessageSize {
+				return fmt.Errorf("invalid octet count frame length '%s'", strings.TrimSpace(lenStr))
+			}
+
+			b := make([]byte, msgLen)
+			_, err = io.ReadFull(r, b)
+			if err != nil {
+				return fmt.Errorf("could not read octet counted frame, %w", err)
+			}
+
+			msg = string(b)
+		} else {
+			line, err := readFrame(r)
+			if err != nil && (err != io.EOF || line == "") {
+				return ignoreEOF(err)
+			}
+
+			msg = line
+		}
+
+		if !push(msg) {
+			return nil
+		}
+	}
+}
+
+// readFrame reads non-transparent frame up to new line, frames longer than max message size
+// are not buffered and the connection is closed with an error
+func readFrame(r *bufio.Reader) (string, error) {
+	frame := []byte{}
+	for {
+		b, err := r.ReadSlice('\n')
+		if len(frame)+len(b) > syslogMaxMessageSize {
+			return "", fmt.Errorf("non-transparent frame is longer than %d bytes", syslogMaxMessageSize)
+		}
+
+		frame = append(frame, b...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return string(frame), err
+		}
+	}
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package source
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogStreamFraming(t *testing.T) {
+	type testData struct {
+		framing   string
+		stream    string
+		expected  []string
+		expectErr bool
+	}
+
+	tdd := []testData{
+		{
+			framing:  SyslogFramingAuto,
+			stream:   "<34>1 2003-10-11T22:14:15.003Z host su - ID47 - first\n<34>Oct 11 22:14:15 host su: second\n",
+			expected: []string{"<34>1 2003-10-11T22:14:15.003Z host su - ID47 - first", "<34>Oct 11 22:14:15 host su: second"},
+		},
+		{
+			framing:  SyslogFramingAuto,
+			stream:   "12 <13>line one12 <13>line\ntwo<13>no frame",
+			expected: []string{"<13>line one", "<13>line\ntwo", "<13>no frame"},
+		},
+		{
+			framing:  SyslogFramingOctetCounting,
+			stream:   "5 <13>a",
+			expected: []string{"<13>a"},
+		},
+		{
+			framing:   SyslogFramingOctetCounting,
+			stream:    "abc <13>a",
+			expected:  []string{},
+			expectErr: true,
+		},
+		{
+			framing:  SyslogFramingNonTransparent,
+			stream:   "<13>" + strings.Repeat("a", 10000) + "\n<13>b\n",
+			expected: []string{"<13>" + strings.Repeat("a", 10000), "<13>b"},
+		},
+		{
+			framing:   SyslogFramingNonTransparent,
+			stream:    "<13>a\n<13>" + strings.Repeat("a", syslogMaxMessageSize),
+			expected:  []string{"<13>a"},
+			expectErr: true,
+		},
+	}
+
+	for i, td := range tdd {
+		td := td
+		t.Run(fmt.Sprintf("framing %d", i), func(t *testing.T) {
+			msgs := []string{}
+			err := readSyslogStream(bufio.NewReader(strings.NewReader(td.stream)), td.framing, func(s string) bool {
+				msgs = append(msgs, strings.TrimRight(s, "\n"))
+				return true
+			})
+			if td.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, td.expected, msgs)
+		})
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	st, err := NewSyslogTail(ctx, "udp", "127.0.0.1:0", "", nil)
+	require.NoError(t, err)
+
+	c, err := net.Dial("udp", st.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("<13>Jan  6 13:57:19 host app: message\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "<13>Jan  6 13:57:19 host app: message", (<-st.ReadLine()).Text)
+
+	// datagram is a single message, even when it contains new lines
+	_, err = c.Write([]byte("<13>1 2003-10-11T22:14:15.003Z host app - - - first\nsecond"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "<13>1 2003-10-11T22:14:15.003Z host app - - - first\nsecond", (<-st.ReadLine()).Text)
+
+	cancel()
+	_, ok := <-st.ReadLine()
+	assert.False(t, ok)
+}
+
+func TestSyslogTCPClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	st, err := NewSyslogTail(ctx, "tcp", "127.0.0.1:0", "", nil)
+	require.NoError(t, err)
+
+	c, err := net.Dial("tcp", st.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("<13>Jan  6 13:57:19 host app: message\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "<13>Jan  6 13:57:19 host app: message", (<-st.ReadLine()).Text)
+
+	// open connections are closed, so receiver stops
+	cancel()
+	select {
+	case _, ok := <-st.ReadLine():
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "receiver did not stop")
+	}
+}
+
+// closingListener closes syslog receiver before it returns accepted connection
+type closingListener struct {
+	net.Listener
+	st       *syslogTail
+	accepted net.Conn
+}
+
+func (l *closingListener) Accept() (net.Conn, error) {
+	if l.accepted != nil {
+		return nil, net.ErrClosed
+	}
+
+	l.st.close()
+	var remote net.Conn
+	l.accepted, remote = net.Pipe()
+	return remote, nil
+}
+
+func (l *closingListener) Close() error {
+	return nil
+}
+
+func TestSyslogAcceptAfterClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st := &syslogTail{conns: map[net.Conn]struct{}{}, lC: make(chan service.Line), ctx: ctx}
+	l := &closingListener{st: st}
+	st.listener = l
+
+	st.wg.Add(1)
+	st.accept()
+	st.wg.Wait()
+
+	assert.Empty(t, st.conns)
+	_, err := l.accepted.Write([]byte("<13>message\n"))
+	assert.Error(t, err)
+}
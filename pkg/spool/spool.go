@@ -0,0 +1,518 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spool
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FullPolicyBlock = "block"
+	FullPolicyFail  = "fail"
+
+	segmentExt       = ".seg"
+	cursorFile       = "cursor.json"
+	recordHeaderSize = 8
+	replayBatchSize  = 200
+)
+
+var ErrSpoolFull = errors.New("spool is full")
+var ErrSpoolClosed = errors.New("spool is closed")
+
+type Options struct {
+	MaxSize        int64         // max size of not yet forwarded entries
+	MaxSegmentSize int64         // size after which new segment file is started
+	FullPolicy     string        // block or fail, when MaxSize is reached
+	MinBackoff     time.Duration // first retry delay when repository is not available
+	MaxBackoff     time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxSize:        1 << 30,
+		MaxSegmentSize: 16 << 20,
+		FullPolicy:     FullPolicyBlock,
+		MinBackoff:     500 * time.Millisecond,
+		MaxBackoff:     time.Minute,
+	}
+}
+
+type cursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// Spool is a durable, disk backed buffer in front of json repository. Entries are appended to
+// segment files and forwarded in order by background goroutine, retrying until repository
+// accepts them. Forwarded position is stored in cursor file, so entries not confirmed by
+// repository are replayed after restart.
+type Spool struct {
+	dir  string
+	repo service.JsonRepository
+	opts Options
+
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	segments    []uint64
+	sizes       map[uint64]int64
+	size        int64
+	writer      *os.File
+	writeSeg    uint64
+	writeOffset int64
+	cursor      cursor
+	interrupted bool
+	closing     bool
+	stopC       chan struct{}
+	done        chan struct{}
+}
+
+func NewSpool(dir string, repo service.JsonRepository, opts Options) (*Spool, error) {
+	if opts.FullPolicy != FullPolicyBlock && opts.FullPolicy != FullPolicyFail {
+		return nil, fmt.Errorf("not supported spool full policy: %s", opts.FullPolicy)
+	}
+
+	if opts.MaxSize <= 0 || opts.MaxSegmentSize <= 0 {
+		return nil, errors.New("spool sizes need to be positive")
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create spool directory, %w", err)
+	}
+
+	s := &Spool{
+		dir:   dir,
+		repo:  repo,
+		opts:  opts,
+		sizes: map[uint64]int64{},
+		stopC: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.pending() > 0 {
+		log.WithField("dir", dir).WithField("bytes", s.pending()).Info("Replaying spooled entries")
+	}
+
+	go s.forward()
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return fmt.Errorf("could not list spool segments, %w", err)
+	}
+
+	for _, m := range matches {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(m), segmentExt), 10, 64)
+		if err != nil {
+			log.WithField("file", m).Warn("Not a spool segment, skipping")
+			continue
+		}
+
+		fi, err := os.Stat(m)
+		if err != nil {
+			return fmt.Errorf("could not stat spool segment, %w", err)
+		}
+
+		s.segments = append(s.segments, id)
+		s.sizes[id] = fi.Size()
+		s.size += fi.Size()
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	b, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if err == nil {
+		err = json.Unmarshal(b, &s.cursor)
+		if err != nil {
+			return fmt.Errorf("could not read spool cursor, %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not read spool cursor, %w", err)
+	}
+
+	// segments before cursor were forwarded already
+	for len(s.segments) > 0 && s.segments[0] < s.cursor.Segment {
+		s.removeSegment(s.segments[0])
+	}
+
+	if len(s.segments) > 0 && s.segments[0] != s.cursor.Segment {
+		s.cursor = cursor{Segment: s.segments[0]}
+	}
+
+	// always start a new segment, the last one could be left with partial record
+	s.writeSeg = 1
+	if len(s.segments) > 0 {
+		s.writeSeg = s.segments[len(s.segments)-1] + 1
+	}
+
+	if len(s.segments) == 0 {
+		s.cursor = cursor{Segment: s.writeSeg}
+	}
+
+	return s.openSegment(s.writeSeg)
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (s *Spool) openSegment(id uint64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create spool segment, %w", err)
+	}
+
+	if s.writer != nil {
+		s.writer.Close()
+	}
+
+	s.writer = f
+	s.writeSeg = id
+	s.writeOffset = 0
+	if _, ok := s.sizes[id]; !ok {
+		s.segments = append(s.segments, id)
+		s.sizes[id] = 0
+	}
+
+	return nil
+}
+
+func (s *Spool) removeSegment(id uint64) {
+	err := os.Remove(s.segmentPath(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.WithError(err).WithField("segment", id).Error("Could not remove forwarded spool segment")
+	}
+
+	s.size -= s.sizes[id]
+	delete(s.sizes, id)
+	s.segments = s.segments[1:]
+}
+
+// bytes not forwarded yet
+func (s *Spool) pending() int64 {
+	return s.size - s.cursor.Offset
+}
+
+// WriteBytes appends entries to spool. Returned transaction ID is always 0, as entries are
+// forwarded to repository asynchronously. With block policy, it waits for space until entries
+// are forwarded, or spool is interrupted or closed.
+func (s *Spool) WriteBytes(jBytesArr [][]byte) (uint64, error) {
+	buf := []byte{}
+	for _, jBytes := range jBytesArr {
+		header := make([]byte, recordHeaderSize)
+		binary.BigEndian.PutUint32(header, uint32(len(jBytes)))
+		binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(jBytes))
+		buf = append(buf, header...)
+		buf = append(buf, jBytes...)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blocked := false
+	for s.pending() > 0 && s.pending()+int64(len(buf)) > s.opts.MaxSize {
+		if s.closing {
+			return 0, ErrSpoolClosed
+		}
+
+		if s.opts.FullPolicy == FullPolicyFail || s.interrupted {
+			return 0, ErrSpoolFull
+		}
+
+		if !blocked {
+			log.WithField("dir", s.dir).WithField("bytes", s.pending()).Warn("Spool is full, waiting for entries to be forwarded")
+			blocked = true
+		}
+		s.cond.Wait()
+	}
+
+	if s.closing {
+		return 0, ErrSpoolClosed
+	}
+
+	if s.writeOffset >= s.opts.MaxSegmentSize {
+		err := s.openSegment(s.writeSeg + 1)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.writer.Write(buf)
+	if err == nil {
+		err = s.writer.Sync()
+	}
+
+	s.writeOffset += int64(n)
+	s.sizes[s.writeSeg] += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		// do not append to possibly corrupted segment
+		if rerr := s.openSegment(s.writeSeg + 1); rerr != nil {
+			log.WithError(rerr).Error("Could not rotate spool segment")
+		}
+		return 0, fmt.Errorf("could not write to spool, %w", err)
+	}
+
+	s.cond.Broadcast()
+	return 0, nil
+}
+
+// next blocks until there are entries to forward, returns false when spool is closing
+func (s *Spool) next() ([][]byte, cursor, bool) {
+	s.mutex.Lock()
+	var seg uint64
+	var offset, limit int64
+	for {
+		if s.closing {
+			s.mutex.Unlock()
+			return nil, cursor{}, false
+		}
+
+		seg = s.cursor.Segment
+		offset = s.cursor.Offset
+		limit = s.sizes[seg]
+		if seg == s.writeSeg {
+			limit = s.writeOffset
+		}
+
+		if offset < limit {
+			break
+		}
+
+		if seg != s.writeSeg && len(s.segments) > 1 {
+			s.removeSegment(seg)
+			s.cursor = cursor{Segment: s.segments[0]}
+			s.saveCursor()
+			s.cond.Broadcast()
+			continue
+		}
+
+		s.cond.Wait()
+	}
+	s.mutex.Unlock()
+
+	batch, next, err := s.readSegment(seg, offset, limit)
+	if err != nil {
+		log.WithError(err).WithField("segment", seg).WithField("offset", next.Offset).Error("Corrupted spool segment, skipping the rest of it")
+		next = cursor{Segment: seg, Offset: limit}
+	}
+
+	return batch, next, true
+}
+
+func (s *Spool) readSegment(seg uint64, offset int64, limit int64) ([][]byte, cursor, error) {
+	next := cursor{Segment: seg, Offset: offset}
+	f, err := os.Open(s.segmentPath(seg))
+	if err != nil {
+		return nil, next, fmt.Errorf("could not open spool segment, %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, next, fmt.Errorf("could not seek spool segment, %w", err)
+	}
+
+	batch := [][]byte{}
+	header := make([]byte, recordHeaderSize)
+	for len(batch) < replayBatchSize && next.Offset < limit {
+		if next.Offset+recordHeaderSize > limit {
+			return batch, next, errors.New("partial record header")
+		}
+
+		_, err = io.ReadFull(f, header)
+		if err != nil {
+			return batch, next, fmt.Errorf("could not read record header, %w", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header))
+		if next.Offset+recordHeaderSize+size > limit {
+			return batch, next, errors.New("partial record")
+		}
+
+		b := make([]byte, size)
+		_, err = io.ReadFull(f, b)
+		if err != nil {
+			return batch, next, fmt.Errorf("could not read record, %w", err)
+		}
+
+		if crc32.ChecksumIEEE(b) != binary.BigEndian.Uint32(header[4:]) {
+			return batch, next, errors.New("record checksum mismatch")
+		}
+
+		batch = append(batch, b)
+		next.Offset += recordHeaderSize + size
+	}
+
+	return batch, next, nil
+}
+
+// must be called with mutex held
+func (s *Spool) saveCursor() {
+	b, err := json.Marshal(s.cursor)
+	if err != nil {
+		log.WithError(err).Error("Could not marshal spool cursor")
+		return
+	}
+
+	tmp := filepath.Join(s.dir, cursorFile+".tmp")
+	err = os.WriteFile(tmp, b, 0600)
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(s.dir, cursorFile))
+	}
+
+	if err != nil {
+		log.WithError(err).Error("Could not write spool cursor")
+	}
+}
+
+func (s *Spool) forward() {
+	defer close(s.done)
+
+	backoff := s.opts.MinBackoff
+	for {
+		batch, next, ok := s.next()
+		if !ok {
+			return
+		}
+
+		if len(batch) > 0 {
+			txID, err := s.repo.WriteBytes(batch)
+			if err != nil {
+				if n := service.Written(err); n > 0 && n < len(batch) {
+					// entries stored before failure are not forwarded again
+					s.mutex.Lock()
+					s.cursor = forwardedCursor(s.cursor, batch[:n])
+					s.saveCursor()
+					s.cond.Broadcast()
+					s.mutex.Unlock()
+				}
+
+				log.WithError(err).WithField("entries", len(batch)).WithField("retry_in", backoff).Warn("Could not forward spooled entries")
+				select {
+				case <-s.stopC:
+					return
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > s.opts.MaxBackoff {
+					backoff = s.opts.MaxBackoff
+				}
+				continue
+			}
+
+			log.WithField("TXID", txID).WithField("entries", len(batch)).Trace("Forwarded spooled entries")
+		}
+
+		backoff = s.opts.MinBackoff
+
+		s.mutex.Lock()
+		s.cursor = next
+		s.saveCursor()
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+	}
+}
+
+// forwardedCursor returns position after forwarded entries of a batch read from start
+func forwardedCursor(start cursor, forwarded [][]byte) cursor {
+	for _, b := range forwarded {
+		start.Offset += recordHeaderSize + int64(len(b))
+	}
+
+	return start
+}
+
+// Interrupt makes writes waiting for space in full spool, and following ones, fail with
+// ErrSpoolFull, so the writer can stop while the backend is not available. Entries already
+// spooled are still forwarded.
+func (s *Spool) Interrupt() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.interrupted = true
+	s.cond.Broadcast()
+}
+
+// Close interrupts waiting writes and waits until all entries are forwarded or context is
+// done. Entries which were not forwarded stay on disk and are replayed when spool is opened
+// again.
+func (s *Spool) Close(ctx context.Context) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	s.mutex.Lock()
+	s.interrupted = true
+	s.cond.Broadcast()
+	if s.pending() > 0 {
+		log.WithField("dir", s.dir).WithField("bytes", s.pending()).Info("Waiting for spooled entries to be forwarded")
+	}
+	for s.pending() > 0 {
+		s.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+		s.mutex.Lock()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	s.closing = true
+	pending := s.pending()
+	s.cond.Broadcast()
+	s.mutex.Unlock()
+
+	close(s.stopC)
+	<-s.done
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.writer != nil {
+		s.writer.Close()
+	}
+
+	if pending > 0 {
+		log.WithField("dir", s.dir).WithField("bytes", pending).Warn("Entries were not forwarded, they stay spooled and will be replayed on next start")
+	}
+}
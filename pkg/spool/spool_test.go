@@ -0,0 +1,269 @@
+/*
+Copyright 2023 Codenotary Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb-log-audit/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRepository struct {
+	mutex   sync.Mutex
+	entries []string
+	down    bool
+	// entries stored by next write before it fails
+	partial int
+}
+
+func (r *testRepository) WriteBytes(b [][]byte) (uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.partial > 0 && r.partial < len(b) {
+		for _, e := range b[:r.partial] {
+			r.entries = append(r.entries, string(e))
+		}
+		err := &service.PartialWriteError{Written: r.partial, Err: errors.New("backend unavailable")}
+		r.partial = 0
+		return 0, err
+	}
+
+	if r.down {
+		return 0, errors.New("backend unavailable")
+	}
+
+	for _, e := range b {
+		r.entries = append(r.entries, string(e))
+	}
+
+	return uint64(len(r.entries)), nil
+}
+
+func (r *testRepository) setDown(down bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.down = down
+}
+
+func (r *testRepository) stored() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.entries...)
+}
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.MaxSegmentSize = 64
+	opts.MinBackoff = time.Millisecond
+	opts.MaxBackoff = 10 * time.Millisecond
+	return opts
+}
+
+func TestSpoolReplaysInOrder(t *testing.T) {
+	dir := t.TempDir()
+	repo := &testRepository{down: true}
+
+	s, err := NewSpool(dir, repo, testOptions())
+	require.NoError(t, err)
+
+	expected := []string{}
+	for i := 0; i < 50; i++ {
+		e := fmt.Sprintf(`{"n":%d}`, i)
+		expected = append(expected, e)
+		_, err := s.WriteBytes([][]byte{[]byte(e)})
+		require.NoError(t, err)
+	}
+
+	// backend is down, entries stay spooled after close
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	s.Close(ctx)
+	cancel()
+	assert.Empty(t, repo.stored())
+
+	repo.setDown(false)
+	s, err = NewSpool(dir, repo, testOptions())
+	require.NoError(t, err)
+
+	_, err = s.WriteBytes([][]byte{[]byte(`{"n":50}`)})
+	require.NoError(t, err)
+	expected = append(expected, `{"n":50}`)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	s.Close(ctx)
+	cancel()
+	assert.Equal(t, expected, repo.stored())
+
+	// forwarded entries are not replayed again
+	s, err = NewSpool(dir, repo, testOptions())
+	require.NoError(t, err)
+	s.Close(context.Background())
+	assert.Equal(t, expected, repo.stored())
+}
+
+func TestSpoolPartialWrite(t *testing.T) {
+	repo := &testRepository{down: true}
+	opts := testOptions()
+	opts.MaxSegmentSize = 1 << 20
+
+	s, err := NewSpool(t.TempDir(), repo, opts)
+	require.NoError(t, err)
+
+	expected := []string{}
+	batch := [][]byte{}
+	for i := 0; i < 10; i++ {
+		e := fmt.Sprintf(`{"n":%d}`, i)
+		expected = append(expected, e)
+		batch = append(batch, []byte(e))
+	}
+	_, err = s.WriteBytes(batch)
+	require.NoError(t, err)
+
+	repo.mutex.Lock()
+	repo.down = false
+	repo.partial = 3
+	repo.mutex.Unlock()
+
+	// entries stored before failure are not forwarded again
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	s.Close(ctx)
+	cancel()
+	assert.Equal(t, expected, repo.stored())
+}
+
+func TestSpoolFull(t *testing.T) {
+	repo := &testRepository{down: true}
+	opts := testOptions()
+	opts.MaxSize = 110
+	opts.FullPolicy = FullPolicyFail
+
+	s, err := NewSpool(t.TempDir(), repo, opts)
+	require.NoError(t, err)
+
+	entry := []byte(`{"entry":"0123456789012345678901234567890"}`)
+	_, err = s.WriteBytes([][]byte{entry})
+	require.NoError(t, err)
+	_, err = s.WriteBytes([][]byte{entry})
+	require.NoError(t, err)
+	_, err = s.WriteBytes([][]byte{entry})
+	assert.ErrorIs(t, err, ErrSpoolFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	s.Close(ctx)
+	cancel()
+
+	opts.FullPolicy = FullPolicyBlock
+	s, err = NewSpool(t.TempDir(), repo, opts)
+	require.NoError(t, err)
+
+	_, err = s.WriteBytes([][]byte{entry, entry})
+	require.NoError(t, err)
+
+	written := make(chan error)
+	go func() {
+		_, err := s.WriteBytes([][]byte{entry})
+		written <- err
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("write should block when spool is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	repo.setDown(false)
+	select {
+	case err := <-written:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write should unblock when entries are forwarded")
+	}
+
+	s.Close(context.Background())
+	assert.Len(t, repo.stored(), 3)
+}
+
+func TestSpoolInterrupt(t *testing.T) {
+	repo := &testRepository{down: true}
+	opts := testOptions()
+	opts.MaxSize = 110
+
+	s, err := NewSpool(t.TempDir(), repo, opts)
+	require.NoError(t, err)
+
+	entry := []byte(`{"entry":"0123456789012345678901234567890"}`)
+	_, err = s.WriteBytes([][]byte{entry, entry})
+	require.NoError(t, err)
+
+	written := make(chan error)
+	go func() {
+		_, err := s.WriteBytes([][]byte{entry})
+		written <- err
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("write should block when spool is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Interrupt()
+	select {
+	case err := <-written:
+		assert.ErrorIs(t, err, ErrSpoolFull)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write should unblock when spool is interrupted")
+	}
+
+	_, err = s.WriteBytes([][]byte{entry})
+	assert.ErrorIs(t, err, ErrSpoolFull)
+
+	// spooled entries are still forwarded
+	repo.setDown(false)
+	s.Close(context.Background())
+	assert.Len(t, repo.stored(), 2)
+
+	// close wakes up blocked writers too
+	repo.setDown(true)
+	s, err = NewSpool(t.TempDir(), repo, opts)
+	require.NoError(t, err)
+	_, err = s.WriteBytes([][]byte{entry, entry})
+	require.NoError(t, err)
+
+	go func() {
+		_, err := s.WriteBytes([][]byte{entry})
+		written <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	s.Close(ctx)
+	cancel()
+	select {
+	case err := <-written:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write should unblock when spool is closed")
+	}
+}